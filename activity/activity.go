@@ -192,6 +192,18 @@ func (a *Activity) PopularTracks(ctx Context, start, end time.Time) []Track {
 	return a.resolveTrackEvents(events, ctx)
 }
 
+// ReleaseGroupPlays has the number of track plays by release group since
+// start.
+func (a *Activity) ReleaseGroupPlays(ctx Context, start time.Time) map[string]int {
+	user := ctx.User()
+	return a.UserReleaseGroupPlays(user.Name, start)
+}
+
+// UserReleaseGroupPlays is ReleaseGroupPlays for the named user.
+func (a *Activity) UserReleaseGroupPlays(user string, start time.Time) map[string]int {
+	return a.releaseGroupPlays(user, start)
+}
+
 //
 func (a *Activity) RecentTracks(ctx Context) []Track {
 	user := ctx.User()
@@ -65,6 +65,24 @@ func (a *Activity) popularTrackEventsFrom(user string, start, end time.Time, lim
 	return events
 }
 
+// releaseGroupPlays counts the user's track plays for each release group
+// since start.
+func (a *Activity) releaseGroupPlays(user string, start time.Time) map[string]int {
+	var rows []struct {
+		RGID  string
+		Plays int
+	}
+	a.db.Model(&TrackEvent{}).
+		Select("rg_id as rg_id, count(*) as plays").
+		Where("user = ? and rg_id <> '' and date >= ?", user, start).
+		Group("rg_id").Scan(&rows)
+	plays := make(map[string]int)
+	for _, r := range rows {
+		plays[r.RGID] = r.Plays
+	}
+	return plays
+}
+
 func (a *Activity) movieEventsFrom(user string, start, end time.Time, limit int) []MovieEvent {
 	var events []MovieEvent
 	a.db.Where("user = ? and date >= ? and date <= ?", user, start, end).
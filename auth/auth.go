@@ -20,6 +20,7 @@ package auth
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"net/http"
 	"time"
@@ -63,6 +64,7 @@ type User struct {
 	Key   []byte
 	Salt  []byte
 	Media string
+	Admin bool `gorm:"default:false"`
 }
 
 // A Session is an authenticated user login session associated with a token and
@@ -125,7 +127,7 @@ func (a *Auth) Open() (err error) {
 		return
 	}
 
-	err = a.db.AutoMigrate(&Code{}, &Session{}, &User{})
+	err = a.db.AutoMigrate(&Code{}, &Session{}, &SigningKey{}, &User{})
 	return
 }
 
@@ -139,13 +141,7 @@ func (a *Auth) Close() {
 
 // AddUser adds a new user to the user database.
 func (a *Auth) AddUser(userid, pass string) error {
-	salt := make([]byte, 8)
-	_, err := rand.Read(salt)
-	if err != nil {
-		return err
-	}
-
-	key, err := a.key(pass, salt)
+	salt, key, err := a.newKey(pass)
 	if err != nil {
 		return err
 	}
@@ -155,6 +151,26 @@ func (a *Auth) AddUser(userid, pass string) error {
 	return a.createUser(&u)
 }
 
+// AddProxyUser adds a new user authenticated by a trusted proxy. The user is
+// assigned a random password and the provided media.
+func (a *Auth) AddProxyUser(userid, media string) (User, error) {
+	pass, err := randomBytes(KeySize)
+	if err != nil {
+		return User{}, err
+	}
+	err = a.AddUser(userid, hex.EncodeToString(pass))
+	if err != nil {
+		return User{}, err
+	}
+	if media != "" {
+		err = a.AssignMedia(userid, media)
+		if err != nil {
+			return User{}, err
+		}
+	}
+	return a.User(userid)
+}
+
 // User returns the user found with the provded userid.
 func (a *Auth) User(userid string) (User, error) {
 	var u User
@@ -209,6 +225,17 @@ func (a *Auth) Login(userid, pass string) (Session, error) {
 	return session, err
 }
 
+// UserSession creates a new session for a user authenticated some other way,
+// such as by a trusted proxy.
+func (a *Auth) UserSession(u *User) (Session, error) {
+	session := a.session(u)
+	err := a.createSession(&session)
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
 // ChangePass changes the password associated with the provided userid.  User
 // Check prior to this if you'd like to verify the current password.
 func (a *Auth) ChangePass(userid, newpass string) error {
@@ -234,6 +261,15 @@ func (a *Auth) ChangePass(userid, newpass string) error {
 	return a.db.Model(u).Update("salt", u.Salt).Update("key", u.Key).Error
 }
 
+// AssignAdmin grants or revokes admin access for the provided userid.
+func (a *Auth) AssignAdmin(userid string, admin bool) error {
+	u, err := a.User(userid)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	return a.db.Model(u).Update("admin", admin).Error
+}
+
 // readSecret returns secret from configured string or file
 func (a *Auth) readSecret(cfg config.TokenConfig) ([]byte, error) {
 	if cfg.Secret != "" {
@@ -250,8 +286,10 @@ func (a *Auth) readSecret(cfg config.TokenConfig) ([]byte, error) {
 	return data, nil
 }
 
-// newToken creates a new JWT token
-func (a *Auth) newToken(subject string, cfg config.TokenConfig) (string, error) {
+// newToken creates a new JWT token signed with the active key for the
+// provided use, or the configured secret if there is no active key and the
+// secret isn't retired.
+func (a *Auth) newToken(subject, use string, cfg config.TokenConfig) (string, error) {
 	age := int(cfg.Age.Seconds())
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.StandardClaims{
@@ -259,6 +297,14 @@ func (a *Auth) newToken(subject string, cfg config.TokenConfig) (string, error)
 			Subject:   subject,
 			ExpiresAt: time.Now().Add(time.Second * time.Duration(age)).Unix(),
 		})
+	key := a.activeKey(use)
+	if key != nil {
+		token.Header[HeaderKeyID] = key.KID
+		return token.SignedString(key.Secret)
+	}
+	if cfg.RetireSecret {
+		return "", ErrSecretRetired
+	}
 	secret, err := a.readSecret(cfg)
 	if err != nil {
 		return "", err
@@ -267,23 +313,23 @@ func (a *Auth) newToken(subject string, cfg config.TokenConfig) (string, error)
 }
 
 // newSessionToken creates a new JWT token associated with the provided session.
-func (a *Auth) newSessionToken(s Session, cfg config.TokenConfig) (string, error) {
-	return a.newToken(s.User, cfg)
+func (a *Auth) newSessionToken(s Session, use string, cfg config.TokenConfig) (string, error) {
+	return a.newToken(s.User, use, cfg)
 }
 
 // NewAccessToken creates a new JWT token associated with the provided session.
 func (a *Auth) NewAccessToken(s Session) (string, error) {
-	return a.newSessionToken(s, a.config.Auth.AccessToken)
+	return a.newSessionToken(s, KeyUseAccess, a.config.Auth.AccessToken)
 }
 
 // NewMediaToken creates a new JWT token associated with the provided session.
 func (a *Auth) NewMediaToken(s Session) (string, error) {
-	return a.newSessionToken(s, a.config.Auth.MediaToken)
+	return a.newSessionToken(s, KeyUseMedia, a.config.Auth.MediaToken)
 }
 
 // NewCodeToken creates a new JWT token for code-based authentication
 func (a *Auth) NewCodeToken(subject string) (string, error) {
-	return a.newToken(subject, a.config.Auth.CodeToken)
+	return a.newToken(subject, KeyUseCode, a.config.Auth.CodeToken)
 }
 
 // NewCookie creates a new cookie associated with the provided session.
@@ -330,12 +376,12 @@ func (a *Auth) CheckCookie(cookie *http.Cookie) error {
 }
 
 func (a *Auth) CheckAccessToken(signedToken string) error {
-	_, _, err := a.processToken(signedToken, a.config.Auth.AccessToken)
+	_, _, err := a.processToken(signedToken, KeyUseAccess, a.config.Auth.AccessToken)
 	return err
 }
 
 func (a *Auth) CheckAccessTokenUser(signedToken string) (User, error) {
-	_, claims, err := a.processToken(signedToken, a.config.Auth.AccessToken)
+	_, claims, err := a.processToken(signedToken, KeyUseAccess, a.config.Auth.AccessToken)
 	if err != nil {
 		return User{}, err
 	}
@@ -343,12 +389,12 @@ func (a *Auth) CheckAccessTokenUser(signedToken string) (User, error) {
 }
 
 func (a *Auth) CheckMediaToken(signedToken string) error {
-	_, _, err := a.processToken(signedToken, a.config.Auth.MediaToken)
+	_, _, err := a.processToken(signedToken, KeyUseMedia, a.config.Auth.MediaToken)
 	return err
 }
 
 func (a *Auth) CheckMediaTokenUser(signedToken string) (User, error) {
-	_, claims, err := a.processToken(signedToken, a.config.Auth.MediaToken)
+	_, claims, err := a.processToken(signedToken, KeyUseMedia, a.config.Auth.MediaToken)
 	if err != nil {
 		return User{}, err
 	}
@@ -356,7 +402,7 @@ func (a *Auth) CheckMediaTokenUser(signedToken string) (User, error) {
 }
 
 func (a *Auth) CheckCodeToken(signedToken string) error {
-	_, claims, err := a.processToken(signedToken, a.config.Auth.CodeToken)
+	_, claims, err := a.processToken(signedToken, KeyUseCode, a.config.Auth.CodeToken)
 	if err != nil {
 		return err
 	}
@@ -369,12 +415,20 @@ func (a *Auth) CheckCodeToken(signedToken string) error {
 	return nil
 }
 
-// processToken parses and verfies the signed token is valid.
-func (a *Auth) processToken(signedToken string, cfg config.TokenConfig) (*jwt.Token, *jwt.StandardClaims, error) {
+// processToken parses and verfies the signed token is valid. Tokens with a
+// key ID are verified using the matching non-retired key. Tokens without a
+// key ID are rejected once the configured secret is retired.
+func (a *Auth) processToken(signedToken, use string, cfg config.TokenConfig) (*jwt.Token, *jwt.StandardClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
+		func(t *jwt.Token) (interface{}, error) {
+			if kid, ok := t.Header[HeaderKeyID]; ok {
+				return a.validationKey(kid, use)
+			}
+			if cfg.RetireSecret {
+				return nil, ErrSecretRetired
+			}
 			secret, err := a.readSecret(cfg)
 			return secret, err
 		})
@@ -418,7 +472,7 @@ func (a *Auth) RefreshCookie(session *Session, cookie *http.Cookie) error {
 
 // DeleteSession will delete the provided session
 func (a *Auth) DeleteSession(session Session) {
-	a.db.Delete(session)
+	a.db.Delete(&session)
 }
 
 func (a *Auth) DeleteSessions(u *User) error {
@@ -449,6 +503,20 @@ func (a *Auth) key(pass string, salt []byte) ([]byte, error) {
 	return scrypt.Key([]byte(pass), salt, 32768, 8, 1, 32)
 }
 
+// newKey returns a new random salt and the key for the provided password.
+func (a *Auth) newKey(pass string) ([]byte, []byte, error) {
+	salt := make([]byte, 8)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := a.key(pass, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return salt, key, nil
+}
+
 func (a *Auth) findCookieSession(cookie *http.Cookie) *Session {
 	return a.findSession(cookie.Value)
 }
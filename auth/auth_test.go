@@ -52,10 +52,11 @@ func TestLogin(t *testing.T) {
 	}
 	defer a.Close()
 
-	cookie, err := a.Login("defsub@defsub.com", "testpass")
+	session, err := a.Login("defsub@defsub.com", "testpass")
 	if err != nil {
 		t.Errorf("login should have worked: %s\n", err)
 	}
+	cookie := a.NewCookie(&session)
 	if len(cookie.Value) == 0 {
 		t.Errorf("no cookie")
 	}
@@ -63,12 +64,12 @@ func TestLogin(t *testing.T) {
 		t.Error("bad cookie name")
 	}
 
-	cookie, err = a.Login("defsub@defsub.com", "badpass")
+	_, err = a.Login("defsub@defsub.com", "badpass")
 	if err == nil {
 		t.Errorf("should be incorrect password")
 	}
 
-	cookie, err = a.Login("bad@user.com", "testpass")
+	_, err = a.Login("bad@user.com", "testpass")
 	if err == nil {
 		t.Errorf("should be incorrect user")
 	}
@@ -87,12 +88,13 @@ func TestCookie(t *testing.T) {
 	defer a.Close()
 
 	bad := http.Cookie{Name: CookieName, Value: "foo"}
-	if a.Valid(bad) == true {
+	if a.CheckCookie(&bad) == nil {
 		t.Errorf("cookie should not exist")
 	}
 
-	cookie, err := a.Login("defsub@defsub.com", "testpass")
-	if a.Valid(cookie) == false {
+	session, err := a.Login("defsub@defsub.com", "testpass")
+	cookie := a.NewCookie(&session)
+	if a.CheckCookie(&cookie) != nil {
 		t.Errorf("cookie should be good")
 	}
 }
@@ -109,14 +111,15 @@ func TestLogout(t *testing.T) {
 	}
 	defer a.Close()
 
-	cookie, err := a.Login("defsub@defsub.com", "testpass")
-	if a.Valid(cookie) == false {
+	session, err := a.Login("defsub@defsub.com", "testpass")
+	cookie := a.NewCookie(&session)
+	if a.CheckCookie(&cookie) != nil {
 		t.Errorf("cookie should be good")
 	}
 
-	a.Logout(cookie)
+	a.DeleteSession(session)
 
-	if a.Valid(cookie) == true {
+	if a.CheckCookie(&cookie) == nil {
 		t.Errorf("cookie should fail")
 	}
 }
@@ -133,14 +136,15 @@ func TestMaxAge(t *testing.T) {
 	}
 	defer a.Close()
 
-	cookie, err := a.Login("defsub@defsub.com", "testpass")
-	if a.Valid(cookie) == false {
+	session, err := a.Login("defsub@defsub.com", "testpass")
+	cookie := a.NewCookie(&session)
+	if a.CheckCookie(&cookie) != nil {
 		t.Errorf("cookie should be good")
 	}
 
 	cookie.MaxAge = 0
 	now := time.Now()
-	err = a.Refresh(&cookie)
+	err = a.RefreshCookie(&session, &cookie)
 	if err != nil {
 		t.Errorf("refresh failed")
 	}
@@ -149,9 +153,269 @@ func TestMaxAge(t *testing.T) {
 	}
 	d, _ := time.ParseDuration(fmt.Sprintf("%ds", cookie.MaxAge))
 	age1 := now.Add(d)
-	age2 := now.Add(config.Auth.MaxAge)
+	age2 := now.Add(config.Auth.SessionAge)
 	delta := int(math.Abs(age1.Sub(age2).Seconds()))
 	if delta > 1 {
 		t.Errorf("delta is %d\n", delta)
 	}
 }
+
+func TestInvite(t *testing.T) {
+	config, err := config.TestConfig()
+	if err != nil {
+		t.Fatalf("GetConfig %s\n", err)
+	}
+	a := NewAuth(config)
+	err = a.Open()
+	if err != nil {
+		t.Fatalf("Open %s\n", err)
+	}
+	defer a.Close()
+
+	code, err := a.GenerateInvite("testmedia", 2, time.Hour)
+	if err != nil {
+		t.Fatalf("invite %s\n", err)
+	}
+	if len(code.Value) != InviteCodeSize {
+		t.Errorf("bad invite code size %d\n", len(code.Value))
+	}
+	if a.ValidInvite(code.Value) == nil {
+		t.Errorf("invite should be valid")
+	}
+
+	suffix := time.Now().UnixNano()
+	user1 := fmt.Sprintf("invite1-%d@defsub.com", suffix)
+	user2 := fmt.Sprintf("invite2-%d@defsub.com", suffix)
+	user3 := fmt.Sprintf("invite3-%d@defsub.com", suffix)
+
+	u, err := a.AcceptInvite(code.Value, user1, "testpass")
+	if err != nil {
+		t.Fatalf("accept %s\n", err)
+	}
+	if u.Name != user1 || u.Media != "testmedia" {
+		t.Errorf("bad invite user %s %s\n", u.Name, u.Media)
+	}
+	_, err = a.Check(user1, "testpass")
+	if err != nil {
+		t.Errorf("invite user should login: %s\n", err)
+	}
+
+	// existing user doesn't use the invite
+	_, err = a.AcceptInvite(code.Value, user1, "testpass")
+	if err != ErrUserExists {
+		t.Errorf("expected user exists, got %v\n", err)
+	}
+	if c := a.ValidInvite(code.Value); c == nil || c.Uses != 1 {
+		t.Errorf("invite should have one use left")
+	}
+
+	_, err = a.AcceptInvite(code.Value, user2, "testpass")
+	if err != nil {
+		t.Fatalf("accept %s\n", err)
+	}
+
+	// used up
+	if a.ValidInvite(code.Value) != nil {
+		t.Errorf("invite should be used up")
+	}
+	_, err = a.AcceptInvite(code.Value, user3, "testpass")
+	if err != ErrInviteNotFound {
+		t.Errorf("expected invite not found, got %v\n", err)
+	}
+	_, err = a.User(user3)
+	if err != ErrUserNotFound {
+		t.Errorf("user should not be created")
+	}
+
+	err = a.DeleteExpiredInvites()
+	if err != nil {
+		t.Errorf("delete %s\n", err)
+	}
+	if a.findInvite(code.Value) != nil {
+		t.Errorf("used invite should be deleted")
+	}
+}
+
+func TestInviteExpired(t *testing.T) {
+	config, err := config.TestConfig()
+	if err != nil {
+		t.Fatalf("GetConfig %s\n", err)
+	}
+	a := NewAuth(config)
+	err = a.Open()
+	if err != nil {
+		t.Fatalf("Open %s\n", err)
+	}
+	defer a.Close()
+
+	code, err := a.GenerateInvite("testmedia", 1, -time.Minute)
+	if err != nil {
+		t.Fatalf("invite %s\n", err)
+	}
+	if a.ValidInvite(code.Value) != nil {
+		t.Errorf("invite should be expired")
+	}
+
+	user := fmt.Sprintf("expired-%d@defsub.com", time.Now().UnixNano())
+	_, err = a.AcceptInvite(code.Value, user, "testpass")
+	if err != ErrInviteNotFound {
+		t.Errorf("expected invite not found, got %v\n", err)
+	}
+	_, err = a.User(user)
+	if err != ErrUserNotFound {
+		t.Errorf("user should not be created")
+	}
+
+	err = a.DeleteExpiredInvites()
+	if err != nil {
+		t.Errorf("delete %s\n", err)
+	}
+	if a.findInvite(code.Value) != nil {
+		t.Errorf("expired invite should be deleted")
+	}
+}
+
+func TestGenerateCode(t *testing.T) {
+	config, err := config.TestConfig()
+	if err != nil {
+		t.Fatalf("GetConfig %s\n", err)
+	}
+	a := NewAuth(config)
+	err = a.Open()
+	if err != nil {
+		t.Fatalf("Open %s\n", err)
+	}
+	defer a.Close()
+
+	code, err := a.GenerateCode()
+	if err != nil {
+		t.Fatalf("code %s\n", err)
+	}
+	if len(code.Value) != CodeSize {
+		t.Errorf("bad code size %d\n", len(code.Value))
+	}
+	if a.ValidCode(code.Value) == nil {
+		t.Errorf("code should be valid")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	config, err := config.TestConfig()
+	if err != nil {
+		t.Fatalf("GetConfig %s\n", err)
+	}
+	a := NewAuth(config)
+	err = a.Open()
+	if err != nil {
+		t.Fatalf("Open %s\n", err)
+	}
+	defer a.Close()
+
+	// retire any keys left from previous runs
+	for _, k := range a.Keys() {
+		a.RetireKey(k.KID)
+	}
+
+	session := Session{User: "defsub@defsub.com"}
+
+	// no active key uses the configured secret
+	secretToken, err := a.NewAccessToken(session)
+	if err != nil {
+		t.Fatalf("token %s\n", err)
+	}
+	if err := a.CheckAccessToken(secretToken); err != nil {
+		t.Errorf("secret token should be valid: %s\n", err)
+	}
+
+	key1, err := a.GenerateKey(KeyUseAccess)
+	if err != nil {
+		t.Fatalf("key %s\n", err)
+	}
+	err = a.ActivateKey(key1.KID)
+	if err != nil {
+		t.Fatalf("activate %s\n", err)
+	}
+	token1, err := a.NewAccessToken(session)
+	if err != nil {
+		t.Fatalf("token %s\n", err)
+	}
+	token, _, err := a.processToken(token1, KeyUseAccess, config.Auth.AccessToken)
+	if err != nil {
+		t.Fatalf("token1 should be valid: %s\n", err)
+	}
+	if token.Header[HeaderKeyID] != key1.KID {
+		t.Errorf("token1 should use key1, got %v\n", token.Header[HeaderKeyID])
+	}
+	if err := a.CheckAccessToken(secretToken); err != nil {
+		t.Errorf("secret token should still be valid: %s\n", err)
+	}
+
+	// rotate to key2, tokens signed with key1 remain valid
+	key2, err := a.GenerateKey(KeyUseAccess)
+	if err != nil {
+		t.Fatalf("key %s\n", err)
+	}
+	err = a.ActivateKey(key2.KID)
+	if err != nil {
+		t.Fatalf("activate %s\n", err)
+	}
+	token2, err := a.NewAccessToken(session)
+	if err != nil {
+		t.Fatalf("token %s\n", err)
+	}
+	token, _, err = a.processToken(token2, KeyUseAccess, config.Auth.AccessToken)
+	if err != nil {
+		t.Fatalf("token2 should be valid: %s\n", err)
+	}
+	if token.Header[HeaderKeyID] != key2.KID {
+		t.Errorf("token2 should use key2, got %v\n", token.Header[HeaderKeyID])
+	}
+	if err := a.CheckAccessToken(token1); err != nil {
+		t.Errorf("token1 should still be valid: %s\n", err)
+	}
+
+	// tokens without a key ID are rejected once the secret is retired
+	retired := config.Auth.AccessToken
+	retired.RetireSecret = true
+	if _, _, err := a.processToken(secretToken, KeyUseAccess, retired); err == nil {
+		t.Errorf("secret token should be rejected after secret retired")
+	}
+	if _, _, err := a.processToken(token2, KeyUseAccess, retired); err != nil {
+		t.Errorf("token2 should be valid with retired secret: %s\n", err)
+	}
+
+	// access key can't validate media tokens
+	if err := a.CheckMediaToken(token2); err == nil {
+		t.Errorf("access key should not validate media token")
+	}
+
+	// retired keys are rejected
+	err = a.RetireKey(key1.KID)
+	if err != nil {
+		t.Fatalf("retire %s\n", err)
+	}
+	if err := a.CheckAccessToken(token1); err == nil {
+		t.Errorf("token1 should be rejected after retire")
+	}
+	if err := a.CheckAccessToken(token2); err != nil {
+		t.Errorf("token2 should still be valid: %s\n", err)
+	}
+	if err := a.ActivateKey(key1.KID); err != ErrKeyRetired {
+		t.Errorf("expected retired key error, got %v\n", err)
+	}
+
+	err = a.RetireKey(key2.KID)
+	if err != nil {
+		t.Fatalf("retire %s\n", err)
+	}
+	if err := a.CheckAccessToken(token2); err == nil {
+		t.Errorf("token2 should be rejected after retire")
+	}
+
+	// no active key and a retired secret can't sign tokens
+	config.Auth.AccessToken.RetireSecret = true
+	defer func() { config.Auth.AccessToken.RetireSecret = false }()
+	if _, err := a.NewAccessToken(session); err != ErrSecretRetired {
+		t.Errorf("expected secret retired error, got %v\n", err)
+	}
+}
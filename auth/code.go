@@ -18,8 +18,9 @@
 package auth
 
 import (
+	"crypto/rand"
 	"errors"
-	rando "math/rand"
+	"math/big"
 	"time"
 
 	"gorm.io/gorm"
@@ -30,21 +31,31 @@ const (
 	CodeSize  = 6
 )
 
+// A Code is a short expiring value used to link a device to a login, or when
+// Invite is set, to allow a new user to create a login with preassigned media.
 type Code struct {
 	gorm.Model
 	Value   string `gorm:"unique_index:idx_code_value"`
 	Expires time.Time
 	Token   string
+	Invite  bool `gorm:"default:false"`
+	Media   string
+	Uses    int // remaining invite uses
 }
 
-func randomCode() string {
+// randomCode returns a code of the provided size using a cryptographically
+// secure random source since codes are used as short-lived credentials.
+func randomCode(size int) (string, error) {
 	var code string
-	rando.Seed(time.Now().UnixNano())
-	for i := 0; i < CodeSize; i++ {
-		n := rando.Intn(len(CodeChars))
-		code += string(CodeChars[n])
+	max := big.NewInt(int64(len(CodeChars)))
+	for i := 0; i < size; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code += string(CodeChars[n.Int64()])
 	}
-	return code
+	return code, nil
 }
 
 func (a *Auth) createCode(c *Code) (err error) {
@@ -54,7 +65,7 @@ func (a *Auth) createCode(c *Code) (err error) {
 
 func (a *Auth) findCode(value string) *Code {
 	var code Code
-	err := a.db.Where("value = ?", value).First(&code).Error
+	err := a.db.Where("value = ? and invite = ?", value, false).First(&code).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil
 	}
@@ -70,12 +81,15 @@ func (a *Auth) DeleteExpiredCodes() error {
 	return a.db.Unscoped().Where("expires < ?", now).Delete(Code{}).Error
 }
 
-func (a *Auth) GenerateCode() *Code {
-	value := randomCode()
+func (a *Auth) GenerateCode() (*Code, error) {
+	value, err := randomCode(CodeSize)
+	if err != nil {
+		return nil, err
+	}
 	expires := time.Now().Add(a.codeAge())
 	c := &Code{Value: value, Expires: expires}
-	a.db.Create(c)
-	return c
+	err = a.createCode(c)
+	return c, err
 }
 
 func (c *Code) expired() bool {
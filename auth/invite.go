@@ -0,0 +1,148 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	InviteCodeSize = 10
+)
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrUserExists     = errors.New("user already exists")
+)
+
+// GenerateInvite creates an invite code which can be used at most uses times
+// to create new users assigned to the provided media. The invite expires
+// after the provided age, or the configured invite age if zero.
+func (a *Auth) GenerateInvite(media string, uses int, age time.Duration) (*Code, error) {
+	if uses <= 0 {
+		uses = 1
+	}
+	if age == 0 {
+		age = a.config.Auth.InviteAge
+	}
+	value, err := randomCode(InviteCodeSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &Code{
+		Value:   value,
+		Expires: time.Now().Add(age),
+		Invite:  true,
+		Media:   media,
+		Uses:    uses,
+	}
+	err = a.createCode(c)
+	return c, err
+}
+
+func (a *Auth) findInvite(value string) *Code {
+	var code Code
+	err := a.db.Where("value = ? and invite = ?", value, true).First(&code).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return &code
+}
+
+// ValidInvite returns the invite code if it exists, has not expired and has
+// uses remaining.
+func (a *Auth) ValidInvite(value string) *Code {
+	code := a.findInvite(value)
+	if code == nil || code.expired() || code.Uses <= 0 {
+		return nil
+	}
+	return code
+}
+
+// Invites returns all invite codes, including expired invites.
+func (a *Auth) Invites() []Code {
+	var codes []Code
+	a.db.Where("invite = ?", true).Order("created_at desc").Find(&codes)
+	return codes
+}
+
+// DeleteInvite removes the invite code so it can no longer be used.
+func (a *Auth) DeleteInvite(value string) error {
+	code := a.findInvite(value)
+	if code == nil {
+		return ErrInviteNotFound
+	}
+	a.deleteCode(code)
+	return nil
+}
+
+// AcceptInvite creates a new user with the media assigned by the invite and
+// uses up one of the invite uses.
+func (a *Auth) AcceptInvite(value, userid, pass string) (User, error) {
+	code := a.ValidInvite(value)
+	if code == nil {
+		return User{}, ErrInviteNotFound
+	}
+	_, err := a.User(userid)
+	if err == nil {
+		return User{}, ErrUserExists
+	}
+
+	salt, key, err := a.newKey(pass)
+	if err != nil {
+		return User{}, err
+	}
+
+	// use the invite and create the user together so a failed user creation
+	// doesn't use up the invite, and concurrent requests can't over use it
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Code{}).Where("id = ? and uses > 0", code.ID).
+			Update("uses", gorm.Expr("uses - 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteNotFound
+		}
+		// check again now that the write lock is held by this transaction
+		var count int64
+		err := tx.Model(&User{}).Where("name = ?", userid).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserExists
+		}
+		u := User{Name: userid, Key: key, Salt: salt, Media: code.Media}
+		return tx.Create(&u).Error
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return a.User(userid)
+}
+
+// DeleteExpiredInvites removes expired and used up invites.
+func (a *Auth) DeleteExpiredInvites() error {
+	now := time.Now()
+	return a.db.Unscoped().Where("invite = ? and (expires < ? or uses <= 0)", true, now).
+		Delete(Code{}).Error
+}
@@ -0,0 +1,173 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	KeyUseAccess = "access"
+	KeyUseMedia  = "media"
+	KeyUseCode   = "code"
+
+	KeySize = 32
+	KIDSize = 8
+
+	HeaderKeyID = "kid"
+)
+
+var (
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrKeyRetired     = errors.New("key retired")
+	ErrSecretRetired  = errors.New("token secret retired")
+	ErrInvalidKeyUse  = errors.New("invalid key use")
+	ErrInvalidTokenID = errors.New("invalid token key id")
+)
+
+// A SigningKey is an HMAC secret used to sign tokens of a specific use
+// (access, media or code). Only one key per use is active and used to sign
+// new tokens. Non-retired keys are accepted when validating tokens, which
+// allows keys to be rotated without invalidating existing tokens.
+type SigningKey struct {
+	gorm.Model
+	KID     string `gorm:"uniqueIndex:idx_key_kid"`
+	Use     string `gorm:"index:idx_key_use"`
+	Secret  []byte `json:"-"`
+	Active  bool
+	Retired bool
+}
+
+func validKeyUse(use string) bool {
+	switch use {
+	case KeyUseAccess, KeyUseMedia, KeyUseCode:
+		return true
+	}
+	return false
+}
+
+func randomBytes(size int) ([]byte, error) {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// GenerateKey creates a new inactive signing key for the provided use.
+func (a *Auth) GenerateKey(use string) (*SigningKey, error) {
+	if !validKeyUse(use) {
+		return nil, ErrInvalidKeyUse
+	}
+	secret, err := randomBytes(KeySize)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomBytes(KIDSize)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		KID:    hex.EncodeToString(kid),
+		Use:    use,
+		Secret: secret,
+	}
+	err = a.db.Create(key).Error
+	return key, err
+}
+
+// ActivateKey makes the key the one used to sign new tokens. Any other active
+// key with the same use is deactivated but still accepted for validation.
+func (a *Auth) ActivateKey(kid string) error {
+	key := a.findKey(kid)
+	if key == nil {
+		return ErrKeyNotFound
+	}
+	if key.Retired {
+		return ErrKeyRetired
+	}
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&SigningKey{}).Where("use = ? and active = ?", key.Use, true).
+			Update("active", false).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(key).Update("active", true).Error
+	})
+}
+
+// RetireKey ensures the key is no longer used to sign or validate tokens.
+// Tokens signed with a retired key are rejected.
+func (a *Auth) RetireKey(kid string) error {
+	key := a.findKey(kid)
+	if key == nil {
+		return ErrKeyNotFound
+	}
+	return a.db.Model(key).Updates(map[string]interface{}{
+		"active":  false,
+		"retired": true,
+	}).Error
+}
+
+// Keys returns all signing keys, including retired keys.
+func (a *Auth) Keys() []SigningKey {
+	var keys []SigningKey
+	a.db.Order("use, created_at").Find(&keys)
+	return keys
+}
+
+func (a *Auth) findKey(kid string) *SigningKey {
+	var key SigningKey
+	err := a.db.Where("k_id = ?", kid).First(&key).Error
+	if err != nil {
+		return nil
+	}
+	return &key
+}
+
+func (a *Auth) activeKey(use string) *SigningKey {
+	var key SigningKey
+	err := a.db.Where("use = ? and active = ? and retired = ?", use, true, false).
+		First(&key).Error
+	if err != nil {
+		return nil
+	}
+	return &key
+}
+
+// validationKey returns the secret to use for validating a token with the
+// provided key ID. Tokens without a key ID use the configured secret.
+func (a *Auth) validationKey(kid interface{}, use string) ([]byte, error) {
+	id, ok := kid.(string)
+	if !ok {
+		return nil, ErrInvalidTokenID
+	}
+	key := a.findKey(id)
+	if key == nil {
+		return nil, ErrKeyNotFound
+	}
+	if key.Use != use {
+		return nil, ErrInvalidKeyUse
+	}
+	if key.Retired {
+		return nil, ErrKeyRetired
+	}
+	return key.Secret, nil
+}
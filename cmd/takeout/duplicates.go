@@ -0,0 +1,83 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/defsub/takeout/music"
+	"github.com/spf13/cobra"
+)
+
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "report duplicate tracks",
+	Long:  `TODO`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return duplicates()
+	},
+}
+
+var duplicatesRecordings, duplicatesFiles bool
+
+func duplicates() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	m := music.NewMusic(cfg)
+	err = m.Open()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if duplicatesRecordings {
+		fmt.Println("# same recording")
+		printDuplicates(m.RecordingDuplicates())
+	}
+	if duplicatesFiles {
+		fmt.Println("# same audio file")
+		printDuplicates(m.FileDuplicates())
+	}
+	return nil
+}
+
+func printDuplicates(dups []music.Duplicate) {
+	for _, d := range dups {
+		p := d.Preferred()
+		fmt.Printf("%s - %s (%s)\n", p.Artist, p.Title, d.ID)
+		for i, t := range d.Tracks {
+			mark := " "
+			if i == 0 {
+				// preferred copy
+				mark = "*"
+			}
+			fmt.Printf(" %s %s [%s]\n", mark, t.Key, t.ReleaseTitle)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d duplicates\n\n", len(dups))
+}
+
+func init() {
+	duplicatesCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	duplicatesCmd.Flags().BoolVarP(&duplicatesRecordings, "recordings", "r", true, "group by MusicBrainz recording")
+	duplicatesCmd.Flags().BoolVarP(&duplicatesFiles, "files", "f", true, "group by audio file ETag and size")
+	rootCmd.AddCommand(duplicatesCmd)
+}
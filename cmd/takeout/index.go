@@ -0,0 +1,134 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/search"
+	"github.com/defsub/takeout/music"
+	"github.com/defsub/takeout/podcast"
+	"github.com/defsub/takeout/video"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:       "index rebuild|verify [music|video|podcast]",
+	Short:     "rebuild or verify search indexes",
+	Long:      `TODO`,
+	Args:      cobra.RangeArgs(1, 2),
+	ValidArgs: []string{"rebuild", "verify"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return index(args)
+	},
+}
+
+const (
+	indexRebuild = "rebuild"
+	indexVerify  = "verify"
+)
+
+var (
+	ErrIndexAction = errors.New("index action must be rebuild or verify")
+	ErrIndexMedia  = errors.New("index media must be music, video or podcast")
+)
+
+// indexer is implemented by each media type with a search index.
+type indexer interface {
+	Open() error
+	Close()
+	RebuildIndex(ctx context.Context) error
+	VerifyIndex() (*search.Report, error)
+}
+
+func index(args []string) error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	action := args[0]
+	if action != indexRebuild && action != indexVerify {
+		return ErrIndexAction
+	}
+	media := []string{"music", "video", "podcast"}
+	if len(args) > 1 {
+		media = args[1:]
+	}
+	for _, name := range media {
+		i, err := newIndexer(cfg, name)
+		if err != nil {
+			return err
+		}
+		err = indexMedia(i, name, action)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newIndexer(cfg *config.Config, name string) (indexer, error) {
+	switch name {
+	case "music":
+		return music.NewMusic(cfg), nil
+	case "video":
+		return video.NewVideo(cfg), nil
+	case "podcast":
+		return podcast.NewPodcast(cfg), nil
+	}
+	return nil, ErrIndexMedia
+}
+
+func indexMedia(i indexer, name, action string) error {
+	err := i.Open()
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+
+	if action == indexRebuild {
+		fmt.Printf("rebuilding %s index\n", name)
+		err = i.RebuildIndex(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := i.VerifyIndex()
+	if err != nil {
+		return err
+	}
+	for _, key := range report.Unresolved {
+		fmt.Printf("%s unresolved %s\n", name, key)
+	}
+	state := "current"
+	if report.Stale {
+		state = "stale"
+	}
+	fmt.Printf("%s index %s with %d documents, %d unresolved\n",
+		name, state, report.Documents, len(report.Unresolved))
+	return nil
+}
+
+func init() {
+	indexCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	rootCmd.AddCommand(indexCmd)
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/defsub/takeout/auth"
+	"github.com/spf13/cobra"
+)
+
+var inviteCmd = &cobra.Command{
+	Use:   "invite",
+	Short: "create user invite",
+	Long:  `TODO`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return invite()
+	},
+}
+
+var inviteMedia string
+var inviteUses int
+var inviteAge time.Duration
+
+func invite() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	a := auth.NewAuth(cfg)
+	err = a.Open()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	code, err := a.GenerateInvite(inviteMedia, inviteUses, inviteAge)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("/invite/%s (media %s, uses %d, expires %s)\n",
+		code.Value, code.Media, code.Uses, code.Expires.Format(time.RFC1123))
+	return nil
+}
+
+func init() {
+	inviteCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	inviteCmd.Flags().StringVarP(&inviteMedia, "media", "m", "", "media")
+	inviteCmd.Flags().IntVarP(&inviteUses, "uses", "n", 1, "number of uses")
+	inviteCmd.Flags().DurationVarP(&inviteAge, "expires", "e", 0, "expires after duration")
+	rootCmd.AddCommand(inviteCmd)
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/defsub/takeout/auth"
+	"github.com/spf13/cobra"
+)
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "token signing key admin",
+	Long:  `TODO`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return key()
+	},
+}
+
+var keyGenerate, keyActivate, keyRetire string
+var keyList bool
+
+func key() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	a := auth.NewAuth(cfg)
+	err = a.Open()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	if keyGenerate != "" {
+		k, err := a.GenerateKey(keyGenerate)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("generated %s key %s\n", k.Use, k.KID)
+	}
+
+	if keyActivate != "" {
+		err := a.ActivateKey(keyActivate)
+		if err != nil {
+			return err
+		}
+	}
+
+	if keyRetire != "" {
+		err := a.RetireKey(keyRetire)
+		if err != nil {
+			return err
+		}
+	}
+
+	if keyList {
+		for _, k := range a.Keys() {
+			state := "inactive"
+			if k.Retired {
+				state = "retired"
+			} else if k.Active {
+				state = "active"
+			}
+			fmt.Printf("%-8s %s %-8s %s\n", k.Use, k.KID, state,
+				k.CreatedAt.Format("2006-01-02"))
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	keyCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	keyCmd.Flags().StringVarP(&keyGenerate, "generate", "g", "", "generate key (access, media or code)")
+	keyCmd.Flags().StringVarP(&keyActivate, "activate", "a", "", "activate key id")
+	keyCmd.Flags().StringVarP(&keyRetire, "retire", "r", "", "retire key id")
+	keyCmd.Flags().BoolVarP(&keyList, "list", "l", false, "list keys")
+	rootCmd.AddCommand(keyCmd)
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/defsub/takeout/music"
+	"github.com/spf13/cobra"
+)
+
+var pinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "pin folders to releases",
+	Long:  `TODO`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pin()
+	},
+}
+
+var pinPath, pinREID, pinRGID string
+var pinRemove int
+var pinList bool
+
+func pin() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	m := music.NewMusic(cfg)
+	err = m.Open()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if pinRemove != 0 {
+		err := m.Unpin(pinRemove)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pinPath != "" {
+		if pinREID == "" && pinRGID == "" {
+			pinREID, err = pickRelease(m, pinPath)
+			if err != nil || pinREID == "" {
+				return err
+			}
+		}
+		p, err := m.PinFolder(pinPath, pinREID, pinRGID)
+		if err != nil {
+			return err
+		}
+		r, err := m.SyncPin(context.Background(), *p)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("pinned %s to %s (%s)\n", p.Path, r.Name, r.REID)
+	}
+
+	if pinList {
+		for _, p := range m.Pins() {
+			id := p.REID
+			if id == "" {
+				id = "rg " + p.RGID
+			}
+			fmt.Printf("%-4d %s -> %s\n", p.ID, p.Path, id)
+		}
+	}
+
+	return nil
+}
+
+// pickRelease shows the candidate releases for the folder and reads the
+// choice from stdin.
+func pickRelease(m *music.Music, path string) (string, error) {
+	releases, err := m.ReleaseChoices(path)
+	if err != nil {
+		return "", err
+	}
+	if len(releases) == 0 {
+		fmt.Printf("no candidate releases, use --reid or --rgid\n")
+		return "", nil
+	}
+	printReleases(releases)
+	r, err := readRelease(releases)
+	if err != nil || r == nil {
+		fmt.Printf("nothing pinned\n")
+		return "", err
+	}
+	return r.REID, nil
+}
+
+func printReleases(releases []music.Release) {
+	for i, r := range releases {
+		fmt.Printf("%2d) %s", i+1, r.Name)
+		if r.Disambiguation != "" {
+			fmt.Printf(" (%s)", r.Disambiguation)
+		}
+		fmt.Printf(" %s %s %s, %d tracks, %d discs\n    %s\n",
+			r.Country, r.ReleaseDate.Format("2006-01-02"), r.Status,
+			r.TrackCount, r.DiscCount, r.REID)
+	}
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readRelease reads the release choice from stdin. The result is nil when
+// nothing valid was chosen.
+func readRelease(releases []music.Release) (*music.Release, error) {
+	fmt.Printf("pick a release (1-%d): ", len(releases))
+	line, err := stdin.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(releases) {
+		return nil, nil
+	}
+	return &releases[n-1], nil
+}
+
+func init() {
+	pinCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	pinCmd.Flags().StringVarP(&pinPath, "path", "p", "", "bucket folder, like \"Artist/Release (1999)\"")
+	pinCmd.Flags().StringVarP(&pinREID, "reid", "r", "", "MusicBrainz release ID")
+	pinCmd.Flags().StringVarP(&pinRGID, "rgid", "g", "", "MusicBrainz release group ID")
+	pinCmd.Flags().IntVarP(&pinRemove, "remove", "d", 0, "remove pin id")
+	pinCmd.Flags().BoolVarP(&pinList, "list", "l", false, "list pins")
+	rootCmd.AddCommand(pinCmd)
+}
@@ -18,6 +18,7 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/defsub/takeout/config"
@@ -97,8 +98,7 @@ func syncMusic(cfg *config.Config) error {
 	if resolve {
 		syncOptions.Resolve = true
 	}
-	m.Sync(syncOptions)
-	return nil
+	return m.Sync(context.Background(), syncOptions)
 }
 
 func syncVideo(cfg *config.Config) error {
@@ -108,8 +108,7 @@ func syncVideo(cfg *config.Config) error {
 		return err
 	}
 	defer v.Close()
-	v.SyncSince(since(v.LastModified()))
-	return nil
+	return v.SyncSince(context.Background(), since(v.LastModified()))
 }
 
 func syncPodcast(cfg *config.Config) error {
@@ -119,8 +118,7 @@ func syncPodcast(cfg *config.Config) error {
 		return err
 	}
 	defer p.Close()
-	p.Sync()
-	return nil
+	return p.Sync(context.Background())
 }
 
 func init() {
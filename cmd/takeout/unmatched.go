@@ -0,0 +1,123 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/defsub/takeout/music"
+	"github.com/spf13/cobra"
+)
+
+var unmatchedCmd = &cobra.Command{
+	Use:   "unmatched",
+	Short: "triage tracks without a release",
+	Long:  `TODO`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return unmatched()
+	},
+}
+
+var ErrMatchPath = errors.New("--reid requires --path")
+
+var unmatchedPath, unmatchedREID string
+var unmatchedList bool
+
+func unmatched() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	m := music.NewMusic(cfg)
+	err = m.Open()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if unmatchedREID != "" {
+		if unmatchedPath == "" {
+			return ErrMatchPath
+		}
+		return matchFolder(m, unmatchedPath, unmatchedREID)
+	}
+
+	var folders []music.UnmatchedFolder
+	if unmatchedPath != "" {
+		f, err := m.UnmatchedFolder(unmatchedPath)
+		if err != nil {
+			return err
+		}
+		folders = append(folders, *f)
+	} else {
+		folders = m.UnmatchedFolders()
+	}
+
+	for _, f := range folders {
+		fmt.Printf("%s\n", f.Path)
+		fmt.Printf("  artist %s, release %s, %d tracks, %d discs\n",
+			f.Artist, f.Release, f.TrackCount, f.DiscCount)
+		fmt.Printf("  reason: %s\n", f.Reason)
+		for _, t := range f.Tracks {
+			fmt.Printf("  %d-%02d %s\n", t.DiscNum, t.TrackNum, t.Title)
+		}
+		if len(f.Candidates) == 0 {
+			fmt.Println()
+			continue
+		}
+		printReleases(f.Candidates)
+		if unmatchedList {
+			fmt.Println()
+			continue
+		}
+		r, err := readRelease(f.Candidates)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if r != nil {
+			err = matchFolder(m, f.Path, r.REID)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func matchFolder(m *music.Music, path, reid string) error {
+	r, err := m.MatchFolder(context.Background(), path, reid)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("matched %s to %s (%s)\n", path, r.Name, r.REID)
+	return nil
+}
+
+func init() {
+	unmatchedCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	unmatchedCmd.Flags().StringVarP(&unmatchedPath, "path", "p", "", "bucket folder, like \"Artist/Release (1999)\"")
+	unmatchedCmd.Flags().StringVarP(&unmatchedREID, "reid", "r", "", "MusicBrainz release ID for --path")
+	unmatchedCmd.Flags().BoolVarP(&unmatchedList, "list", "l", false, "list without prompting")
+	rootCmd.AddCommand(unmatchedCmd)
+}
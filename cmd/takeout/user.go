@@ -27,12 +27,13 @@ var userCmd = &cobra.Command{
 	Short: "user admin",
 	Long:  `TODO`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		assignAdmin = cmd.Flags().Changed("admin")
 		return doit()
 	},
 }
 
 var user, pass, media string
-var add, change bool
+var add, change, admin, assignAdmin bool
 
 func doit() error {
 	cfg, err := getConfig()
@@ -67,6 +68,13 @@ func doit() error {
 		}
 	}
 
+	if user != "" && assignAdmin {
+		err := a.AssignAdmin(user, admin)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -77,5 +85,6 @@ func init() {
 	userCmd.Flags().StringVarP(&media, "media", "m", "", "media")
 	userCmd.Flags().BoolVarP(&add, "add", "a", false, "add")
 	userCmd.Flags().BoolVarP(&change, "change", "n", false, "change")
+	userCmd.Flags().BoolVar(&admin, "admin", false, "admin")
 	rootCmd.AddCommand(userCmd)
 }
@@ -18,7 +18,14 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/defsub/takeout/activity"
+	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/date"
 	"github.com/defsub/takeout/music"
 	"github.com/spf13/cobra"
 )
@@ -32,35 +39,98 @@ var wantCmd = &cobra.Command{
 	},
 }
 
+var (
+	ErrWantFormat = errors.New("format must be md, csv or json")
+	ErrWantDate   = errors.New("dates must be YYYY, YYYY-MM or YYYY-MM-DD")
+	ErrWantUser   = errors.New("--played requires --user")
+)
+
+var wantArtists []string
+var wantTypes, wantAfter, wantBefore, wantUser, wantFormat string
+var wantOfficial bool
+var wantPlayed time.Duration
+var wantOffset, wantLimit int
+
+func wantFilter(cfg *config.Config) (music.WantFilter, error) {
+	f := music.NewWantFilter()
+	f.Artists = wantArtists
+	types, err := music.ParseWantTypes(wantTypes)
+	if err != nil {
+		return f, err
+	}
+	f.Types = types
+	if wantAfter != "" {
+		f.After = date.ParseDate(wantAfter)
+		if f.After.IsZero() {
+			return f, ErrWantDate
+		}
+	}
+	if wantBefore != "" {
+		f.Before = date.ParseDate(wantBefore)
+		if f.Before.IsZero() {
+			return f, ErrWantDate
+		}
+	}
+	f.Official = wantOfficial
+	if wantPlayed > 0 {
+		if wantUser == "" {
+			return f, ErrWantUser
+		}
+		a := activity.NewActivity(cfg)
+		err := a.Open()
+		if err != nil {
+			return f, err
+		}
+		defer a.Close()
+		f.Played = a.UserReleaseGroupPlays(wantUser, time.Now().Add(-wantPlayed))
+	}
+	f.Offset = wantOffset
+	f.Limit = wantLimit
+	return f, nil
+}
+
 func want() error {
 	cfg, err := getConfig()
 	if err != nil {
 		return err
 	}
+	switch wantFormat {
+	case "md", "csv", "json":
+	default:
+		return ErrWantFormat
+	}
+	filter, err := wantFilter(cfg)
+	if err != nil {
+		return err
+	}
 	m := music.NewMusic(cfg)
 	err = m.Open()
 	if err != nil {
 		return err
 	}
 	defer m.Close()
-	list := m.WantList()
-	fmt.Println("# Takeout: Wantlist")
-	var prevArtist string
-	for _, r := range list {
-		var disamb = ""
-		if r.Disambiguation != "" {
-			disamb = fmt.Sprintf(" (%s)", r.Disambiguation)
-		}
-		if r.Artist != prevArtist {
-			fmt.Printf("## %s\n", r.Artist)
-		}
-		fmt.Printf("- %04d [%s%s](https://musicbrainz.org/release-group/%s)\n", r.Date.Year(), r.Name, disamb, r.REID)
-		prevArtist = r.Artist
+	list, _ := m.WantReleases(filter)
+	switch wantFormat {
+	case "md":
+		return music.WriteWantMarkdown(os.Stdout, list)
+	case "csv":
+		return music.WriteWantCSV(os.Stdout, list)
+	default:
+		return json.NewEncoder(os.Stdout).Encode(list)
 	}
-	return nil
 }
 
 func init() {
 	wantCmd.Flags().StringVarP(&configFile, "config", "c", "", "config file")
+	wantCmd.Flags().StringArrayVarP(&wantArtists, "artist", "a", nil, "only releases by artist (repeatable)")
+	wantCmd.Flags().StringVarP(&wantTypes, "type", "t", music.WantAlbum, "release types: album, ep, single, live")
+	wantCmd.Flags().StringVar(&wantAfter, "after", "", "first released on or after date")
+	wantCmd.Flags().StringVar(&wantBefore, "before", "", "first released before date")
+	wantCmd.Flags().BoolVar(&wantOfficial, "official", true, "only official releases")
+	wantCmd.Flags().DurationVarP(&wantPlayed, "played", "p", 0, "only artists played by --user within duration")
+	wantCmd.Flags().StringVarP(&wantUser, "user", "u", "", "user for --played")
+	wantCmd.Flags().IntVar(&wantOffset, "offset", 0, "skip releases")
+	wantCmd.Flags().IntVarP(&wantLimit, "limit", "l", 0, "maximum releases, 0 for all")
+	wantCmd.Flags().StringVarP(&wantFormat, "format", "f", "md", "output format: md, csv or json")
 	rootCmd.AddCommand(wantCmd)
 }
@@ -125,31 +125,47 @@ type RadioStream struct {
 }
 
 type MusicConfig struct {
-	ArtistFile           string
-	ArtistRadioBreadth   int
-	ArtistRadioDepth     int
-	DB                   DatabaseConfig
-	DeepLimit            int
-	PopularLimit         int
-	RadioGenres          []string
-	RadioLimit           int
-	RadioOther           map[string]string
-	RadioSearchLimit     int
-	RadioSeries          []string
-	RadioStreams         []RadioStream
-	Recent               time.Duration
-	RecentLimit          int
-	ReleaseCountries     []string
-	SearchLimit          int
-	SimilarArtistsLimit  int
-	SimilarReleases      time.Duration
-	SimilarReleasesLimit int
-	SinglesLimit         int
-	artistMap            map[string]string
-	SyncInterval         time.Duration
-	PopularSyncInterval  time.Duration
-	SimilarSyncInterval  time.Duration
-	CoverSyncInterval    time.Duration
+	ArtistFile             string
+	ArtistRadioBreadth     int
+	ArtistRadioDepth       int
+	CatalogLimit           int
+	ClassicalGenres        []string
+	ComposerArtist         bool
+	DB                     DatabaseConfig
+	DeepLimit              int
+	NewReleaseActivity     bool
+	NewReleaseLimit        int
+	NewReleaseTypes        []string
+	NewReleaseWindow       time.Duration
+	Fingerprint            bool
+	PopularLimit           int
+	PreferredFormats       []string
+	PreferLocalArtwork     bool
+	ProxyLocalArtwork      bool
+	RadioGenres            []string
+	RadioLimit             int
+	RadioOther             map[string]string
+	RadioSearchLimit       int
+	RadioSeries            []string
+	RadioStreams           []RadioStream
+	Recent                 time.Duration
+	RecentLimit            int
+	ReleaseCountries       []string
+	SearchLimit            int
+	SimilarArtistsLimit    int
+	SimilarReleases        time.Duration
+	SimilarReleasesLimit   int
+	SinglesLimit           int
+	artistMap              map[string]string
+	SyncInterval           time.Duration
+	SyncWorkers            int
+	WantListLimit          int
+	PopularSyncInterval    time.Duration
+	SimilarSyncInterval    time.Duration
+	CoverSyncInterval      time.Duration
+	FanArtSyncInterval     time.Duration
+	AnalysisSyncInterval   time.Duration
+	NewReleaseSyncInterval time.Duration
 }
 
 type VideoConfig struct {
@@ -162,8 +178,10 @@ type VideoConfig struct {
 	SearchLimit          int
 	Recommend            RecommendConfig
 	SyncInterval         time.Duration
+	SyncWorkers          int
 	PosterSyncInterval   time.Duration
 	BackdropSyncInterval time.Duration
+	ProfileSyncInterval  time.Duration
 }
 
 type PodcastConfig struct {
@@ -180,6 +198,12 @@ type ProgressConfig struct {
 	DB DatabaseConfig
 }
 
+type JobsConfig struct {
+	DB           DatabaseConfig
+	HistoryLimit int
+	Schedules    map[string]string
+}
+
 type ActivityConfig struct {
 	DB                 DatabaseConfig
 	ActivityLimit      int
@@ -218,29 +242,57 @@ type TMDBAPIConfig struct {
 	FileTemplate Template
 }
 
-type SetlistAPIConfig struct {
+type AcoustIDAPIConfig struct {
 	ApiKey string
+	URL    string // AcoustID compatible lookup service
+	Fpcalc string // Chromaprint fpcalc command
+}
+
+type AnalysisConfig struct {
+	Ffmpeg  string // ffmpeg command
+	Ffprobe string // ffprobe command
+}
+
+type SetlistAPIConfig struct {
+	ApiKey     string
+	SearchTTL  time.Duration // refetch current year and tour searches after
+	TourRecent time.Duration // tours with concerts this recent are current
 }
 
 type TokenConfig struct {
-	Issuer     string
-	Age        time.Duration
-	Secret     string
-	SecretFile string
+	Issuer       string
+	Age          time.Duration
+	Secret       string
+	SecretFile   string
+	RetireSecret bool // only accept tokens signed with a key
+}
+
+// ProxyConfig enables authentication by a trusted reverse proxy which
+// identifies the user with a request header.
+type ProxyConfig struct {
+	Enabled        bool
+	Header         string
+	TrustedProxies []string // CIDRs
+	AutoCreate     bool
+	Media          string // media for auto created users
 }
 
 type AuthConfig struct {
 	DB            DatabaseConfig
 	SessionAge    time.Duration
 	CodeAge       time.Duration
+	InviteAge     time.Duration
 	SecureCookies bool
 	AccessToken   TokenConfig
 	MediaToken    TokenConfig
 	CodeToken     TokenConfig
+	Proxy         ProxyConfig
 }
 
 type SearchConfig struct {
-	BleveDir string
+	BleveDir     string
+	Stemming     bool
+	SuggestLimit int
 }
 
 type ServerConfig struct {
@@ -250,11 +302,18 @@ type ServerConfig struct {
 	ImageClient ClientConfig
 }
 
+type RateLimitConfig struct {
+	Host  string
+	Rate  float64 // requests per second
+	Burst int
+}
+
 type ClientConfig struct {
-	CacheDir  string
-	MaxAge    time.Duration
-	UseCache  bool
-	UserAgent string
+	CacheDir   string
+	MaxAge     time.Duration
+	UseCache   bool
+	UserAgent  string
+	RateLimits []RateLimitConfig // process-wide, first client config wins
 }
 
 func (c *ClientConfig) Merge(o ClientConfig) {
@@ -269,6 +328,8 @@ func (c *ClientConfig) Merge(o ClientConfig) {
 }
 
 type Config struct {
+	AcoustID  AcoustIDAPIConfig
+	Analysis  AnalysisConfig
 	Auth      AuthConfig
 	Buckets   []BucketConfig
 	Client    ClientConfig
@@ -278,11 +339,13 @@ type Config struct {
 	TMDB      TMDBAPIConfig
 	Search    SearchConfig
 	Server    ServerConfig
+	Setlist   SetlistAPIConfig
 	Video     VideoConfig
 	Assistant AssistantConfig
 	Podcast   PodcastConfig
 	Progress  ProgressConfig
 	Activity  ActivityConfig
+	Jobs      JobsConfig
 }
 
 func (mc *MusicConfig) UserArtistID(name string) (string, bool) {
@@ -318,6 +381,10 @@ func configDefaults(v *viper.Viper) {
 	v.SetDefault("Auth.DB.Source", "${Server.DataDir}/auth.db")
 	v.SetDefault("Auth.SessionAge", "720h") // 30 days
 	v.SetDefault("Auth.CodeAge", "5m")
+	v.SetDefault("Auth.InviteAge", "168h") // 7 days
+	v.SetDefault("Auth.Proxy.Enabled", "false")
+	v.SetDefault("Auth.Proxy.Header", "Remote-User")
+	v.SetDefault("Auth.Proxy.AutoCreate", "false")
 	v.SetDefault("Auth.SecureCookies", "true")
 	v.SetDefault("Auth.AccessToken.Age", "4h")
 	v.SetDefault("Auth.AccessToken.Issuer", "takeout")
@@ -331,11 +398,19 @@ func configDefaults(v *viper.Viper) {
 	v.SetDefault("Auth.CodeToken.Issuer", "takeout")
 	v.SetDefault("Auth.CodeToken.Secret", "")     // must be assigned in config file
 	v.SetDefault("Auth.CodeToken.SecretFile", "") // must be assigned in config file
+	v.SetDefault("Auth.AccessToken.RetireSecret", "false")
+	v.SetDefault("Auth.MediaToken.RetireSecret", "false")
+	v.SetDefault("Auth.CodeToken.RetireSecret", "false")
 
 	v.SetDefault("Progress.DB.Driver", "sqlite3")
 	v.SetDefault("Progress.DB.Source", "${Server.DataDir}/progress.db")
 	v.SetDefault("Progress.DB.Logger", "default")
 
+	v.SetDefault("Jobs.DB.Driver", "sqlite3")
+	v.SetDefault("Jobs.DB.Source", "${Server.DataDir}/jobs.db")
+	v.SetDefault("Jobs.DB.Logger", "default")
+	v.SetDefault("Jobs.HistoryLimit", "20")
+
 	v.SetDefault("Activity.DB.Driver", "sqlite3")
 	v.SetDefault("Activity.DB.Source", "${Server.DataDir}/activity.db")
 	v.SetDefault("Activity.DB.Logger", "default")
@@ -361,10 +436,25 @@ func configDefaults(v *viper.Viper) {
 	v.SetDefault("LastFM.Key", "")
 	v.SetDefault("LastFM.Secret", "")
 
+	v.SetDefault("Setlist.ApiKey", "")
+	v.SetDefault("Setlist.SearchTTL", "24h")
+	v.SetDefault("Setlist.TourRecent", "2160h") // 90 days
+
+	v.SetDefault("AcoustID.ApiKey", "")
+	v.SetDefault("AcoustID.URL", "https://api.acoustid.org/v2/lookup")
+	v.SetDefault("AcoustID.Fpcalc", "fpcalc")
+
+	v.SetDefault("Analysis.Ffmpeg", "ffmpeg")
+	v.SetDefault("Analysis.Ffprobe", "ffprobe")
+
 	v.SetDefault("Music.ArtistRadioBreadth", "10")
 	v.SetDefault("Music.ArtistRadioDepth", "3")
+	v.SetDefault("Music.CatalogLimit", "500")
 	v.SetDefault("Music.DeepLimit", "50")
+	v.SetDefault("Music.Fingerprint", "false")
 	v.SetDefault("Music.PopularLimit", "50")
+	v.SetDefault("Music.PreferLocalArtwork", "false")
+	v.SetDefault("Music.ProxyLocalArtwork", "false")
 	v.SetDefault("Music.RadioLimit", "25")
 	v.SetDefault("Music.RadioSearchLimit", "1000")
 	v.SetDefault("Music.RadioStreams", []RadioStream{
@@ -407,9 +497,35 @@ func configDefaults(v *viper.Viper) {
 	v.SetDefault("Music.SimilarReleasesLimit", "10")
 	v.SetDefault("Music.SinglesLimit", "50")
 	v.SetDefault("Music.SyncInterval", "1h")
+	v.SetDefault("Music.SyncWorkers", 4)
+	v.SetDefault("Music.WantListLimit", "100")
 	v.SetDefault("Music.PopularSyncInterval", "24h")
 	v.SetDefault("Music.SimilarSyncInterval", "24h")
 	v.SetDefault("Music.CoverSyncInterval", "24h")
+	v.SetDefault("Music.FanArtSyncInterval", "24h")
+	v.SetDefault("Music.AnalysisSyncInterval", "0")
+	v.SetDefault("Music.ComposerArtist", "false")
+	v.SetDefault("Music.NewReleaseActivity", "false")
+	v.SetDefault("Music.NewReleaseLimit", "50")
+	v.SetDefault("Music.NewReleaseSyncInterval", "24h")
+	v.SetDefault("Music.NewReleaseTypes", []string{"Album", "EP"})
+	v.SetDefault("Music.NewReleaseWindow", "2160h") // 90 days
+	v.SetDefault("Music.PreferredFormats", []string{
+		"flac",
+		"wav",
+		"m4a",
+		"ogg",
+		"opus",
+		"mp3",
+	})
+	v.SetDefault("Music.ClassicalGenres", []string{
+		"baroque",
+		"chamber music",
+		"classical",
+		"contemporary classical",
+		"opera",
+		"romantic classical",
+	})
 
 	// see https://wiki.musicbrainz.org/Release_Country
 	// v.SetDefault("Music.ReleaseCountries", []string{
@@ -428,6 +544,8 @@ func configDefaults(v *viper.Viper) {
 		"{{.Title}} ({{.Year}}){{if .Definition}} - {{.Definition}}{{end}}{{.Extension}}")
 
 	v.SetDefault("Search.BleveDir", ".")
+	v.SetDefault("Search.Stemming", false)
+	v.SetDefault("Search.SuggestLimit", "10")
 
 	v.SetDefault("Video.DB.Driver", "sqlite3")
 	v.SetDefault("Video.DB.Source", "video.db")
@@ -448,8 +566,10 @@ func configDefaults(v *viper.Viper) {
 	v.SetDefault("Video.RecentLimit", "50")
 	v.SetDefault("Video.SearchLimit", "100")
 	v.SetDefault("Video.SyncInterval", "1h")
+	v.SetDefault("Video.SyncWorkers", 4)
 	v.SetDefault("Video.PosterSyncInterval", "24h")
 	v.SetDefault("Video.BackdropSyncInterval", "24h")
+	v.SetDefault("Video.ProfileSyncInterval", "24h")
 	v.SetDefault("Video.Recommend.When", []DateRecommend{
 		// day of week + day of month
 		{Match: "Fri 13", Layout: "Mon 02", Name: "Friday 13th Movies", Query: `+character:voorhees`},
@@ -0,0 +1,89 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package jobs
+
+import (
+	"errors"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func (j *Jobs) openDB() (err error) {
+	cfg := j.config.Jobs.DB.GormConfig()
+
+	if j.config.Jobs.DB.Driver == "sqlite3" {
+		j.db, err = gorm.Open(sqlite.Open(j.config.Jobs.DB.Source), cfg)
+	} else {
+		err = errors.New("driver not supported")
+	}
+
+	if err != nil {
+		return
+	}
+
+	j.db.AutoMigrate(&Run{})
+	return
+}
+
+func (j *Jobs) closeDB() {
+	conn, err := j.db.DB()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+func (j *Jobs) createRun(r *Run) error {
+	return j.db.Create(r).Error
+}
+
+func (j *Jobs) updateRun(r *Run) error {
+	return j.db.Save(r).Error
+}
+
+func (j *Jobs) runningRuns() []Run {
+	var list []Run
+	j.db.Where("state = ?", StateRunning).Find(&list)
+	return list
+}
+
+func (j *Jobs) interruptRun(r *Run) error {
+	return j.db.Model(r).Update("state", StateInterrupted).Error
+}
+
+func (j *Jobs) runs(name string, limit int) []Run {
+	var list []Run
+	j.db.Where("name = ?", name).
+		Order("started desc").Limit(limit).Find(&list)
+	return list
+}
+
+func (j *Jobs) pruneRuns(name string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	var ids []uint
+	j.db.Model(&Run{}).Where("name = ?", name).
+		Order("started desc").Limit(keep).Pluck("id", &ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return j.db.Unscoped().Where("name = ? and id not in ?", name, ids).
+		Delete(&Run{}).Error
+}
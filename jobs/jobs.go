@@ -0,0 +1,322 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package jobs keeps a history of job runs such as media sync, including
+// progress counts and errors, so recent runs can be reviewed after they
+// finish.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/log"
+	"gorm.io/gorm"
+)
+
+const (
+	StateRunning     = "running"
+	StateDone        = "done"
+	StateFailed      = "failed"
+	StateCanceled    = "canceled"
+	StateInterrupted = "interrupted"
+)
+
+var (
+	ErrJobRunning    = errors.New("job already running")
+	ErrJobNotRunning = errors.New("job not running")
+	ErrJobConflict   = errors.New("conflicting job running")
+)
+
+// Func is the work done by a job. Progress is reported using the lib/job
+// functions with the provided context, and work should stop when the
+// context is canceled.
+type Func func(ctx context.Context) error
+
+type Jobs struct {
+	config  *config.Config
+	host    string
+	pid     int
+	db      *gorm.DB
+	mu      sync.Mutex
+	done    *sync.Cond
+	running map[string]*running
+}
+
+type running struct {
+	run       *Run
+	tracker   *job.Tracker
+	cancel    context.CancelFunc
+	resources []string
+}
+
+func NewJobs(config *config.Config) *Jobs {
+	host, _ := os.Hostname()
+	j := &Jobs{
+		config:  config,
+		host:    host,
+		pid:     os.Getpid(),
+		running: make(map[string]*running),
+	}
+	j.done = sync.NewCond(&j.mu)
+	return j
+}
+
+// Open opens the job history. Runs left running by a process on this host
+// that has exited, such as after a crash or restart, are marked as
+// interrupted.
+func (j *Jobs) Open() (err error) {
+	err = j.openDB()
+	if err != nil {
+		return
+	}
+	for _, run := range j.runningRuns() {
+		if j.stale(run) {
+			err = j.interruptRun(&run)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (j *Jobs) Close() {
+	j.closeDB()
+}
+
+// Run runs the named job and waits for it to finish. The run is recorded in
+// the job history. ErrJobRunning is returned if the job is already running.
+// Jobs using any of the same resources, such as a media database and index,
+// don't run together so Run first waits for conflicting jobs in this process
+// to finish. ErrJobConflict is returned if a conflicting job is running in
+// another process, such as the server.
+func (j *Jobs) Run(name string, resources []string, fn Func) error {
+	r, ctx, err := j.start(name, resources, true)
+	if err != nil {
+		return err
+	}
+	return j.finish(r, fn(ctx))
+}
+
+// Start runs the named job in the background. ErrJobConflict is returned
+// if a job using any of the same resources is running.
+func (j *Jobs) Start(name string, resources []string, fn Func) error {
+	r, ctx, err := j.start(name, resources, false)
+	if err != nil {
+		return err
+	}
+	go func() {
+		j.finish(r, fn(ctx))
+	}()
+	return nil
+}
+
+// Cancel requests that the named job stop. The job will finish with the
+// canceled state once the work in progress is done.
+func (j *Jobs) Cancel(name string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.running[name]
+	if !ok {
+		return ErrJobNotRunning
+	}
+	r.cancel()
+	return nil
+}
+
+// Running returns true if the named job is running.
+func (j *Jobs) Running(name string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.running[name]
+	return ok
+}
+
+// Current returns the run for the named job with current progress if
+// running, otherwise the last recorded run or nil.
+func (j *Jobs) Current(name string) *Run {
+	j.mu.Lock()
+	r, ok := j.running[name]
+	if ok {
+		run := *r.run
+		run.update(r.tracker.Counts())
+		j.mu.Unlock()
+		return &run
+	}
+	j.mu.Unlock()
+	list := j.runs(name, 1)
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[0]
+}
+
+// History returns recent runs for the named job, newest first.
+func (j *Jobs) History(name string) []Run {
+	return j.runs(name, j.config.Jobs.HistoryLimit)
+}
+
+// conflict returns ErrJobRunning if the named job is running or
+// ErrJobConflict if another running job uses any of the resources.
+func (j *Jobs) conflict(name string, resources []string) error {
+	if _, ok := j.running[name]; ok {
+		return ErrJobRunning
+	}
+	for _, r := range j.running {
+		for _, a := range r.resources {
+			for _, b := range resources {
+				if a == b {
+					return ErrJobConflict
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// otherConflict is like conflict for runs recorded by other processes
+// sharing the job history. Stale runs are ignored.
+func (j *Jobs) otherConflict(name string, resources []string) error {
+	for _, run := range j.runningRuns() {
+		if j.owned(run) || j.stale(run) {
+			continue
+		}
+		if run.Name == name {
+			return ErrJobRunning
+		}
+		for _, a := range run.resources() {
+			for _, b := range resources {
+				if a == b {
+					return ErrJobConflict
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// owned is true if the run was started by this process.
+func (j *Jobs) owned(run Run) bool {
+	for _, r := range j.running {
+		if r.run.ID == run.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// stale is true if the run was left running by a process on this host that
+// is no longer running it. Runs from other hosts are never stale.
+func (j *Jobs) stale(run Run) bool {
+	if run.Host != j.host {
+		return false
+	}
+	if run.PID == j.pid {
+		return !j.owned(run)
+	}
+	return !processAlive(run.PID)
+}
+
+// processAlive checks if the process exists using signal 0.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+func (j *Jobs) start(name string, resources []string, wait bool) (*running, context.Context, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.conflict(name, resources)
+	for wait && errors.Is(err, ErrJobConflict) {
+		j.done.Wait()
+		err = j.conflict(name, resources)
+	}
+	if err == nil {
+		err = j.otherConflict(name, resources)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	run := &Run{
+		Name:      name,
+		State:     StateRunning,
+		Started:   time.Now(),
+		Resources: strings.Join(resources, ","),
+		Host:      j.host,
+		PID:       j.pid,
+	}
+	err = j.createRun(run)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracker := job.NewTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = job.WithTracker(ctx, tracker)
+	r := &running{run: run, tracker: tracker, cancel: cancel, resources: resources}
+	j.running[name] = r
+	return r, ctx, nil
+}
+
+func (j *Jobs) finish(r *running, err error) error {
+	j.mu.Lock()
+	delete(j.running, r.run.Name)
+	j.done.Broadcast()
+	j.mu.Unlock()
+
+	canceled := errors.Is(err, context.Canceled)
+	r.cancel()
+
+	run := r.run
+	run.update(r.tracker.Counts())
+	run.Finished = time.Now()
+	switch {
+	case canceled:
+		run.State = StateCanceled
+	case err != nil:
+		run.State = StateFailed
+		run.LastError = err.Error()
+	default:
+		run.State = StateDone
+	}
+	log.Printf("job %s %s\n", run.Name, run.State)
+
+	if err := j.updateRun(run); err != nil {
+		log.Println(err)
+	}
+	if err := j.pruneRuns(run.Name, j.config.Jobs.HistoryLimit); err != nil {
+		log.Println(err)
+	}
+	if canceled {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/defsub/takeout/config"
+)
+
+func testJobs(t *testing.T) *Jobs {
+	var c config.Config
+	c.Jobs.DB.Driver = "sqlite3"
+	c.Jobs.DB.Source = filepath.Join(t.TempDir(), "jobs.db")
+	c.Jobs.HistoryLimit = 10
+	j := NewJobs(&c)
+	if err := j.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(j.Close)
+	return j
+}
+
+// block returns a job func that runs until release is closed.
+func block(started chan<- string, name string, release <-chan struct{}) Func {
+	return func(ctx context.Context) error {
+		started <- name
+		<-release
+		return nil
+	}
+}
+
+func TestConflict(t *testing.T) {
+	j := testJobs(t)
+	started := make(chan string, 3)
+	release := make(chan struct{})
+
+	err := j.Start("music", []string{"music"}, block(started, "music", release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	err = j.Start("music", []string{"music"}, block(started, "music", release))
+	if !errors.Is(err, ErrJobRunning) {
+		t.Errorf("expected running got %v", err)
+	}
+	err = j.Start("media", []string{"music", "video"}, block(started, "media", release))
+	if !errors.Is(err, ErrJobConflict) {
+		t.Errorf("expected conflict got %v", err)
+	}
+
+	// other resources are ok
+	err = j.Start("podcasts", []string{"podcast"}, block(started, "podcasts", release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// run waits for the conflicting job to finish
+	done := make(chan error)
+	go func() {
+		done <- j.Run("analysis", []string{"music"}, func(ctx context.Context) error {
+			started <- "analysis"
+			return nil
+		})
+	}()
+	select {
+	case name := <-started:
+		t.Fatalf("%s started with music running", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if name := <-started; name != "analysis" {
+		t.Errorf("expected analysis got %s", name)
+	}
+	if j.Running("analysis") {
+		t.Errorf("analysis should be done")
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	j := testJobs(t)
+	runs := []Run{
+		{Name: "music", State: StateDone, Started: time.Now().Add(-time.Hour)},
+		// left running by this process before a restart
+		{Name: "music", State: StateRunning, Started: time.Now(),
+			Resources: "music", Host: j.host, PID: j.pid},
+		// running in another process, such as the server
+		{Name: "video", State: StateRunning, Started: time.Now(),
+			Resources: "video", Host: j.host, PID: os.Getppid()},
+		// running on another host
+		{Name: "podcasts", State: StateRunning, Started: time.Now(),
+			Resources: "podcast", Host: j.host + "-other", PID: j.pid},
+	}
+	for i := range runs {
+		if err := j.createRun(&runs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	// reopen as if restarted while music was running
+	j = NewJobs(j.config)
+	if err := j.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(j.Close)
+
+	history := j.History("music")
+	if len(history) != 2 ||
+		history[0].State != StateInterrupted || history[1].State != StateDone {
+		t.Errorf("unexpected history %+v", history)
+	}
+	if run := j.Current("music"); run == nil || run.State != StateInterrupted {
+		t.Errorf("unexpected current %+v", run)
+	}
+	for _, name := range []string{"video", "podcasts"} {
+		if run := j.Current(name); run == nil || run.State != StateRunning {
+			t.Errorf("%s should still be running, got %+v", name, run)
+		}
+	}
+
+	// runs in other processes conflict
+	noop := func(ctx context.Context) error { return nil }
+	if err := j.Run("video", []string{"video"}, noop); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("expected running got %v", err)
+	}
+	if err := j.Run("media", []string{"music", "podcast"}, noop); !errors.Is(err, ErrJobConflict) {
+		t.Errorf("expected conflict got %v", err)
+	}
+	if err := j.Run("music", []string{"music"}, noop); err != nil {
+		t.Errorf("interrupted run should not conflict, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package jobs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/defsub/takeout/lib/gorm"
+	"github.com/defsub/takeout/lib/job"
+)
+
+type Run struct {
+	gorm.Model
+	Name      string `gorm:"index:idx_run_name"`
+	State     string
+	Resources string // comma separated
+	Host      string // host and process running the job
+	PID       int
+	Started   time.Time
+	Finished  time.Time
+	Total     int
+	Done      int
+	Errors    int
+	LastError string
+}
+
+func (r *Run) resources() []string {
+	if r.Resources == "" {
+		return nil
+	}
+	return strings.Split(r.Resources, ",")
+}
+
+func (r *Run) update(counts job.Counts) {
+	r.Total = counts.Total
+	r.Done = counts.Done
+	r.Errors = counts.Errors
+	r.LastError = counts.LastError
+}
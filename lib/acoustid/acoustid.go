@@ -0,0 +1,131 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package acoustid calculates audio fingerprints using Chromaprint fpcalc and
+// looks up MusicBrainz recordings using AcoustID or a compatible service.
+package acoustid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+
+	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/client"
+)
+
+var (
+	ErrMissingKey = errors.New("acoustid api key not configured")
+	ErrLookup     = errors.New("acoustid lookup failed")
+)
+
+const (
+	DefaultURL = "https://api.acoustid.org/v2/lookup"
+)
+
+type AcoustID struct {
+	config *config.Config
+	client *client.Client
+}
+
+func NewAcoustID(config *config.Config, client *client.Client) *AcoustID {
+	return &AcoustID{
+		config: config,
+		client: client,
+	}
+}
+
+// Fingerprint is the fpcalc result. Duration is in seconds.
+type Fingerprint struct {
+	Duration    float64 `json:"duration"`
+	Fingerprint string  `json:"fingerprint"`
+}
+
+// Fingerprint runs fpcalc using audio streamed from r. fpcalc is killed if
+// the context is canceled.
+func (a *AcoustID) Fingerprint(ctx context.Context, r io.Reader) (*Fingerprint, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.config.AcoustID.Fpcalc, "-json", "-")
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("fpcalc: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("fpcalc: %w", err)
+	}
+	var fp Fingerprint
+	err = json.Unmarshal(stdout.Bytes(), &fp)
+	if err != nil {
+		return nil, err
+	}
+	return &fp, nil
+}
+
+type Release struct {
+	ID string `json:"id"`
+}
+
+type Recording struct {
+	ID       string    `json:"id"`
+	Releases []Release `json:"releases"`
+}
+
+type Result struct {
+	ID         string      `json:"id"`
+	Score      float64     `json:"score"`
+	Recordings []Recording `json:"recordings"`
+}
+
+type lookupResponse struct {
+	Status  string   `json:"status"`
+	Results []Result `json:"results"`
+}
+
+// Lookup returns the recordings matching the fingerprint, including the IDs
+// of the releases with each recording.
+func (a *AcoustID) Lookup(fp Fingerprint) ([]Result, error) {
+	endpoint := a.config.AcoustID.URL
+	if endpoint == "" {
+		endpoint = DefaultURL
+	}
+	if a.config.AcoustID.ApiKey == "" && endpoint == DefaultURL {
+		return nil, ErrMissingKey
+	}
+	params := url.Values{}
+	params.Set("client", a.config.AcoustID.ApiKey)
+	params.Set("meta", "recordings releaseids")
+	params.Set("duration", fmt.Sprintf("%d", int(fp.Duration)))
+	params.Set("fingerprint", fp.Fingerprint)
+
+	var result lookupResponse
+	err := a.client.GetJson(endpoint+"?"+params.Encode(), &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != "ok" {
+		return nil, ErrLookup
+	}
+	return result.Results, nil
+}
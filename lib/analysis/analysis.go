@@ -0,0 +1,340 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package analysis uses ffprobe and ffmpeg to read technical information
+// about audio, like the codec and sample rate, measure EBU R128 loudness for
+// ReplayGain, and estimate the tempo.
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/defsub/takeout/config"
+)
+
+var (
+	ErrNoAudio    = errors.New("no audio stream")
+	ErrNoLoudness = errors.New("loudness not found")
+)
+
+const (
+	// ReplayGain 2.0 reference level
+	ReferenceLoudness = -18.0
+
+	// audio used to estimate the tempo is mono 16-bit at this rate
+	tempoSampleRate = 11025
+	tempoHopSize    = 256
+	minBPM          = 60
+	maxBPM          = 200
+)
+
+type Analyzer struct {
+	config *config.Config
+}
+
+func NewAnalyzer(config *config.Config) *Analyzer {
+	return &Analyzer{config: config}
+}
+
+// Info is technical information about the audio stream. Bitrate is in bits
+// per second.
+type Info struct {
+	Codec      string
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Duration   float64 // seconds
+}
+
+// Result has the audio info along with the integrated loudness in LUFS, the
+// true peak in dBFS and the estimated tempo in beats per minute. Loudness is
+// zero for silence.
+type Result struct {
+	Info
+	Loudness float64
+	Peak     float64
+	BPM      float64
+}
+
+type probeResult struct {
+	Streams []struct {
+		CodecName        string `json:"codec_name"`
+		SampleRate       string `json:"sample_rate"`
+		Channels         int    `json:"channels"`
+		BitRate          string `json:"bit_rate"`
+		BitsPerRawSample string `json:"bits_per_raw_sample"`
+	} `json:"streams"`
+	Format struct {
+		BitRate  string `json:"bit_rate"`
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe runs ffprobe to read information about the first audio stream.
+func (a *Analyzer) Probe(ctx context.Context, location string) (*Info, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.config.Analysis.Ffprobe,
+		"-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", "-select_streams", "a:0",
+		location)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, commandErr("ffprobe", err, stderr.Bytes())
+	}
+	var result probeResult
+	err = json.Unmarshal(stdout.Bytes(), &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Streams) == 0 {
+		return nil, ErrNoAudio
+	}
+	s := result.Streams[0]
+	info := &Info{
+		Codec:      s.CodecName,
+		SampleRate: atoi(s.SampleRate),
+		Channels:   s.Channels,
+		Bitrate:    atoi(s.BitRate),
+		BitDepth:   atoi(s.BitsPerRawSample),
+	}
+	if info.Bitrate == 0 {
+		// lossless streams usually only have the overall bitrate
+		info.Bitrate = atoi(result.Format.BitRate)
+	}
+	info.Duration, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	return info, nil
+}
+
+// Analyze probes the audio and then streams it through ffmpeg once to measure
+// the loudness and estimate the tempo.
+func (a *Analyzer) Analyze(ctx context.Context, location string) (*Result, error) {
+	info, err := a.Probe(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.config.Analysis.Ffmpeg,
+		"-hide_banner", "-nostats", "-vn", "-i", location,
+		"-af", "ebur128=peak=true",
+		"-ac", "1", "-ar", strconv.Itoa(tempoSampleRate),
+		"-f", "s16le", "-")
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	envelope, readErr := onsetEnvelope(bufio.NewReader(stdout))
+	err = cmd.Wait()
+	if err != nil {
+		return nil, commandErr("ffmpeg", err, stderr.Bytes())
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	result := &Result{Info: *info}
+	result.Loudness, result.Peak, err = parseLoudness(stderr.String())
+	if err != nil && err != ErrNoLoudness {
+		return nil, err
+	}
+	result.BPM = tempo(envelope, float64(tempoSampleRate)/tempoHopSize)
+	return result, nil
+}
+
+// TrackGain is the ReplayGain in dB for audio with the integrated loudness in
+// LUFS.
+func TrackGain(loudness float64) float64 {
+	return round(ReferenceLoudness-loudness, 2)
+}
+
+// AlbumLoudness combines the loudness of each track weighted by the track
+// duration.
+func AlbumLoudness(loudness []float64, durations []float64) float64 {
+	var energy, total float64
+	for i, l := range loudness {
+		d := 1.0
+		if i < len(durations) && durations[i] > 0 {
+			d = durations[i]
+		}
+		energy += d * math.Pow(10, l/10)
+		total += d
+	}
+	if total == 0 {
+		return 0
+	}
+	return 10 * math.Log10(energy/total)
+}
+
+// PeakAmplitude converts a peak in dBFS to the linear amplitude used by
+// ReplayGain.
+func PeakAmplitude(dbfs float64) float64 {
+	return round(math.Pow(10, dbfs/20), 6)
+}
+
+var (
+	summaryRegexp  = regexp.MustCompile(`(?s)Summary:(.*)$`)
+	loudnessRegexp = regexp.MustCompile(`I:\s+(-?[\d.]+|-inf) LUFS`)
+	peakRegexp     = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf) dBFS`)
+)
+
+// parseLoudness finds the integrated loudness and true peak in the ebur128
+// summary.
+func parseLoudness(output string) (loudness, peak float64, err error) {
+	matches := summaryRegexp.FindStringSubmatch(output)
+	if matches == nil {
+		return 0, 0, ErrNoLoudness
+	}
+	summary := matches[1]
+	matches = loudnessRegexp.FindStringSubmatch(summary)
+	if matches == nil {
+		return 0, 0, ErrNoLoudness
+	}
+	loudness, err = strconv.ParseFloat(matches[1], 64)
+	if err != nil || math.IsInf(loudness, 0) {
+		// silence
+		return 0, 0, ErrNoLoudness
+	}
+	if matches = peakRegexp.FindStringSubmatch(summary); matches != nil {
+		peak, _ = strconv.ParseFloat(matches[1], 64)
+		if math.IsInf(peak, 0) {
+			peak = 0
+		}
+	}
+	return loudness, peak, nil
+}
+
+// onsetEnvelope reads mono 16-bit samples and returns the increase in log
+// energy for each hop.
+func onsetEnvelope(r io.Reader) ([]float64, error) {
+	var envelope []float64
+	samples := make([]int16, tempoHopSize)
+	prev := 0.0
+	for {
+		err := binary.Read(r, binary.LittleEndian, samples)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		energy := 0.0
+		for _, s := range samples {
+			v := float64(s) / 32768
+			energy += v * v
+		}
+		energy = math.Log1p(1000 * energy)
+		envelope = append(envelope, math.Max(0, energy-prev))
+		prev = energy
+	}
+	return envelope, nil
+}
+
+// tempo estimates the beats per minute using autocorrelation of the onset
+// envelope. Lags are weighted towards 120 BPM to avoid picking half or
+// double the tempo.
+func tempo(envelope []float64, rate float64) float64 {
+	minLag := int(rate * 60 / maxBPM)
+	maxLag := int(math.Ceil(rate * 60 / minBPM))
+	if len(envelope) < maxLag*4 {
+		return 0
+	}
+
+	// smooth onsets so beats between hops still correlate
+	kernel := []float64{1, 2, 3, 2, 1}
+	e := make([]float64, len(envelope))
+	mean := 0.0
+	for i := range envelope {
+		for k, w := range kernel {
+			if j := i + k - len(kernel)/2; j >= 0 && j < len(envelope) {
+				e[i] += w * envelope[j]
+			}
+		}
+		mean += e[i]
+	}
+	mean /= float64(len(e))
+	for i := range e {
+		e[i] -= mean
+	}
+
+	corr := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		sum := 0.0
+		for i := lag; i < len(e); i++ {
+			sum += e[i] * e[i-lag]
+		}
+		corr[lag] = sum / float64(len(e)-lag)
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := rate * 60 / float64(lag)
+		weight := math.Exp(-0.5 * math.Pow(math.Log2(bpm/120), 2))
+		score := corr[lag] * weight
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// parabolic interpolation between neighboring lags
+	lag := float64(best)
+	a, b, c := corr[best-1], corr[best], corr[best+1]
+	if d := a - 2*b + c; d != 0 {
+		lag += 0.5 * (a - c) / d
+	}
+	return round(rate*60/lag, 1)
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+func atoi(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+func commandErr(name string, err error, stderr []byte) error {
+	if msg := bytes.TrimSpace(stderr); len(msg) > 0 {
+		if len(msg) > 512 {
+			msg = msg[len(msg)-512:]
+		}
+		return fmt.Errorf("%s: %w: %s", name, err, msg)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// clicks makes mono 16-bit samples with a short click on each beat.
+func clicks(bpm float64, seconds int) []byte {
+	var buf bytes.Buffer
+	beat := int(float64(tempoSampleRate) * 60 / bpm)
+	for i := 0; i < tempoSampleRate*seconds; i++ {
+		var v int16
+		if i%beat < 200 {
+			v = int16(20000 * math.Sin(float64(i)*0.5))
+		}
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func TestTempo(t *testing.T) {
+	for _, bpm := range []float64{90, 120, 140} {
+		envelope, err := onsetEnvelope(bytes.NewReader(clicks(bpm, 30)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := tempo(envelope, float64(tempoSampleRate)/tempoHopSize)
+		if math.Abs(got-bpm) > 2 {
+			t.Errorf("expected %.1f bpm got %.1f", bpm, got)
+		}
+	}
+}
+
+func TestParseLoudness(t *testing.T) {
+	output := `[Parsed_ebur128_0 @ 0x55d5c8c0] Summary:
+
+  Integrated loudness:
+    I:         -14.2 LUFS
+    Threshold: -24.6 LUFS
+
+  Loudness range:
+    LRA:         6.1 LU
+    Threshold:  -34.5 LUFS
+    LRA low:    -19.5 LUFS
+    LRA high:   -13.4 LUFS
+
+  True peak:
+    Peak:        0.5 dBFS
+`
+	loudness, peak, err := parseLoudness(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loudness != -14.2 || peak != 0.5 {
+		t.Errorf("unexpected loudness %f peak %f", loudness, peak)
+	}
+	if gain := TrackGain(loudness); gain != -3.8 {
+		t.Errorf("unexpected gain %f", gain)
+	}
+	if _, _, err := parseLoudness("no summary"); err != ErrNoLoudness {
+		t.Errorf("expected no loudness got %v", err)
+	}
+}
+
+func TestAlbumLoudness(t *testing.T) {
+	l := AlbumLoudness([]float64{-10, -10}, []float64{100, 300})
+	if math.Abs(l+10) > 0.001 {
+		t.Errorf("unexpected album loudness %f", l)
+	}
+	l = AlbumLoudness([]float64{-10, -20}, []float64{100, 100})
+	if l < -13 || l > -12 {
+		t.Errorf("unexpected album loudness %f", l)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package audio probes audio files for stream details and embedded pictures.
+// Only the headers are read, using io.ReaderAt, so remote objects can be
+// probed with range requests rather than fetching the entire file.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown audio format")
+	ErrInvalidHeader = errors.New("invalid audio header")
+)
+
+const (
+	headerSize = 64 * 1024
+	tailSize   = 64 * 1024
+)
+
+// Duration returns the play duration of the FLAC, MP3, Ogg (Vorbis or Opus)
+// or MP4/M4A audio in r which has the provided size in bytes.
+func Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	buf, err := readAt(r, 0, headerSize, size)
+	if err != nil {
+		return 0, err
+	}
+
+	// skip any ID3v2 tags, which can be large with embedded images
+	offset := id3Size(buf)
+	if offset > 0 {
+		buf, err = readAt(r, offset, headerSize, size)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(buf, []byte("fLaC")):
+		return flacDuration(buf)
+	case bytes.HasPrefix(buf, []byte("OggS")):
+		return oggDuration(r, buf, size)
+	case len(buf) >= 8 && bytes.Equal(buf[4:8], []byte("ftyp")):
+		return mp4Duration(r, size)
+	default:
+		return mp3Duration(buf, offset, size)
+	}
+}
+
+func readAt(r io.ReaderAt, offset, n, size int64) ([]byte, error) {
+	if offset >= size {
+		return nil, ErrInvalidHeader
+	}
+	if offset+n > size {
+		n = size - offset
+	}
+	buf := make([]byte, n)
+	c, err := r.ReadAt(buf, offset)
+	if err != nil && !(err == io.EOF && int64(c) == n) {
+		return nil, err
+	}
+	return buf[:c], nil
+}
+
+func seconds(samples uint64, rate uint32) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(samples * uint64(time.Second) / uint64(rate))
+}
+
+// id3Size returns the size of an ID3v2 tag at the start of buf or 0.
+func id3Size(buf []byte) int64 {
+	if len(buf) < 10 || !bytes.HasPrefix(buf, []byte("ID3")) {
+		return 0
+	}
+	// synchsafe integer, 7 bits per byte
+	size := int64(buf[6]&0x7f)<<21 | int64(buf[7]&0x7f)<<14 |
+		int64(buf[8]&0x7f)<<7 | int64(buf[9]&0x7f)
+	size += 10
+	if buf[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	return size
+}
+
+// flacDuration uses the STREAMINFO block which is always first.
+func flacDuration(buf []byte) (time.Duration, error) {
+	// marker(4) + block header(4) + block sizes(10) + packed fields(8)
+	if len(buf) < 26 || buf[4]&0x7f != 0 {
+		return 0, ErrInvalidHeader
+	}
+	v := binary.BigEndian.Uint64(buf[18:26])
+	rate := uint32(v >> 44)
+	samples := v & 0xfffffffff
+	return seconds(samples, rate), nil
+}
+
+// oggDuration uses the granule position of the last page and the sample rate
+// from the identification header.
+func oggDuration(r io.ReaderAt, buf []byte, size int64) (time.Duration, error) {
+	var rate uint32
+	var preskip uint64
+	if i := bytes.Index(buf, []byte("\x01vorbis")); i >= 0 && len(buf) >= i+16 {
+		rate = binary.LittleEndian.Uint32(buf[i+12 : i+16])
+	} else if i := bytes.Index(buf, []byte("OpusHead")); i >= 0 && len(buf) >= i+12 {
+		// opus granule position is always 48kHz
+		rate = 48000
+		preskip = uint64(binary.LittleEndian.Uint16(buf[i+10 : i+12]))
+	} else {
+		return 0, ErrUnknownFormat
+	}
+
+	offset := size - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail, err := readAt(r, offset, tailSize, size)
+	if err != nil {
+		return 0, err
+	}
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i < 0 || len(tail) < i+14 {
+		return 0, ErrInvalidHeader
+	}
+	granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+	if granule < preskip {
+		return 0, ErrInvalidHeader
+	}
+	return seconds(granule-preskip, rate), nil
+}
+
+// mp4Duration uses the movie header (mvhd) inside the moov atom, which may
+// be located before or after the media data.
+func mp4Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	start, end, err := findAtom(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	start, end, err = findAtom(r, start, end, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	buf, err := readAt(r, start, 32, size)
+	if err != nil || end-start < 20 {
+		return 0, ErrInvalidHeader
+	}
+	var scale uint32
+	var duration uint64
+	if buf[0] == 1 {
+		// version(1) flags(3) creation(8) modification(8)
+		if len(buf) < 32 {
+			return 0, ErrInvalidHeader
+		}
+		scale = binary.BigEndian.Uint32(buf[20:24])
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		// version(1) flags(3) creation(4) modification(4)
+		scale = binary.BigEndian.Uint32(buf[12:16])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	return seconds(duration, scale), nil
+}
+
+// findAtom returns the content range of the named atom between start and
+// end.
+func findAtom(r io.ReaderAt, start, end int64, name string) (int64, int64, error) {
+	for offset := start; offset+8 <= end; {
+		buf, err := readAt(r, offset, 16, end)
+		if err != nil || len(buf) < 8 {
+			return 0, 0, ErrInvalidHeader
+		}
+		atomSize := int64(binary.BigEndian.Uint32(buf[0:4]))
+		header := int64(8)
+		switch atomSize {
+		case 0:
+			// extends to the end
+			atomSize = end - offset
+		case 1:
+			// 64-bit size follows the type
+			if len(buf) < 16 {
+				return 0, 0, ErrInvalidHeader
+			}
+			atomSize = int64(binary.BigEndian.Uint64(buf[8:16]))
+			header = 16
+		}
+		if atomSize < header {
+			return 0, 0, ErrInvalidHeader
+		}
+		if string(buf[4:8]) == name {
+			return offset + header, offset + atomSize, nil
+		}
+		offset += atomSize
+	}
+	return 0, 0, ErrUnknownFormat
+}
+
+var (
+	// bitrates in kbps for MPEG1 and MPEG2/2.5 layer 3
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	// sample rates for MPEG1, MPEG2, MPEG2.5
+	mp3Rates = [3][4]uint32{
+		{44100, 48000, 32000, 0},
+		{22050, 24000, 16000, 0},
+		{11025, 12000, 8000, 0},
+	}
+)
+
+// mp3Duration uses the Xing/Info or VBRI frame count when present, otherwise
+// the bitrate of the first frame assuming constant bitrate.
+func mp3Duration(buf []byte, offset, size int64) (time.Duration, error) {
+	// find the first frame sync
+	i := 0
+	for ; i+4 <= len(buf); i++ {
+		if buf[i] == 0xff && buf[i+1]&0xe0 == 0xe0 {
+			break
+		}
+	}
+	if i+4 > len(buf) {
+		return 0, ErrUnknownFormat
+	}
+	h := buf[i:]
+
+	var mpeg int // 0: MPEG1, 1: MPEG2, 2: MPEG2.5
+	switch (h[1] >> 3) & 0x3 {
+	case 3:
+		mpeg = 0
+	case 2:
+		mpeg = 1
+	case 0:
+		mpeg = 2
+	default:
+		return 0, ErrInvalidHeader
+	}
+	if (h[1]>>1)&0x3 != 1 {
+		// only layer 3
+		return 0, ErrUnknownFormat
+	}
+	table := 0
+	if mpeg > 0 {
+		table = 1
+	}
+	bitrate := mp3Bitrates[table][h[2]>>4] * 1000
+	rate := mp3Rates[mpeg][(h[2]>>2)&0x3]
+	if bitrate == 0 || rate == 0 {
+		return 0, ErrInvalidHeader
+	}
+	mono := h[3]>>6 == 3
+	samplesPerFrame := uint64(1152)
+	if mpeg > 0 {
+		samplesPerFrame = 576
+	}
+
+	// side information size
+	side := 32
+	switch {
+	case mpeg == 0 && mono:
+		side = 17
+	case mpeg > 0 && !mono:
+		side = 17
+	case mpeg > 0 && mono:
+		side = 9
+	}
+	if x := 4 + side; len(h) >= x+12 {
+		tag := string(h[x : x+4])
+		if (tag == "Xing" || tag == "Info") && h[x+7]&0x1 != 0 {
+			frames := uint64(binary.BigEndian.Uint32(h[x+8 : x+12]))
+			return seconds(frames*samplesPerFrame, rate), nil
+		}
+	}
+	if len(h) >= 4+32+18 && string(h[36:40]) == "VBRI" {
+		frames := uint64(binary.BigEndian.Uint32(h[36+14 : 36+18]))
+		return seconds(frames*samplesPerFrame, rate), nil
+	}
+
+	// constant bitrate
+	audio := size - offset - int64(i)
+	return time.Duration(audio * 8 * int64(time.Second) / int64(bitrate)), nil
+}
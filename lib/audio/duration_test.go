@@ -0,0 +1,107 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, data []byte) time.Duration {
+	d, err := Duration(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestFlac(t *testing.T) {
+	data := make([]byte, 42)
+	copy(data, "fLaC")
+	data[7] = 34 // streaminfo length
+	// 44.1kHz, 2 channels, 16 bits, 10 seconds
+	v := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | uint64(441000)
+	binary.BigEndian.PutUint64(data[18:26], v)
+	if d := probe(t, data); d != 10*time.Second {
+		t.Errorf("flac got %s", d)
+	}
+}
+
+func TestMP3(t *testing.T) {
+	// id3 tag then MPEG1 layer 3, 128kbps, 44.1kHz, stereo
+	data := []byte("ID3\x04\x00\x00\x00\x00\x00\x0a")
+	data = append(data, make([]byte, 10)...)
+	frame := []byte{0xff, 0xfb, 0x90, 0x00}
+	cbr := append(data, frame...)
+	cbr = append(cbr, make([]byte, 16000*5-4)...)
+	if d := probe(t, cbr); d != 5*time.Second {
+		t.Errorf("cbr got %s", d)
+	}
+
+	xing := append(data, frame...)
+	xing = append(xing, make([]byte, 32)...)
+	xing = append(xing, []byte("Xing\x00\x00\x00\x01")...)
+	frames := make([]byte, 4)
+	binary.BigEndian.PutUint32(frames, 3828) // ~100s
+	xing = append(xing, frames...)
+	xing = append(xing, make([]byte, 1000)...)
+	if d := probe(t, xing); d.Round(time.Second) != 100*time.Second {
+		t.Errorf("xing got %s", d)
+	}
+}
+
+func TestOgg(t *testing.T) {
+	data := []byte("OggS")
+	data = append(data, make([]byte, 24)...)
+	data = append(data, []byte("\x01vorbis")...)
+	head := make([]byte, 9)
+	binary.LittleEndian.PutUint32(head[5:9], 48000)
+	data = append(data, head...)
+	data = append(data, make([]byte, 100)...)
+	page := []byte("OggS\x00\x04")
+	granule := make([]byte, 8)
+	binary.LittleEndian.PutUint64(granule, 48000*30)
+	data = append(data, page...)
+	data = append(data, granule...)
+	data = append(data, make([]byte, 20)...)
+	if d := probe(t, data); d != 30*time.Second {
+		t.Errorf("ogg got %s", d)
+	}
+}
+
+func atom(name string, content []byte) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, uint32(8+len(content)))
+	copy(buf[4:], name)
+	return append(buf, content...)
+}
+
+func TestMP4(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 245500)
+	var data []byte
+	data = append(data, atom("ftyp", []byte("M4A "))...)
+	data = append(data, atom("mdat", make([]byte, 5000))...)
+	data = append(data, atom("moov", atom("mvhd", mvhd))...)
+	if d := probe(t, data); d != 245500*time.Millisecond {
+		t.Errorf("mp4 got %s", d)
+	}
+}
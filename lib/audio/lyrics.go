@@ -0,0 +1,253 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/defsub/takeout/lib/encoding/lrc"
+)
+
+var (
+	ErrNoLyrics = errors.New("no embedded lyrics")
+)
+
+// Lyrics returns the embedded lyrics from ID3v2 SYLT or USLT frames, FLAC
+// LYRICS or UNSYNCEDLYRICS comments, or the MP4 ©lyr atom in the audio in r
+// which has the provided size in bytes. Synced lyrics are returned in LRC
+// format.
+func Lyrics(r io.ReaderAt, size int64) (string, error) {
+	buf, err := readAt(r, 0, headerSize, size)
+	if err != nil {
+		return "", err
+	}
+
+	var text string
+	offset := id3Size(buf)
+	if offset > 0 {
+		frames, version, err := id3Frames(r, offset, size)
+		if err != nil {
+			return "", err
+		}
+		text = strings.TrimSpace(id3Lyrics(frames, version))
+		if text != "" {
+			return text, nil
+		}
+		buf, err = readAt(r, offset, headerSize, size)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(buf, []byte("fLaC")):
+		text, err = flacLyrics(r, offset, size)
+	case len(buf) >= 8 && bytes.Equal(buf[4:8], []byte("ftyp")):
+		text, err = mp4Lyrics(r, size)
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrNoLyrics
+	}
+	return text, nil
+}
+
+// id3Lyrics prefers synced lyrics (SYLT) over unsynced lyrics (USLT).
+func id3Lyrics(frames []id3Frame, version byte) string {
+	synced, unsynced := "SYLT", "USLT"
+	if version == 2 {
+		synced, unsynced = "SLT", "ULT"
+	}
+	for _, f := range frames {
+		if f.id == synced {
+			if text := parseSYLT(f.body); text != "" {
+				return text
+			}
+		}
+	}
+	for _, f := range frames {
+		if f.id == unsynced {
+			if text := parseUSLT(f.body); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// parseUSLT parses the frame body: encoding, language, description and
+// lyrics.
+func parseUSLT(body []byte) string {
+	if len(body) < 5 {
+		return ""
+	}
+	encoding := body[0]
+	_, rest := splitText(encoding, body[4:])
+	return decodeText(encoding, rest)
+}
+
+// parseSYLT parses the frame body: encoding, language, timestamp format,
+// content type, description and then each line followed by the time. Only
+// millisecond timestamps are supported.
+func parseSYLT(body []byte) string {
+	if len(body) < 7 || body[4] != 2 {
+		return ""
+	}
+	encoding := body[0]
+	_, rest := splitText(encoding, body[6:])
+	var lines []lrc.Line
+	for len(rest) > 4 {
+		var text []byte
+		text, rest = splitText(encoding, rest)
+		if len(rest) < 4 {
+			break
+		}
+		ms := binary.BigEndian.Uint32(rest[0:4])
+		rest = rest[4:]
+		lines = append(lines, lrc.Line{
+			Time: time.Duration(ms) * time.Millisecond,
+			Text: strings.TrimSpace(decodeText(encoding, text)),
+		})
+	}
+	return lrc.Format(lines)
+}
+
+// splitText returns the text up to the terminator, which is two zero bytes
+// for UTF-16 or one zero byte otherwise, and the remaining bytes.
+func splitText(encoding byte, b []byte) ([]byte, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return b, nil
+	}
+	return b[:i], b[i+1:]
+}
+
+// decodeText decodes ISO-8859-1 (0), UTF-16 with BOM (1), UTF-16BE (2) or
+// UTF-8 (3) text.
+func decodeText(encoding byte, b []byte) string {
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return strings.TrimRight(string(runes), "\x00")
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			order = binary.LittleEndian
+			b = b[2:]
+		} else if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			b = b[2:]
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = order.Uint16(b[i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// flacLyrics finds LYRICS or UNSYNCEDLYRICS in the VORBIS_COMMENT block.
+func flacLyrics(r io.ReaderAt, offset, size int64) (string, error) {
+	blocks, err := flacBlocks(r, offset, size, 4)
+	if err != nil {
+		return "", err
+	}
+	for _, block := range blocks {
+		for _, c := range vorbisComments(block) {
+			i := strings.IndexByte(c, '=')
+			if i < 0 {
+				continue
+			}
+			switch strings.ToUpper(c[:i]) {
+			case "LYRICS", "UNSYNCEDLYRICS":
+				return c[i+1:], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// vorbisComments parses the vendor string followed by the count and each
+// comment, with little endian lengths.
+func vorbisComments(block []byte) []string {
+	var comments []string
+	if len(block) < 4 {
+		return comments
+	}
+	pos := 4 + int(binary.LittleEndian.Uint32(block[0:4]))
+	if pos+4 > len(block) {
+		return comments
+	}
+	count := int(binary.LittleEndian.Uint32(block[pos : pos+4]))
+	pos += 4
+	for i := 0; i < count && pos+4 <= len(block); i++ {
+		n := int(binary.LittleEndian.Uint32(block[pos : pos+4]))
+		pos += 4
+		if n < 0 || pos+n > len(block) {
+			break
+		}
+		comments = append(comments, string(block[pos:pos+n]))
+		pos += n
+	}
+	return comments
+}
+
+// mp4Lyrics finds the lyrics in moov/udta/meta/ilst/©lyr/data.
+func mp4Lyrics(r io.ReaderAt, size int64) (string, error) {
+	start, end := int64(0), size
+	for _, name := range []string{"moov", "udta", "meta", "ilst", "\xa9lyr", "data"} {
+		var err error
+		start, end, err = findAtom(r, start, end, name)
+		if err != nil {
+			return "", nil
+		}
+		if name == "meta" {
+			// version and flags
+			start += 4
+		}
+	}
+	if end-start <= 8 || end-start > maxPictureSize {
+		return "", nil
+	}
+	data, err := readAt(r, start, end-start, size)
+	if err != nil {
+		return "", err
+	}
+	// type indicator and locale
+	return string(data[8:]), nil
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func id3Tag(frames ...[]byte) []byte {
+	var body []byte
+	for _, f := range frames {
+		body = append(body, f...)
+	}
+	n := len(body)
+	data := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+	data = append(data, body...)
+	// mp3 frame header
+	data = append(data, 0xff, 0xfb, 0x90, 0x00)
+	return append(data, make([]byte, 128)...)
+}
+
+func newID3Frame(id string, body []byte) []byte {
+	header := []byte(id)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(body)))
+	header = append(header, size...)
+	header = append(header, 0, 0)
+	return append(header, body...)
+}
+
+func lyrics(t *testing.T, data []byte) string {
+	text, err := Lyrics(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestID3Lyrics(t *testing.T) {
+	uslt := []byte{3}
+	uslt = append(uslt, "eng"...)
+	uslt = append(uslt, 0)
+	uslt = append(uslt, "Here in my car\nI feel safest of all"...)
+
+	text := lyrics(t, id3Tag(newID3Frame("USLT", uslt)))
+	if text != "Here in my car\nI feel safest of all" {
+		t.Errorf("unexpected lyrics %q", text)
+	}
+
+	sylt := []byte{0}
+	sylt = append(sylt, "eng"...)
+	sylt = append(sylt, 2, 1, 0)
+	for i, line := range []string{"Here in my car", "I feel safest of all"} {
+		sylt = append(sylt, line...)
+		sylt = append(sylt, 0, 0, 0, byte(i+1)*0x10, 0)
+	}
+
+	text = lyrics(t, id3Tag(newID3Frame("USLT", uslt), newID3Frame("SYLT", sylt)))
+	if text != "[00:04.09]Here in my car\n[00:08.19]I feel safest of all" {
+		t.Errorf("unexpected synced lyrics %q", text)
+	}
+}
+
+func TestFlacLyrics(t *testing.T) {
+	var block bytes.Buffer
+	field := func(s string) {
+		binary.Write(&block, binary.LittleEndian, uint32(len(s)))
+		block.WriteString(s)
+	}
+	field("vendor")
+	binary.Write(&block, binary.LittleEndian, uint32(2))
+	field("TITLE=Cars")
+	field("Lyrics=Here in my car")
+
+	data := []byte("fLaC")
+	data = append(data, 0, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	n := block.Len()
+	data = append(data, 0x80|4, byte(n>>16), byte(n>>8), byte(n))
+	data = append(data, block.Bytes()...)
+
+	text := lyrics(t, data)
+	if text != "Here in my car" {
+		t.Errorf("unexpected lyrics %q", text)
+	}
+}
+
+func TestLatin1Text(t *testing.T) {
+	if s := decodeText(0, []byte{'c', 'a', 'f', 0xe9}); s != "café" {
+		t.Errorf("unexpected text %q", s)
+	}
+	if s := decodeText(1, []byte{0xff, 0xfe, 'o', 0, 'k', 0}); s != "ok" {
+		t.Errorf("unexpected text %q", s)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNoPicture = errors.New("no embedded picture")
+)
+
+const (
+	// largest metadata read to find pictures
+	maxPictureSize = 16 * 1024 * 1024
+	// front cover picture type used by ID3v2 and FLAC
+	pictureFront = 3
+)
+
+// Picture is an image embedded in the audio metadata.
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+type picture struct {
+	Picture
+	kind byte
+}
+
+// FrontPicture returns the embedded front cover, or the first picture when
+// there's no front cover, from FLAC PICTURE blocks, ID3v2 APIC frames or the
+// MP4 covr atom in the audio in r which has the provided size in bytes.
+func FrontPicture(r io.ReaderAt, size int64) (*Picture, error) {
+	buf, err := readAt(r, 0, headerSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pictures []picture
+	offset := id3Size(buf)
+	if offset > 0 {
+		pictures, err = id3Pictures(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		buf, err = readAt(r, offset, headerSize, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(buf, []byte("fLaC")):
+		pictures, err = flacPictures(r, offset, size)
+	case len(buf) >= 8 && bytes.Equal(buf[4:8], []byte("ftyp")):
+		pictures, err = mp4Pictures(r, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pictures {
+		if p.kind == pictureFront {
+			return &p.Picture, nil
+		}
+	}
+	if len(pictures) > 0 {
+		return &pictures[0].Picture, nil
+	}
+	return nil, ErrNoPicture
+}
+
+// id3Pictures finds APIC (or PIC for v2.2) frames in the ID3v2 tag.
+func id3Pictures(r io.ReaderAt, tagSize, size int64) ([]picture, error) {
+	frames, version, err := id3Frames(r, tagSize, size)
+	if err != nil {
+		return nil, err
+	}
+	var pictures []picture
+	for _, f := range frames {
+		if f.id == "APIC" || f.id == "PIC" {
+			if p, ok := parseAPIC(f.body, version == 2); ok {
+				pictures = append(pictures, p)
+			}
+		}
+	}
+	return pictures, nil
+}
+
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// id3Frames reads the ID3v2 tag and returns the frames and tag version.
+func id3Frames(r io.ReaderAt, tagSize, size int64) ([]id3Frame, byte, error) {
+	if tagSize > maxPictureSize {
+		return nil, 0, ErrInvalidHeader
+	}
+	tag, err := readAt(r, 0, tagSize, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	version := tag[3]
+	pos := 10
+	if tag[5]&0x40 != 0 && version >= 3 && len(tag) >= 14 {
+		// skip extended header
+		n := int(binary.BigEndian.Uint32(tag[10:14]))
+		if version == 4 {
+			n = synchsafe(tag[10:14])
+		} else {
+			n += 4
+		}
+		pos += n
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	var frames []id3Frame
+	for pos+headerSize <= len(tag) {
+		id := string(tag[pos : pos+idSize])
+		if id[0] == 0 {
+			// padding
+			break
+		}
+		var n int
+		switch version {
+		case 2:
+			n = int(tag[pos+3])<<16 | int(tag[pos+4])<<8 | int(tag[pos+5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(tag[pos+4 : pos+8]))
+		default:
+			n = synchsafe(tag[pos+4 : pos+8])
+		}
+		start := pos + headerSize
+		end := start + n
+		if n <= 0 || end > len(tag) {
+			break
+		}
+		frames = append(frames, id3Frame{id: id, body: tag[start:end]})
+		pos = end
+	}
+	return frames, version, nil
+}
+
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// parseAPIC parses the frame body: encoding, mime type (or 3 character
+// format for v2.2), picture type, description and picture data.
+func parseAPIC(body []byte, v22 bool) (picture, bool) {
+	var p picture
+	if len(body) < 2 {
+		return p, false
+	}
+	encoding := body[0]
+	pos := 1
+	if v22 {
+		if len(body) < 5 {
+			return p, false
+		}
+		switch string(bytes.ToLower(body[1:4])) {
+		case "png":
+			p.MIMEType = "image/png"
+		default:
+			p.MIMEType = "image/jpeg"
+		}
+		pos = 4
+	} else {
+		i := bytes.IndexByte(body[pos:], 0)
+		if i < 0 {
+			return p, false
+		}
+		p.MIMEType = mimeType(string(body[pos : pos+i]))
+		pos += i + 1
+	}
+	if pos >= len(body) {
+		return p, false
+	}
+	p.kind = body[pos]
+	pos++
+
+	// description is terminated by one zero byte or two for utf-16
+	if encoding == 1 || encoding == 2 {
+		for ; pos+1 < len(body); pos += 2 {
+			if body[pos] == 0 && body[pos+1] == 0 {
+				break
+			}
+		}
+		pos += 2
+	} else {
+		i := bytes.IndexByte(body[pos:], 0)
+		if i < 0 {
+			return p, false
+		}
+		pos += i + 1
+	}
+	if pos >= len(body) {
+		return p, false
+	}
+	p.Data = body[pos:]
+	return p, true
+}
+
+// flacPictures finds PICTURE metadata blocks.
+func flacPictures(r io.ReaderAt, offset, size int64) ([]picture, error) {
+	blocks, err := flacBlocks(r, offset, size, 6)
+	if err != nil {
+		return nil, err
+	}
+	var pictures []picture
+	for _, block := range blocks {
+		if p, ok := parseFlacPicture(block); ok {
+			pictures = append(pictures, p)
+		}
+	}
+	return pictures, nil
+}
+
+// flacBlocks returns the metadata blocks of the kind, such as 4 for
+// VORBIS_COMMENT or 6 for PICTURE.
+func flacBlocks(r io.ReaderAt, offset, size int64, kind byte) ([][]byte, error) {
+	var blocks [][]byte
+	pos := offset + 4
+	for {
+		header, err := readAt(r, pos, 4, size)
+		if err != nil || len(header) < 4 {
+			return blocks, ErrInvalidHeader
+		}
+		last := header[0]&0x80 != 0
+		n := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+		if header[0]&0x7f == kind && n <= maxPictureSize {
+			block, err := readAt(r, pos, n, size)
+			if err != nil {
+				return blocks, err
+			}
+			blocks = append(blocks, block)
+		}
+		pos += n
+		if last || pos >= size {
+			break
+		}
+	}
+	return blocks, nil
+}
+
+// parseFlacPicture parses the block: type, mime type, description, width,
+// height, depth, colors and picture data.
+func parseFlacPicture(block []byte) (picture, bool) {
+	var p picture
+	field := func(pos int) (int, bool) {
+		if pos+4 > len(block) {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(block[pos : pos+4])), true
+	}
+	kind, ok := field(0)
+	if !ok {
+		return p, false
+	}
+	p.kind = byte(kind)
+	n, ok := field(4)
+	if !ok || 8+n > len(block) {
+		return p, false
+	}
+	p.MIMEType = mimeType(string(block[8 : 8+n]))
+	pos := 8 + n
+	n, ok = field(pos)
+	if !ok {
+		return p, false
+	}
+	pos += 4 + n + 16
+	n, ok = field(pos)
+	if !ok || pos+4+n > len(block) {
+		return p, false
+	}
+	p.Data = block[pos+4 : pos+4+n]
+	return p, true
+}
+
+// mp4Pictures finds the cover in moov/udta/meta/ilst/covr/data.
+func mp4Pictures(r io.ReaderAt, size int64) ([]picture, error) {
+	start, end := int64(0), size
+	for _, name := range []string{"moov", "udta", "meta", "ilst", "covr", "data"} {
+		var err error
+		start, end, err = findAtom(r, start, end, name)
+		if err != nil {
+			return nil, ErrNoPicture
+		}
+		if name == "meta" {
+			// version and flags
+			start += 4
+		}
+	}
+	if end-start <= 8 || end-start > maxPictureSize {
+		return nil, ErrNoPicture
+	}
+	data, err := readAt(r, start, end-start, size)
+	if err != nil {
+		return nil, err
+	}
+	// type indicator and locale
+	p := picture{kind: pictureFront}
+	switch binary.BigEndian.Uint32(data[0:4]) {
+	case 14:
+		p.MIMEType = "image/png"
+	default:
+		p.MIMEType = "image/jpeg"
+	}
+	p.Data = data[8:]
+	return []picture{p}, nil
+}
+
+func mimeType(v string) string {
+	switch v {
+	case "", "image/jpg", "jpg", "JPG":
+		return "image/jpeg"
+	case "png", "PNG":
+		return "image/png"
+	}
+	return v
+}
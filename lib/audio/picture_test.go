@@ -0,0 +1,105 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func front(t *testing.T, data []byte) *Picture {
+	p, err := FrontPicture(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFlacPicture(t *testing.T) {
+	var block bytes.Buffer
+	field := func(v int) {
+		binary.Write(&block, binary.BigEndian, uint32(v))
+	}
+	field(pictureFront)
+	field(len("image/png"))
+	block.WriteString("image/png")
+	field(len("cover"))
+	block.WriteString("cover")
+	block.Write(make([]byte, 16))
+	field(3)
+	block.WriteString("png")
+
+	data := []byte("fLaC")
+	// streaminfo
+	data = append(data, 0, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	// last block is the picture
+	n := block.Len()
+	data = append(data, 0x80|6, byte(n>>16), byte(n>>8), byte(n))
+	data = append(data, block.Bytes()...)
+
+	p := front(t, data)
+	if p.MIMEType != "image/png" || string(p.Data) != "png" {
+		t.Errorf("unexpected picture %s %q", p.MIMEType, p.Data)
+	}
+}
+
+func TestID3Picture(t *testing.T) {
+	frame := func(kind byte, img string) []byte {
+		body := []byte{0}
+		body = append(body, "image/jpeg"...)
+		body = append(body, 0, kind)
+		body = append(body, "desc"...)
+		body = append(body, 0)
+		body = append(body, img...)
+		header := []byte("APIC")
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(body)))
+		header = append(header, size...)
+		header = append(header, 0, 0)
+		return append(header, body...)
+	}
+	var frames []byte
+	frames = append(frames, frame(4, "back")...)
+	frames = append(frames, frame(pictureFront, "front")...)
+	frames = append(frames, make([]byte, 16)...) // padding
+
+	n := len(frames)
+	data := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+	data = append(data, frames...)
+	// mp3 frame header
+	data = append(data, 0xff, 0xfb, 0x90, 0x00)
+	data = append(data, make([]byte, 128)...)
+
+	p := front(t, data)
+	if p.MIMEType != "image/jpeg" || string(p.Data) != "front" {
+		t.Errorf("unexpected picture %s %q", p.MIMEType, p.Data)
+	}
+}
+
+func TestNoPicture(t *testing.T) {
+	data := []byte("fLaC")
+	data = append(data, 0x80, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	_, err := FrontPicture(bytes.NewReader(data), int64(len(data)))
+	if err != ErrNoPicture {
+		t.Errorf("expected no picture got %v", err)
+	}
+}
@@ -19,6 +19,7 @@ package bucket
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"regexp"
 	"strings"
@@ -135,6 +136,13 @@ func (b *Bucket) List(lastSync time.Time) (objectCh chan *Object, err error) {
 	return
 }
 
+// ID returns an identifier for the bucket based on the endpoint, bucket name
+// and object prefix. This is used to record which bucket an object came from.
+func (b *Bucket) ID() string {
+	return strings.Join([]string{b.config.Endpoint, b.config.BucketName,
+		b.config.ObjectPrefix}, "/")
+}
+
 // Generate a presigned url which expires based on config settings.
 func (b *Bucket) Presign(key string) *url.URL {
 	req, _ := b.s3.GetObjectRequest(&s3.GetObjectInput{
@@ -145,6 +153,36 @@ func (b *Bucket) Presign(key string) *url.URL {
 	return url
 }
 
+type objectReader struct {
+	bucket *Bucket
+	key    string
+}
+
+// ReaderAt returns a reader for the object which uses range requests to read
+// only the requested parts of the object.
+func (b *Bucket) ReaderAt(key string) io.ReaderAt {
+	return &objectReader{bucket: b, key: key}
+}
+
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	resp, err := r.bucket.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(r.bucket.config.BucketName),
+		Key:    aws.String(r.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
 
 func (b *Bucket) Rewrite(path string) string {
 	result := path
@@ -42,6 +42,7 @@ const (
 var (
 	HeaderUserAgent    = http.CanonicalHeaderKey("User-Agent")
 	HeaderCacheControl = http.CanonicalHeaderKey("Cache-Control")
+	HeaderRetryAfter   = http.CanonicalHeaderKey("Retry-After")
 	ErrCacheMiss       = errors.New("cache miss")
 )
 
@@ -52,9 +53,15 @@ type Client struct {
 	cache      httpcache.Cache
 	maxAge     time.Duration
 	onlyCached bool
+	cacheFirst bool
 }
 
+// NewClient creates a new client using the provided config. Rate limits are
+// process-wide so only the RateLimits from the first client config are used.
 func NewClient(config *config.ClientConfig) *Client {
+	limitsOnce.Do(func() {
+		setRateLimits(config.RateLimits)
+	})
 	c := Client{}
 	c.userAgent = config.UserAgent
 	c.useCache = config.UseCache
@@ -69,25 +76,16 @@ func NewClient(config *config.ClientConfig) *Client {
 	return &c
 }
 
-var lastRequest map[string]time.Time = map[string]time.Time{}
-
-func RateLimit(host string) {
-	// TODO no support for concurrency
-	t := time.Now()
-	// if v, ok := lastRequest[host]; ok {
-	// 	d := t.Sub(v)
-	// 	if d < time.Second {
-	// 		time.Sleep(d)
-	// 	}
-	// }
-	time.Sleep(time.Second)
-	lastRequest[host] = t
-}
-
 func (c *Client) UseOnlyIfCached(enabled bool) {
 	c.onlyCached = enabled
 }
 
+// UseCacheFirst uses cached responses regardless of age and only makes
+// requests for responses that aren't cached.
+func (c *Client) UseCacheFirst(enabled bool) {
+	c.cacheFirst = enabled
+}
+
 func (c *Client) doGet(headers map[string]string, urlStr string) (*http.Response, error) {
 	// log.Printf("doGet %s\n", urlStr)
 	url, _ := url.Parse(urlStr)
@@ -105,10 +103,12 @@ func (c *Client) doGet(headers map[string]string, urlStr string) (*http.Response
 
 	throttle := true
 	if c.useCache {
+		// a cache control header from the caller overrides the client
+		requested := req.Header.Get(HeaderCacheControl) != ""
 		maxAge := int(c.maxAge.Seconds())
 		if c.onlyCached {
 			req.Header.Set(HeaderCacheControl, DirectiveOnlyIfCached)
-		} else if maxAge > 0 {
+		} else if !requested && maxAge > 0 {
 			req.Header.Set(HeaderCacheControl, fmt.Sprintf("%s=%d", DirectiveMaxAge, maxAge))
 		}
 		// peek into the cache, if there's something there don't slow down
@@ -119,11 +119,14 @@ func (c *Client) doGet(headers map[string]string, urlStr string) (*http.Response
 		if cachedResp != nil {
 			throttle = false
 			//log.Printf("is cached\n")
+			if c.cacheFirst && !requested {
+				req.Header.Set(HeaderCacheControl, DirectiveOnlyIfCached)
+			}
 		}
 	}
 	if throttle {
 		//log.Printf("rate limit\n")
-		RateLimit(url.Hostname())
+		Limit(url.Hostname())
 	}
 
 	//log.Printf("get %s\n", req.URL.String())
@@ -155,6 +158,7 @@ func (c *Client) doGetWithRetry(headers map[string]string, url string) (*http.Re
 	var resp *http.Response
 	var err error
 
+	delay := backoff
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		resp, err = c.doGet(headers, url)
 		if err == nil || (err != nil && resp == nil) {
@@ -172,7 +176,20 @@ func (c *Client) doGetWithRetry(headers map[string]string, url string) (*http.Re
 				resp.StatusCode,
 				attempt+1,
 				maxAttempts)
-			time.Sleep(backoff)
+			resp.Body.Close()
+			d := retryAfter(resp)
+			if d == 0 {
+				d = delay
+			}
+			delay *= 2
+			if resp.StatusCode == http.StatusTooManyRequests ||
+				resp.StatusCode == http.StatusServiceUnavailable {
+				// slow down all requests to this host, including
+				// the retry which waits in Limit
+				limiterFor(resp.Request.URL.Hostname()).Block(d)
+			} else {
+				time.Sleep(d)
+			}
 		}
 	}
 
@@ -197,6 +214,15 @@ func (c *Client) GetJson(url string, result interface{}) error {
 	return c.GetJsonWith(nil, url, result)
 }
 
+// GetJsonMaxAge is GetJson using a cached response only if it's no older
+// than maxAge, instead of the client MaxAge.
+func (c *Client) GetJsonMaxAge(url string, maxAge time.Duration, result interface{}) error {
+	headers := map[string]string{
+		HeaderCacheControl: fmt.Sprintf("%s=%d", DirectiveMaxAge, int(maxAge.Seconds())),
+	}
+	return c.GetJsonWith(headers, url, result)
+}
+
 func (c *Client) GetJsonWith(headers map[string]string, url string, result interface{}) error {
 	resp, err := c.doGetWithRetry(headers, url)
 	if err != nil {
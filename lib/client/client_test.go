@@ -18,7 +18,13 @@
 package client
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/defsub/takeout/config"
 )
 
 type mbzTag struct {
@@ -50,10 +56,81 @@ func TestClient(t *testing.T) {
 		"http://musicbrainz.org/ws/2/artist/ba0d6274-db14-4ef5-b28d-657ebde1a396?inc=aliases&fmt=json",
 	}
 
+	c := NewClient(&config.ClientConfig{UserAgent: "takeout test"})
 	for i := 0; i < len(urls); i++ {
 		url := urls[i]
 		var artist mbzArtist
-		GetJson(url, &artist)
+		c.GetJson(url, &artist)
 		t.Logf("%v\n", artist)
 	}
 }
+
+func TestGetJsonMaxAge(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// cached two hours ago
+		w.Header().Set("Date", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"artist %d"}`, requests)
+	}))
+	defer server.Close()
+
+	c := NewClient(&config.ClientConfig{
+		CacheDir: t.TempDir(),
+		MaxAge:   720 * time.Hour,
+		UseCache: true,
+	})
+
+	var artist mbzArtist
+	if err := c.GetJson(server.URL, &artist); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetJson(server.URL, &artist); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || artist.Name != "artist 1" {
+		t.Errorf("expected cached response got %d requests, %s", requests, artist.Name)
+	}
+
+	if err := c.GetJsonMaxAge(server.URL, 24*time.Hour, &artist); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || artist.Name != "artist 1" {
+		t.Errorf("expected fresh cached response got %d requests, %s", requests, artist.Name)
+	}
+
+	if err := c.GetJsonMaxAge(server.URL, time.Hour, &artist); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || artist.Name != "artist 2" {
+		t.Errorf("expected stale response fetched got %d requests, %s", requests, artist.Name)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"artist %d"}`, requests)
+	}))
+	defer server.Close()
+
+	c := NewClient(&config.ClientConfig{UserAgent: "takeout test"})
+	start := time.Now()
+	var artist mbzArtist
+	if err := c.GetJson(server.URL, &artist); err != nil {
+		t.Fatal(err)
+	}
+	// waits once for retry after, not also for the retry backoff
+	elapsed := time.Since(start)
+	if requests != 2 || elapsed < 900*time.Millisecond || elapsed >= backoff {
+		t.Errorf("unexpected retry %d requests in %s", requests, elapsed)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/defsub/takeout/config"
+)
+
+// rateLimit is the request rate allowed for a host. Burst is the number of
+// requests that can be made at once before being limited to rate requests
+// per second.
+type rateLimit struct {
+	Host  string
+	Rate  float64
+	Burst int
+}
+
+// Builtin limits for services used by Takeout. Other hosts use the default
+// limit. These can be changed using Client.RateLimits in the config.
+var defaultRateLimits = []rateLimit{
+	{Host: "musicbrainz.org", Rate: 1, Burst: 1},
+	{Host: "coverartarchive.org", Rate: 5, Burst: 5},
+	{Host: "archive.org", Rate: 5, Burst: 5},
+	{Host: "last.fm", Rate: 5, Burst: 5},
+	{Host: "audioscrobbler.com", Rate: 5, Burst: 5},
+	{Host: "fanart.tv", Rate: 5, Burst: 5},
+	{Host: "themoviedb.org", Rate: 20, Burst: 20},
+	{Host: "tmdb.org", Rate: 20, Burst: 20},
+	{Host: "setlist.fm", Rate: 2, Burst: 1},
+	{Host: "acoustid.org", Rate: 3, Burst: 1},
+}
+
+var defaultRateLimit = rateLimit{Rate: 1, Burst: 1}
+
+// limiter is a token bucket which allows burst requests and then refills
+// at rate tokens per second.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	until  time.Time // blocked until, from Retry-After
+}
+
+func newLimiter(limit rateLimit) *limiter {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait before the request can
+// be made.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 && l.rate > 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if l.until.After(now.Add(wait)) {
+		wait = l.until.Sub(now)
+	}
+	return wait
+}
+
+// Wait blocks until a request can be made.
+func (l *limiter) Wait() {
+	wait := l.reserve()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Block prevents requests for the provided duration.
+func (l *limiter) Block(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.until) {
+		l.until = until
+	}
+}
+
+// Limiters are shared by all clients since the limits apply to the remote
+// host regardless of which client makes the request. The configured limits
+// are applied once, using the RateLimits of the first client created.
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*limiter)
+	rateLimits = append([]rateLimit(nil), defaultRateLimits...)
+	limitsOnce sync.Once
+)
+
+// setRateLimits adds or replaces host rate limits from the config.
+func setRateLimits(limits []config.RateLimitConfig) {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	for _, c := range limits {
+		limit := rateLimit{Host: c.Host, Rate: c.Rate, Burst: c.Burst}
+		replaced := false
+		for i := range rateLimits {
+			if rateLimits[i].Host == limit.Host {
+				rateLimits[i] = limit
+				replaced = true
+			}
+		}
+		if !replaced {
+			rateLimits = append(rateLimits, limit)
+		}
+	}
+	// start over with new limits
+	limiters = make(map[string]*limiter)
+}
+
+// hostLimit finds the limit for the host. Limits match the host or any
+// subdomain, so musicbrainz.org matches beta.musicbrainz.org.
+func hostLimit(host string) rateLimit {
+	host = strings.ToLower(host)
+	for _, limit := range rateLimits {
+		if host == limit.Host || strings.HasSuffix(host, "."+limit.Host) {
+			return limit
+		}
+	}
+	return defaultRateLimit
+}
+
+func limiterFor(host string) *limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	limit := hostLimit(host)
+	key := limit.Host
+	if key == "" {
+		// default limit is per host
+		key = host
+	}
+	l, ok := limiters[key]
+	if !ok {
+		l = newLimiter(limit)
+		limiters[key] = l
+	}
+	return l
+}
+
+// Limit blocks until a request to the host is allowed by the host rate
+// limit. This is safe to use from multiple goroutines.
+func Limit(host string) {
+	limiterFor(host).Wait()
+}
+
+// retryAfter returns the duration from the Retry-After header, which can be
+// seconds or a date.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get(HeaderRetryAfter)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/defsub/takeout/config"
+)
+
+func TestHostLimit(t *testing.T) {
+	limit := hostLimit("beta.musicbrainz.org")
+	if limit.Host != "musicbrainz.org" {
+		t.Errorf("expected musicbrainz.org got %s", limit.Host)
+	}
+	limit = hostLimit("example.com")
+	if limit.Host != "" {
+		t.Errorf("expected default got %s", limit.Host)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(rateLimit{Rate: 10, Burst: 2})
+	if l.reserve() != 0 || l.reserve() != 0 {
+		t.Errorf("expected burst without waiting")
+	}
+	if wait := l.reserve(); wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("unexpected wait %s", wait)
+	}
+	l.Block(time.Second)
+	if wait := l.reserve(); wait < 900*time.Millisecond {
+		t.Errorf("expected blocked wait got %s", wait)
+	}
+}
+
+func TestSetRateLimits(t *testing.T) {
+	host := defaultRateLimits[0].Host
+	rate := defaultRateLimits[0].Rate
+	setRateLimits([]config.RateLimitConfig{
+		{Host: host, Rate: rate + 10, Burst: 10},
+		{Host: "example.org", Rate: 3, Burst: 3},
+	})
+	if defaultRateLimits[0].Rate != rate {
+		t.Errorf("default limits should not change")
+	}
+	if limit := hostLimit(host); limit.Rate != rate+10 {
+		t.Errorf("expected %s rate %f got %f", host, rate+10, limit.Rate)
+	}
+	if limit := hostLimit("www.example.org"); limit.Rate != 3 {
+		t.Errorf("expected example.org rate 3 got %f", limit.Rate)
+	}
+}
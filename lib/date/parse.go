@@ -18,6 +18,7 @@
 package date
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -79,6 +80,15 @@ func FormatJson(t time.Time) string {
 	return t.Format(time.RFC3339)
 }
 
+// FormatDuration formats as m:ss or h:mm:ss, such as 4:05 or 1:02:03.
+func FormatDuration(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, (s/60)%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
 func StartOfDay(t time.Time) time.Time {
     return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 }
@@ -38,3 +38,12 @@ func TestParse1123(t *testing.T) {
 		t.Errorf("wrong year got %d\n", d.Year())
 	}
 }
+
+func TestFormatDuration(t *testing.T) {
+	if s := FormatDuration(245 * time.Second); s != "4:05" {
+		t.Errorf("got %s", s)
+	}
+	if s := FormatDuration(time.Hour + 2*time.Minute + 3*time.Second); s != "1:02:03" {
+		t.Errorf("got %s", s)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package atom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	f := NewFeed("urn:test", "New Releases", "https://example.com/feed")
+	d := time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC)
+	f.Updated = Time(d)
+	f.Entries = append(f.Entries, Entry{
+		ID:      "urn:test:1",
+		Title:   "Gary Numan - Intruder",
+		Updated: Time(d),
+		Author:  &Person{Name: "Gary Numan"},
+		Links:   []Link{{Href: "https://example.com/1"}},
+		Summary: &Text{Value: "Album & more"},
+	})
+
+	var buf bytes.Buffer
+	err := Encode(&buf, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Error("expected xml header")
+	}
+	for _, s := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<link href="https://example.com/feed" rel="self" type="application/atom+xml"></link>`,
+		`<updated>2021-06-04T00:00:00Z</updated>`,
+		`<summary>Album &amp; more</summary>`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %s in\n%s", s, out)
+		}
+	}
+
+	var parsed Feed
+	err = xml.Unmarshal(buf.Bytes(), &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Entries) != 1 || parsed.Entries[0].Author.Name != "Gary Numan" {
+		t.Errorf("bad entries %+v", parsed.Entries)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package lrc reads and writes LRC lyrics which have lines with one or more
+// timestamps, like "[01:02.50]lyrics". Other tags, like "[ar:Artist]", are
+// ignored.
+package lrc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is a lyrics line which starts at Time.
+type Line struct {
+	Time time.Duration
+	Text string
+}
+
+var tagRegexp = regexp.MustCompile(`^\[([^\]]*)\]`)
+var timeRegexp = regexp.MustCompile(`^(\d+):(\d{1,2})(?:[.:](\d{1,3}))?$`)
+
+// parseLine returns the times and text of the line. Lines without
+// timestamps have no times.
+func parseLine(line string) ([]time.Duration, string, bool) {
+	var times []time.Duration
+	tagged := false
+	for {
+		matches := tagRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			break
+		}
+		tagged = true
+		line = line[len(matches[0]):]
+		if t, ok := parseTime(matches[1]); ok {
+			times = append(times, t)
+		}
+	}
+	return times, strings.TrimSpace(line), tagged
+}
+
+func parseTime(s string) (time.Duration, bool) {
+	matches := timeRegexp.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, false
+	}
+	mins, _ := strconv.Atoi(matches[1])
+	secs, _ := strconv.Atoi(matches[2])
+	d := time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second
+	if frac := matches[3]; frac != "" {
+		// hundredths are common but allow tenths and milliseconds
+		n, _ := strconv.Atoi(frac)
+		for i := len(frac); i < 3; i++ {
+			n *= 10
+		}
+		d += time.Duration(n) * time.Millisecond
+	}
+	return d, true
+}
+
+// Parse returns the timestamped lines in order. The result is empty when
+// the lyrics aren't synced.
+func Parse(text string) []Line {
+	var lines []Line
+	for _, v := range strings.Split(normalize(text), "\n") {
+		times, text, _ := parseLine(v)
+		for _, t := range times {
+			lines = append(lines, Line{Time: t, Text: text})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+	return lines
+}
+
+// Synced is true when the lyrics have timestamps.
+func Synced(text string) bool {
+	for _, v := range strings.Split(normalize(text), "\n") {
+		if times, _, _ := parseLine(v); len(times) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Text returns the lyrics without timestamps or other tags.
+func Text(text string) string {
+	if Synced(text) {
+		var result []string
+		for _, l := range Parse(text) {
+			result = append(result, l.Text)
+		}
+		return strings.Join(result, "\n")
+	}
+	var result []string
+	for _, v := range strings.Split(normalize(text), "\n") {
+		_, text, tagged := parseLine(v)
+		if tagged && text == "" {
+			// tag only line
+			continue
+		}
+		result = append(result, text)
+	}
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
+
+// Format returns the lines as LRC text.
+func Format(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		mins := int(l.Time / time.Minute)
+		secs := int(l.Time % time.Minute / time.Second)
+		hundredths := int(l.Time % time.Second / (10 * time.Millisecond))
+		fmt.Fprintf(&b, "[%02d:%02d.%02d]%s\n", mins, secs, hundredths, l.Text)
+	}
+	return b.String()
+}
+
+func normalize(text string) string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
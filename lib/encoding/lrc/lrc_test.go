@@ -0,0 +1,66 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package lrc
+
+import (
+	"testing"
+	"time"
+)
+
+const lyrics = "[ar:Gary Numan]\r\n[ti:Cars]\r\n" +
+	"[00:21.50]Here in my car\r\n" +
+	"[00:25.10][01:40.2]I feel safest of all\r\n" +
+	"[00:28.999]I can lock all my doors\r\n"
+
+func TestParse(t *testing.T) {
+	lines := Parse(lyrics)
+	expect := []Line{
+		{21500 * time.Millisecond, "Here in my car"},
+		{25100 * time.Millisecond, "I feel safest of all"},
+		{28999 * time.Millisecond, "I can lock all my doors"},
+		{100200 * time.Millisecond, "I feel safest of all"},
+	}
+	if len(lines) != len(expect) {
+		t.Fatalf("expected %d lines got %d", len(expect), len(lines))
+	}
+	for i := range expect {
+		if lines[i] != expect[i] {
+			t.Errorf("expected %v got %v", expect[i], lines[i])
+		}
+	}
+	if Format(lines[:1]) != "[00:21.50]Here in my car\n" {
+		t.Errorf("unexpected format %q", Format(lines[:1]))
+	}
+}
+
+func TestText(t *testing.T) {
+	if !Synced(lyrics) {
+		t.Errorf("expected synced")
+	}
+	if Synced("Here in my car\nI feel safest of all") {
+		t.Errorf("expected not synced")
+	}
+	text := Text("[ti:Cars]\nHere in my car\n\nI feel safest of all\n")
+	if text != "Here in my car\n\nI feel safest of all" {
+		t.Errorf("unexpected text %q", text)
+	}
+	text = Text(lyrics)
+	if text != "Here in my car\nI feel safest of all\nI can lock all my doors\nI feel safest of all" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
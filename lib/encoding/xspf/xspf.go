@@ -52,6 +52,7 @@ type TrackTag struct {
 	Album      StringTag `xml:"album" json:"album"`
 	Title      StringTag `xml:"title" json:"title"`
 	TrackNum   IntTag    `xml:"trackNum" json:"trackNum"`
+	Duration   *IntTag   `xml:"duration,omitempty" json:"duration,omitempty"`
 	Location   StringTag `xml:"location" json:"location"`
 	Image      StringTag `xml:"image" json:"image"`
 	Identifier StringTag `xml:"identifier" json:"identifier"`
@@ -144,6 +145,10 @@ func encode(e Encoder, track interface{}) error {
 					trackTag.Title = StringTag{valueField.String()}
 				case "tracknum":
 					trackTag.TrackNum = IntTag{int(valueField.Int())}
+				case "duration":
+					if d := int(valueField.Int()); d > 0 {
+						trackTag.Duration = &IntTag{d}
+					}
 				case "location":
 					trackTag.Location = StringTag{valueField.Index(0).String()}
 				case "image":
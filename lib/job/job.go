@@ -0,0 +1,104 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package job provides progress tracking for long running jobs such as media
+// sync. A Tracker is attached to a context which is passed through the sync
+// code. Progress functions are no-ops when the context has no tracker.
+package job
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey string
+
+var contextKeyTracker = contextKey("tracker")
+
+// Tracker counts progress and errors for a job.
+type Tracker struct {
+	mu        sync.Mutex
+	total     int
+	done      int
+	errors    int
+	lastError string
+}
+
+// Counts are a snapshot of tracker progress.
+type Counts struct {
+	Total     int
+	Done      int
+	Errors    int
+	LastError string
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// WithTracker returns a context with the tracker attached.
+func WithTracker(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, contextKeyTracker, t)
+}
+
+func tracker(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(contextKeyTracker).(*Tracker)
+	return t
+}
+
+// AddTotal adds n more steps of work to be done.
+func AddTotal(ctx context.Context, n int) {
+	if t := tracker(ctx); t != nil {
+		t.mu.Lock()
+		t.total += n
+		t.mu.Unlock()
+	}
+}
+
+// Step marks one step of work as done.
+func Step(ctx context.Context) {
+	if t := tracker(ctx); t != nil {
+		t.mu.Lock()
+		t.done++
+		t.mu.Unlock()
+	}
+}
+
+// Error records an error which didn't stop the job.
+func Error(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	if t := tracker(ctx); t != nil {
+		t.mu.Lock()
+		t.errors++
+		t.lastError = err.Error()
+		t.mu.Unlock()
+	}
+}
+
+// Counts returns the current progress counts.
+func (t *Tracker) Counts() Counts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Counts{
+		Total:     t.total,
+		Done:      t.done,
+		Errors:    t.errors,
+		LastError: t.lastError,
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	// no tracker is ok
+	Step(context.Background())
+
+	tracker := NewTracker()
+	ctx := WithTracker(context.Background(), tracker)
+	AddTotal(ctx, 3)
+	Step(ctx)
+	Step(ctx)
+	Error(ctx, errors.New("oops"))
+	counts := tracker.Counts()
+	if counts.Total != 3 || counts.Done != 2 || counts.Errors != 1 {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	if counts.LastError != "oops" {
+		t.Errorf("unexpected last error %s", counts.LastError)
+	}
+}
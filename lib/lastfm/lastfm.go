@@ -52,7 +52,7 @@ func (m *Lastfm) ArtistTopTracks(arid string) []TopTrack {
 		return make([]TopTrack, 0)
 	}
 
-	client.RateLimit("last.fm")
+	client.Limit("last.fm")
 	api := lfm.New(m.config.LastFM.Key, m.config.LastFM.Secret)
 
 	result, _ := api.Artist.GetTopTracks(lfm.P{"mbid": arid})
@@ -76,7 +76,7 @@ func (m *Lastfm) SimilarArtists(arid string) map[string]float64 {
 		return make(map[string]float64)
 	}
 
-	client.RateLimit("last.fm")
+	client.Limit("last.fm")
 	api := lfm.New(m.config.LastFM.Key, m.config.LastFM.Secret)
 	result, _ := api.Artist.GetSimilar(lfm.P{"mbid": arid})
 
@@ -106,7 +106,7 @@ func (m *Lastfm) ArtistSearch(name string) (string, string) {
 		return "", ""
 	}
 
-	client.RateLimit("last.fm")
+	client.Limit("last.fm")
 	api := lfm.New(m.config.LastFM.Key, m.config.LastFM.Secret)
 	result, _ := api.Artist.Search(lfm.P{"artist": name})
 
@@ -41,6 +41,11 @@ func NewMusicBrainz(config *config.Config) *MusicBrainz {
 	}
 }
 
+// UseCacheFirst uses cached responses when available, see client.UseCacheFirst.
+func (m *MusicBrainz) UseCacheFirst(enabled bool) {
+	m.client.UseCacheFirst(enabled)
+}
+
 // MusicBrainz is used for:
 // * getting the MBID for artists
 // * correcting artist names
@@ -147,15 +152,24 @@ type AttributeIds struct {
 // release-group series: type="part of", target-type="series", see series
 // release recording series: type="part of", target-type="series", see series
 // single: type="single from", target-type="release_group", see release_group
+//
+// artist: type="member of band", "collaboration" or "is person",
+// target-type="artist", direction is "forward" from the member, collaborator
+// or person and "backward" from the band, collaboration or performance name.
 type Relation struct {
 	Type         string       `json:"type"`
 	TargetType   string       `json:"target-type"`
+	Direction    string       `json:"direction"`
+	Begin        string       `json:"begin"`
+	End          string       `json:"end"`
+	Ended        bool         `json:"ended"`
 	Artist       Artist       `json:"artist"`
 	Attributes   []string     `json:"attributes"`
 	AttributeIds AttributeIds `json:"attribute-ids"`
 	Work         Work         `json:"work"`
 	URL          URL          `json:"url"`
 	Series       Series       `json:"series"`
+	OrderingKey  int          `json:"ordering-key"`
 }
 
 type LabelInfo struct {
@@ -224,6 +238,12 @@ type ReleasesPage struct {
 	Count    int       `json:"release-count"`
 }
 
+type ReleaseGroupsPage struct {
+	ReleaseGroups []ReleaseGroup `json:"release-groups"`
+	Offset        int            `json:"release-group-offset"`
+	Count         int            `json:"release-group-count"`
+}
+
 type CoverArtArchive struct {
 	Count    int  `json:"count"`
 	Artwork  bool `json:"artwork"`
@@ -431,6 +451,34 @@ func (m *MusicBrainz) doArtistReleases(arid string, limit int, offset int) (*Rel
 	return &result, err
 }
 
+// ArtistReleaseGroups gets all release groups for an artist, including
+// announced release groups with a future first release date. Cached
+// responses older than maxAge are fetched again.
+func (m *MusicBrainz) ArtistReleaseGroups(arid string, maxAge time.Duration) ([]ReleaseGroup, error) {
+	var groups []ReleaseGroup
+	limit, offset := 100, 0
+	for {
+		result, err := m.doArtistReleaseGroups(arid, maxAge, limit, offset)
+		if err != nil {
+			return groups, err
+		}
+		groups = append(groups, result.ReleaseGroups...)
+		offset += len(result.ReleaseGroups)
+		if len(result.ReleaseGroups) == 0 || offset >= result.Count {
+			break
+		}
+	}
+	return groups, nil
+}
+
+func (m *MusicBrainz) doArtistReleaseGroups(arid string, maxAge time.Duration, limit int, offset int) (*ReleaseGroupsPage, error) {
+	var result ReleaseGroupsPage
+	url := fmt.Sprintf("https://musicbrainz.org/ws/2/release-group?fmt=json&artist=%s&limit=%d&offset=%d",
+		arid, limit, offset)
+	err := m.client.GetJsonMaxAge(url, maxAge, &result)
+	return &result, err
+}
+
 func (m *MusicBrainz) Release(reid string) (*Release, error) {
 	inc := []string{"aliases", "artist-credits", "labels",
 		"discids", "recordings", "artist-rels",
@@ -571,7 +619,7 @@ func (m *MusicBrainz) doArtistSearch(query string, limit int, offset int) (*Arti
 
 func (m *MusicBrainz) ArtistDetail(arid string) (*Artist, error) {
 	var result Artist
-	url := fmt.Sprintf(`http://musicbrainz.org/ws/2/artist/%s?fmt=json&inc=genres+url-rels`,
+	url := fmt.Sprintf(`http://musicbrainz.org/ws/2/artist/%s?fmt=json&inc=genres+url-rels+artist-rels`,
 		arid)
 	err := m.client.GetJson(url, &result)
 	return &result, err
@@ -0,0 +1,37 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package pool
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	var count int32
+	p := NewPool(4)
+	for i := 0; i < 100; i++ {
+		p.Submit(func() {
+			atomic.AddInt32(&count, 1)
+		})
+	}
+	p.Wait()
+	if count != 100 {
+		t.Errorf("expected 100 got %d", count)
+	}
+}
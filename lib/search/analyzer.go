@@ -0,0 +1,79 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/char/asciifolding"
+	"github.com/blevesearch/bleve/v2/analysis/char/regexp"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+const (
+	textAnalyzer = "takeout_text"
+
+	charFilterAbbrev    = "takeout_abbrev"
+	charFilterAmpersand = "takeout_ampersand"
+)
+
+// Text is folded to ASCII so Björk matches bjork, and punctuation within
+// names is removed so R.E.M. matches rem and Guns N' Roses matches guns n
+// roses. Names like AC/DC are split into words by the tokenizer.
+var textCharFilters = []string{
+	asciifolding.Name,
+	charFilterAbbrev,
+	charFilterAmpersand,
+}
+
+func addCharFilters(m *mapping.IndexMappingImpl) error {
+	err := m.AddCustomCharFilter(charFilterAbbrev, map[string]interface{}{
+		"type":    regexp.Name,
+		"regexp":  `(\pL)['’.]`,
+		"replace": "$1",
+	})
+	if err != nil {
+		return err
+	}
+	return m.AddCustomCharFilter(charFilterAmpersand, map[string]interface{}{
+		"type":    regexp.Name,
+		"regexp":  `&`,
+		"replace": " and ",
+	})
+}
+
+// addTextAnalyzer adds the analyzer used for text fields with optional
+// English stemming.
+func addTextAnalyzer(m *mapping.IndexMappingImpl, stemming bool) error {
+	err := addCharFilters(m)
+	if err != nil {
+		return err
+	}
+	filters := []string{lowercase.Name}
+	if stemming {
+		filters = append(filters, en.PossessiveName, en.SnowballStemmerName)
+	}
+	return m.AddCustomAnalyzer(textAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  textCharFilters,
+		"tokenizer":     unicode.Name,
+		"token_filters": filters,
+	})
+}
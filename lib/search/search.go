@@ -18,19 +18,50 @@
 package search
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	bsearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
 	"github.com/defsub/takeout/config"
-	"strings"
+	"github.com/defsub/takeout/lib/str"
+)
+
+const (
+	SortRelevance  = "relevance"
+	SortDate       = "date"
+	SortPopularity = "popularity"
+	SortTitle      = "title"
+
+	FacetDecade = "decade"
+
+	facetFirstDecade = 1900
+)
+
+var (
+	ErrInvalidSort = errors.New("invalid sort")
 )
 
 type FieldMap map[string]interface{}
 type IndexMap map[string]FieldMap
 
+// IndexVersion changes whenever the index mapping changes. Indexes created
+// with a different version are stale and should be rebuilt.
+const IndexVersion = 4
+
+var versionKey = []byte("takeout_index_version")
+
 type Search struct {
 	config   config.SearchConfig
 	index    bleve.Index
+	path     string
 	Keywords []string
 }
 
@@ -40,6 +71,12 @@ func NewSearch(config *config.Config) *Search {
 
 func (s *Search) Open(name string) error {
 	mapping := bleve.NewIndexMapping()
+	err := addTextAnalyzer(mapping, s.config.Stemming)
+	if err != nil {
+		return err
+	}
+	mapping.DefaultAnalyzer = textAnalyzer
+
 	// Note that keywords are fields where we want only exact matches.
 	// see https://blevesearch.com/docs/Analyzers/
 	keywordFieldMapping := bleve.NewTextFieldMapping()
@@ -51,15 +88,14 @@ func (s *Search) Open(name string) error {
 	mapping.AddDocumentMapping("_default", keywordMapping)
 
 	path := fmt.Sprintf("%s/%s.bleve", s.config.BleveDir, name)
+	s.path = path
 	index, err := bleve.New(path, mapping)
 	if err == bleve.ErrorIndexPathExists {
 		index, err = bleve.Open(path)
 		if err != nil {
-			fmt.Printf("bleve %s err %s\n", path, err)
 			return err
 		}
 	} else if err != nil {
-		fmt.Printf("bleve %s err %s\n", path, err)
 		return err
 	}
 	s.index = index
@@ -67,6 +103,43 @@ func (s *Search) Open(name string) error {
 	return nil
 }
 
+// version is the index version with the analyzer options used.
+func (s *Search) version() string {
+	v := strconv.Itoa(IndexVersion)
+	if s.config.Stemming {
+		v += "-stem"
+	}
+	return v
+}
+
+// Stale is true when the index was created with a different mapping or
+// hasn't been fully indexed since it was created.
+func (s *Search) Stale() bool {
+	v, err := s.index.GetInternal(versionKey)
+	if err != nil {
+		return true
+	}
+	return string(v) != s.version()
+}
+
+// Reset removes the index and creates a new empty stale index using the
+// current mapping.
+func (s *Search) Reset(name string) error {
+	s.Close()
+	if s.path != "" {
+		err := os.RemoveAll(s.path)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Open(name)
+}
+
+// Indexed marks the index as current after everything has been indexed.
+func (s *Search) Indexed() error {
+	return s.index.SetInternal(versionKey, []byte(s.version()))
+}
+
 func (s *Search) Close() {
 	if s.index != nil {
 		s.index.Close()
@@ -91,6 +164,236 @@ func (s *Search) Search(q string, limit int) ([]string, error) {
 	return keys, nil
 }
 
+// Request is a query with paging, sort order and facets. An empty query
+// matches all documents.
+type Request struct {
+	Query  string
+	Offset int
+	Size   int
+	// Sort is a bleve sort order, see SortOrder.
+	Sort []string
+	// Facets are fields to count terms, which should be keywords.
+	Facets    []string
+	FacetSize int
+	// Decades is an optional date field to count by decade.
+	Decades string
+}
+
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// FacetTerm is a facet value with a count and a query which can be added to
+// the original query to refine the results.
+type FacetTerm struct {
+	Term  string
+	Count int
+	Query string
+}
+
+type Facet struct {
+	Field   string
+	Total   int
+	Missing int
+	Other   int
+	Terms   []FacetTerm
+}
+
+type Result struct {
+	Total    int
+	MaxScore float64
+	Hits     []Hit
+	Facets   map[string]Facet
+}
+
+func (r *Result) Keys() []string {
+	var keys []string
+	for _, h := range r.Hits {
+		keys = append(keys, h.ID)
+	}
+	return keys
+}
+
+// ValidSort checks the sort name, optionally prefixed with - to reverse the
+// order.
+func ValidSort(sort string) bool {
+	switch strings.TrimPrefix(sort, "-") {
+	case "", SortRelevance, SortDate, SortPopularity, SortTitle:
+		return true
+	}
+	return false
+}
+
+// SortOrder converts a sort name into a bleve sort order using the media
+// specific fields for each sort name. Fields are prefixed with - for
+// descending order and sort names prefixed with - reverse that order. Ties
+// are ordered by relevance.
+func SortOrder(sort string, fields map[string]string) ([]string, error) {
+	if !ValidSort(sort) {
+		return nil, ErrInvalidSort
+	}
+	reverse := strings.HasPrefix(sort, "-")
+	sort = strings.TrimPrefix(sort, "-")
+	if sort == "" || sort == SortRelevance {
+		if reverse {
+			return []string{"_score"}, nil
+		}
+		return []string{"-_score"}, nil
+	}
+	field, ok := fields[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	if reverse {
+		if strings.HasPrefix(field, "-") {
+			field = strings.TrimPrefix(field, "-")
+		} else {
+			field = "-" + field
+		}
+	}
+	return []string{field, "-_score"}, nil
+}
+
+// Query searches using the request and returns the hits with scores along
+// with the requested facets.
+func (s *Search) Query(r Request) (*Result, error) {
+	var q query.Query
+	if r.Query == "" {
+		q = bleve.NewMatchAllQuery()
+	} else {
+		q = bleve.NewQueryStringQuery(r.Query)
+	}
+	req := bleve.NewSearchRequestOptions(q, r.Size, r.Offset, false)
+	if len(r.Sort) > 0 {
+		req.SortBy(r.Sort)
+	}
+	size := r.FacetSize
+	if size == 0 {
+		size = 10
+	}
+	for _, f := range r.Facets {
+		req.AddFacet(f, bleve.NewFacetRequest(f, size))
+	}
+	if r.Decades != "" {
+		req.AddFacet(FacetDecade, decadeFacet(r.Decades))
+	}
+	searchResult, err := s.index.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Total:    int(searchResult.Total),
+		MaxScore: searchResult.MaxScore,
+		Facets:   make(map[string]Facet),
+	}
+	for _, hit := range searchResult.Hits {
+		result.Hits = append(result.Hits, Hit{ID: hit.ID, Score: hit.Score})
+	}
+	for name, fr := range searchResult.Facets {
+		result.Facets[name] = facetResult(fr)
+	}
+	return result, nil
+}
+
+func decadeFacet(field string) *bleve.FacetRequest {
+	last := time.Now().Year()
+	f := bleve.NewFacetRequest(field, last/10-facetFirstDecade/10+1)
+	for year := facetFirstDecade; year <= last; year += 10 {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		f.AddDateTimeRange(fmt.Sprintf("%ds", year), start, start.AddDate(10, 0, 0))
+	}
+	return f
+}
+
+func facetResult(fr *bsearch.FacetResult) Facet {
+	facet := Facet{
+		Field:   fr.Field,
+		Total:   fr.Total,
+		Missing: fr.Missing,
+		Other:   fr.Other,
+	}
+	for _, t := range fr.Terms {
+		facet.Terms = append(facet.Terms, FacetTerm{
+			Term:  t.Term,
+			Count: t.Count,
+			Query: fmt.Sprintf(`+%s:"%s"`, fr.Field, quote(t.Term)),
+		})
+	}
+	ranges := fr.DateRanges
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Name < ranges[j].Name
+	})
+	for _, d := range ranges {
+		if d.Count == 0 || d.Start == nil || d.End == nil {
+			continue
+		}
+		facet.Terms = append(facet.Terms, FacetTerm{
+			Term:  d.Name,
+			Count: d.Count,
+			Query: fmt.Sprintf(`+%s:>="%s" +%s:<"%s"`,
+				fr.Field, ymd(*d.Start), fr.Field, ymd(*d.End)),
+		})
+	}
+	return facet
+}
+
+func quote(term string) string {
+	return strings.Replace(term, `"`, `\"`, -1)
+}
+
+func ymd(date string) string {
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return date
+	}
+	return t.Format("2006-01-02")
+}
+
+// Report has the results of checking an index against the database.
+type Report struct {
+	Documents  int
+	Stale      bool
+	Unresolved []string
+}
+
+// Verify checks that each document key still resolves to something in the
+// database. The resolve func returns the keys which exist.
+func (s *Search) Verify(resolve func(keys []string) []string) (*Report, error) {
+	count, err := s.index.DocCount()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Documents: int(count), Stale: s.Stale()}
+
+	// page through all documents in key order
+	batchSize := 100
+	for from := 0; from < report.Documents; from += batchSize {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(),
+			batchSize, from, false)
+		req.SortBy([]string{"_id"})
+		result, err := s.index.Search(req)
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		for _, hit := range result.Hits {
+			keys = append(keys, hit.ID)
+		}
+		found := make(map[string]bool)
+		for _, k := range resolve(keys) {
+			found[k] = true
+		}
+		for _, k := range keys {
+			if !found[k] {
+				report.Unresolved = append(report.Unresolved, k)
+			}
+		}
+	}
+	return report, nil
+}
+
 func (s *Search) Index(m IndexMap) {
 	for k, v := range m {
 		s.index.Index(k, v)
@@ -113,6 +416,13 @@ func CloneFields(fields FieldMap) FieldMap {
 	return target
 }
 
+// SortTitleKey returns the value to index in a keyword field used to sort by
+// title. Keyword fields aren't tokenized so the whole title is used, ignoring
+// case and leading articles.
+func SortTitleKey(title string) string {
+	return strings.ToLower(str.SortTitle(title))
+}
+
 func AddField(fields FieldMap, key string, value interface{}) FieldMap {
 	key = strings.ToLower(key)
 	keys := []string{key}
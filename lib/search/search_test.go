@@ -21,6 +21,10 @@ import (
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/defsub/takeout/config"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -37,15 +41,13 @@ func buildMapping() mapping.IndexMapping {
 	return indexMapping
 }
 
-func TestIndex(t *testing.T) {
-	index, err := bleve.New("example.bleve", buildMapping())
-	if err == bleve.ErrorIndexPathExists {
-		index, err = bleve.Open("example.bleve")
-		if err != nil {
-			panic(err)
-		}
+// exampleIndex creates an index in a temporary directory with one track.
+func exampleIndex(t *testing.T) bleve.Index {
+	index, err := bleve.New(filepath.Join(t.TempDir(), "example.bleve"), buildMapping())
+	if err != nil {
+		t.Fatal(err)
 	}
-	defer index.Close()
+	t.Cleanup(func() { index.Close() })
 
 	m := make(map[string]interface{})
 
@@ -61,12 +63,26 @@ func TestIndex(t *testing.T) {
 	m["mix"] = "jim smith, joe blow"
 	m["type"] = "music"
 
-	index.Index("Music/Gary Numan/The Pleasure Principle/01-Films.flac", m)
+	err = index.Index("Music/Gary Numan/The Pleasure Principle/01-Films.flac", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestIndex(t *testing.T) {
+	index := exampleIndex(t)
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document got %d", count)
+	}
 }
 
 func TestTagsSearch(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+tags:"pop rock" +tags:"indie"`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -79,8 +95,7 @@ func TestTagsSearch(t *testing.T) {
 }
 
 func TestTagsSearch2(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+tags:"pop"`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -93,8 +108,7 @@ func TestTagsSearch2(t *testing.T) {
 }
 
 func TestTagsSearch3(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+tags:rock`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -107,8 +121,7 @@ func TestTagsSearch3(t *testing.T) {
 }
 
 func TestArtistSearch(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+artist:"numan"`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -121,8 +134,7 @@ func TestArtistSearch(t *testing.T) {
 }
 
 func TestTitleSearch(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+title:"films"`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -135,8 +147,7 @@ func TestTitleSearch(t *testing.T) {
 }
 
 func TestQuery(t *testing.T) {
-	index, _ := bleve.Open("example.bleve")
-	defer index.Close()
+	index := exampleIndex(t)
 	query := bleve.NewQueryStringQuery(`+title:"films" +artist:numan +tags:"new wave" +piano:numan`)
 	searchRequest := bleve.NewSearchRequest(query)
 	searchResult, err := index.Search(searchRequest)
@@ -147,3 +158,295 @@ func TestQuery(t *testing.T) {
 		t.Error("no hits")
 	}
 }
+
+func TestSuggest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "suggest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Suggest{config: config.SearchConfig{BleveDir: dir}}
+	err = s.Open("suggest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Add("artist", "1", "Gary Numan")
+	s.AddAll([]Suggestion{
+		{Type: "release", ID: "2", Name: "The Pleasure Principle"},
+		{Type: "track", ID: "3", Name: "Films"},
+		{Type: "track", ID: "4", Name: "Cars"},
+	})
+
+	list, err := s.Suggest("pleas", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Type != "release" || list[0].ID != "2" {
+		t.Errorf("unexpected suggestions %+v", list)
+	}
+
+	list, _ = s.Suggest("gary NU", 10)
+	if len(list) != 1 || list[0].Name != "Gary Numan" {
+		t.Errorf("unexpected suggestions %+v", list)
+	}
+
+	list, _ = s.Suggest("c", 10, "release")
+	if len(list) != 0 {
+		t.Errorf("unexpected suggestions %+v", list)
+	}
+	list, _ = s.Suggest("c", 10, "track")
+	if len(list) != 1 || list[0].Name != "Cars" {
+		t.Errorf("unexpected suggestions %+v", list)
+	}
+
+	// replace removes names no longer in the group
+	s.AddAll([]Suggestion{
+		{Type: "artist", ID: "5", Name: "Tubeway Army", Group: "5"},
+		{Type: "release", ID: "6", Name: "Replicas", Group: "5"},
+		{Type: "track", ID: "7", Name: "Down in the Park", Group: "5"},
+	})
+	s.ReplaceGroup("5", []Suggestion{
+		{Type: "artist", ID: "5", Name: "Tubeway Army", Group: "5"},
+		{Type: "release", ID: "8", Name: "Replicas - The First Recordings", Group: "5"},
+	})
+	list, _ = s.Suggest("repl", 10)
+	if len(list) != 1 || list[0].ID != "8" {
+		t.Errorf("unexpected suggestions after replace %+v", list)
+	}
+	list, _ = s.Suggest("down", 10)
+	if len(list) != 0 {
+		t.Errorf("unexpected suggestions after replace %+v", list)
+	}
+	list, _ = s.Suggest("cars", 10)
+	if len(list) != 1 {
+		t.Errorf("other groups should remain %+v", list)
+	}
+
+	// long multi-byte prefixes are truncated by rune
+	s.Add("artist", "9", "Ɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱ")
+	list, err = s.Suggest("Ɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱɱ", 10)
+	if err != nil || len(list) != 1 || list[0].ID != "9" {
+		t.Errorf("unexpected multi-byte suggestions %+v %v", list, err)
+	}
+
+	s.Reset("suggest")
+	list, _ = s.Suggest("c", 10)
+	if len(list) != 0 {
+		t.Errorf("unexpected suggestions after reset %+v", list)
+	}
+}
+
+func TestQueryRequest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Search{config: config.SearchConfig{BleveDir: dir}, Keywords: []string{"genre"}}
+	err = s.Open("query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	index := make(IndexMap)
+	index["1"] = FieldMap{"title": "Films", "genre": "new wave", "date": "1979-09-07"}
+	index["2"] = FieldMap{"title": "Cars", "genre": "new wave", "date": "1979-08-24"}
+	index["3"] = FieldMap{"title": "Complex", "genre": "synth-pop", "date": "1980-01-01"}
+	s.Index(index)
+
+	order, err := SortOrder("-date", map[string]string{SortDate: "date"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Query(Request{
+		Query:   "+title:*",
+		Size:    2,
+		Offset:  1,
+		Sort:    order,
+		Facets:  []string{"genre"},
+		Decades: "date",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || len(result.Hits) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Hits[0].ID != "1" || result.Hits[1].ID != "2" {
+		t.Errorf("unexpected order %+v", result.Hits)
+	}
+	genre := result.Facets["genre"]
+	if len(genre.Terms) != 2 || genre.Terms[0].Term != "new wave" ||
+		genre.Terms[0].Count != 2 || genre.Terms[0].Query != `+genre:"new wave"` {
+		t.Errorf("unexpected genre facet %+v", genre)
+	}
+	decade := result.Facets[FacetDecade]
+	if len(decade.Terms) != 2 || decade.Terms[0].Term != "1970s" ||
+		decade.Terms[0].Query != `+date:>="1970-01-01" +date:<"1980-01-01"` {
+		t.Errorf("unexpected decade facet %+v", decade)
+	}
+
+	result, err = s.Query(Request{Facets: []string{"genre"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || result.Facets["genre"].Total != 3 {
+		t.Errorf("expected all documents %+v", result)
+	}
+
+	_, err = SortOrder("size", nil)
+	if err != ErrInvalidSort {
+		t.Errorf("expected invalid sort")
+	}
+}
+
+func TestSortTitle(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sorttitle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Search{config: config.SearchConfig{BleveDir: dir}, Keywords: []string{"sort_title"}}
+	err = s.Open("sorttitle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// analyzed titles would sort on a single token like "zoo" or "a"
+	titles := map[string]string{
+		"1": "Zoo Station",
+		"2": "The Abyss",
+		"3": "Moon Over A Zoo",
+		"4": "A Clockwork Orange",
+	}
+	index := make(IndexMap)
+	for id, title := range titles {
+		index[id] = FieldMap{"title": title, "sort_title": SortTitleKey(title)}
+	}
+	s.Index(index)
+
+	order, err := SortOrder(SortTitle, map[string]string{SortTitle: "sort_title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Query(Request{Size: 10, Sort: order})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, h := range result.Hits {
+		ids = append(ids, h.ID)
+	}
+	if strings.Join(ids, ",") != "2,4,3,1" {
+		t.Errorf("unexpected title order %v", ids)
+	}
+}
+
+func TestFolding(t *testing.T) {
+	dir, err := os.MkdirTemp("", "folding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Search{config: config.SearchConfig{BleveDir: dir}}
+	err = s.Open("folding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.Stale() {
+		t.Error("new index should be stale")
+	}
+
+	index := make(IndexMap)
+	index["1"] = FieldMap{"artist": "Björk"}
+	index["2"] = FieldMap{"artist": "Motörhead"}
+	index["3"] = FieldMap{"artist": "Sigur Rós"}
+	index["4"] = FieldMap{"artist": "AC/DC"}
+	index["5"] = FieldMap{"artist": "R.E.M."}
+	index["6"] = FieldMap{"artist": "Guns N' Roses"}
+	index["7"] = FieldMap{"artist": "Simon & Garfunkel"}
+	s.Index(index)
+	s.Indexed()
+	if s.Stale() {
+		t.Error("index should not be stale")
+	}
+
+	tests := map[string]string{
+		`+artist:bjork`:                 "1",
+		`+motorhead`:                    "2",
+		`+artist:"sigur ros"`:           "3",
+		`+artist:"ac dc"`:               "4",
+		`+artist:rem`:                   "5",
+		`+artist:"guns n roses"`:        "6",
+		`+artist:"simon and garfunkel"`: "7",
+		`+artist:"Björk"`:               "1",
+	}
+	for q, id := range tests {
+		keys, err := s.Search(q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != id {
+			t.Errorf("%s: expected %s got %v", q, id, keys)
+		}
+	}
+
+	err = s.Reset("folding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Stale() {
+		t.Error("reset index should be stale")
+	}
+	keys, _ := s.Search("+bjork", 10)
+	if len(keys) != 0 {
+		t.Errorf("expected empty index got %v", keys)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := os.MkdirTemp("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Search{config: config.SearchConfig{BleveDir: dir}}
+	err = s.Open("verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	index := make(IndexMap)
+	for _, k := range []string{"a", "b", "c"} {
+		index[k] = FieldMap{"title": k}
+	}
+	s.Index(index)
+
+	report, err := s.Verify(func(keys []string) []string {
+		var found []string
+		for _, k := range keys {
+			if k != "b" {
+				found = append(found, k)
+			}
+		}
+		return found
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Documents != 3 || !report.Stale ||
+		len(report.Unresolved) != 1 || report.Unresolved[0] != "b" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
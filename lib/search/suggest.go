@@ -0,0 +1,279 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/defsub/takeout/config"
+)
+
+const (
+	suggestEdgeNgram     = "suggest_edge_ngram"
+	suggestIndexAnalyzer = "suggest_index"
+	suggestQueryAnalyzer = "suggest_query"
+
+	suggestFieldType  = "type"
+	suggestFieldID    = "id"
+	suggestFieldName  = "name"
+	suggestFieldGroup = "group"
+
+	suggestMaxPrefix = 20
+)
+
+// Suggestion is a completion for a name prefix. Group optionally ties the
+// suggestion to the media that owns it, like the artist of a release, so
+// all of its suggestions can be replaced together.
+type Suggestion struct {
+	Type  string
+	ID    string
+	Name  string
+	Score float64
+	Group string `json:"-"`
+}
+
+// Suggest is a side index of names used for type-ahead completion. Each name
+// is indexed with edge n-grams so prefix matches are simple term lookups.
+type Suggest struct {
+	config config.SearchConfig
+	index  bleve.Index
+	path   string
+}
+
+func NewSuggest(config *config.Config) *Suggest {
+	return &Suggest{config: config.Search}
+}
+
+func (s *Suggest) Open(name string) error {
+	mapping := bleve.NewIndexMapping()
+	err := addCharFilters(mapping)
+	if err != nil {
+		return err
+	}
+	err = mapping.AddCustomTokenFilter(suggestEdgeNgram, map[string]interface{}{
+		"type": edgengram.Name,
+		"min":  1.0,
+		"max":  float64(suggestMaxPrefix),
+	})
+	if err != nil {
+		return err
+	}
+	err = mapping.AddCustomAnalyzer(suggestIndexAnalyzer, map[string]interface{}{
+		"type":         custom.Name,
+		"char_filters": textCharFilters,
+		"tokenizer":    unicode.Name,
+		"token_filters": []string{
+			lowercase.Name,
+			suggestEdgeNgram,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = mapping.AddCustomAnalyzer(suggestQueryAnalyzer, map[string]interface{}{
+		"type":         custom.Name,
+		"char_filters": textCharFilters,
+		"tokenizer":    unicode.Name,
+		"token_filters": []string{
+			lowercase.Name,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	keywordFieldMapping := bleve.NewTextFieldMapping()
+	keywordFieldMapping.Analyzer = keyword.Name
+	keywordFieldMapping.IncludeTermVectors = false
+	nameFieldMapping := bleve.NewTextFieldMapping()
+	nameFieldMapping.Analyzer = suggestIndexAnalyzer
+	nameFieldMapping.IncludeTermVectors = false
+
+	docMapping := bleve.NewDocumentMapping()
+	docMapping.AddFieldMappingsAt(suggestFieldType, keywordFieldMapping)
+	docMapping.AddFieldMappingsAt(suggestFieldID, keywordFieldMapping)
+	docMapping.AddFieldMappingsAt(suggestFieldName, nameFieldMapping)
+	docMapping.AddFieldMappingsAt(suggestFieldGroup, keywordFieldMapping)
+	mapping.AddDocumentMapping("_default", docMapping)
+
+	path := fmt.Sprintf("%s/%s.bleve", s.config.BleveDir, name)
+	s.path = path
+	index, err := bleve.New(path, mapping)
+	if err == bleve.ErrorIndexPathExists {
+		index, err = bleve.Open(path)
+		if err != nil {
+			fmt.Printf("bleve %s err %s\n", path, err)
+			return err
+		}
+	} else if err != nil {
+		fmt.Printf("bleve %s err %s\n", path, err)
+		return err
+	}
+	s.index = index
+
+	return nil
+}
+
+func (s *Suggest) Close() {
+	if s.index != nil {
+		s.index.Close()
+		s.index = nil
+	}
+}
+
+// Reset removes all names from the index.
+func (s *Suggest) Reset(name string) error {
+	s.Close()
+	if s.path != "" {
+		err := os.RemoveAll(s.path)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Open(name)
+}
+
+func suggestKey(t, id string) string {
+	return t + ":" + id
+}
+
+// Add adds or replaces the name for the entity type and id.
+func (s *Suggest) Add(t, id, name string) error {
+	return s.index.Index(suggestKey(t, id), map[string]interface{}{
+		suggestFieldType: t,
+		suggestFieldID:   id,
+		suggestFieldName: name,
+	})
+}
+
+// AddAll adds or replaces names in a single batch.
+func (s *Suggest) AddAll(list []Suggestion) error {
+	b := s.index.NewBatch()
+	for _, sg := range list {
+		err := b.Index(suggestKey(sg.Type, sg.ID), map[string]interface{}{
+			suggestFieldType:  sg.Type,
+			suggestFieldID:    sg.ID,
+			suggestFieldName:  sg.Name,
+			suggestFieldGroup: sg.Group,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.index.Batch(b)
+}
+
+// Delete removes the name for the entity type and id.
+func (s *Suggest) Delete(t, id string) error {
+	return s.index.Delete(suggestKey(t, id))
+}
+
+// DeleteGroup removes all names in the group.
+func (s *Suggest) DeleteGroup(group string) error {
+	if group == "" {
+		return nil
+	}
+	q := bleve.NewTermQuery(group)
+	q.SetField(suggestFieldGroup)
+	for {
+		request := bleve.NewSearchRequest(q)
+		request.Size = 1000
+		result, err := s.index.Search(request)
+		if err != nil {
+			return err
+		}
+		if len(result.Hits) == 0 {
+			return nil
+		}
+		b := s.index.NewBatch()
+		for _, hit := range result.Hits {
+			b.Delete(hit.ID)
+		}
+		err = s.index.Batch(b)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReplaceGroup removes all names in the group and adds the new list.
+func (s *Suggest) ReplaceGroup(group string, list []Suggestion) error {
+	err := s.DeleteGroup(group)
+	if err != nil {
+		return err
+	}
+	return s.AddAll(list)
+}
+
+// Suggest returns names where each word in the prefix matches the start of a
+// word in the name, ranked by score. Optional types limit results to those
+// entity types.
+func (s *Suggest) Suggest(prefix string, limit int, types ...string) ([]Suggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return []Suggestion{}, nil
+	}
+
+	var terms []query.Query
+	for _, word := range strings.Fields(prefix) {
+		if r := []rune(word); len(r) > suggestMaxPrefix {
+			word = string(r[:suggestMaxPrefix])
+		}
+		q := bleve.NewMatchQuery(word)
+		q.SetField(suggestFieldName)
+		q.Analyzer = suggestQueryAnalyzer
+		terms = append(terms, q)
+	}
+	conjuncts := bleve.NewConjunctionQuery(terms...)
+	if len(types) > 0 {
+		var disjuncts []query.Query
+		for _, t := range types {
+			q := bleve.NewTermQuery(t)
+			q.SetField(suggestFieldType)
+			disjuncts = append(disjuncts, q)
+		}
+		conjuncts.AddQuery(bleve.NewDisjunctionQuery(disjuncts...))
+	}
+
+	request := bleve.NewSearchRequest(conjuncts)
+	request.Size = limit
+	request.Fields = []string{suggestFieldType, suggestFieldID, suggestFieldName}
+	result, err := s.index.Search(request)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Suggestion, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		sg := Suggestion{Score: hit.Score}
+		sg.Type, _ = hit.Fields[suggestFieldType].(string)
+		sg.ID, _ = hit.Fields[suggestFieldID].(string)
+		sg.Name, _ = hit.Fields[suggestFieldName].(string)
+		list = append(list, sg)
+	}
+	return list, nil
+}
@@ -18,11 +18,19 @@
 package setlist
 
 import (
-	"fmt"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
 	"github.com/defsub/takeout/config"
 	"github.com/defsub/takeout/lib/client"
 )
 
+var (
+	ErrMissingKey = errors.New("setlist.fm api key not configured")
+)
+
 type Setlist struct {
 	config *config.Config
 	client *client.Client
@@ -35,7 +43,7 @@ func NewSetlist(config *config.Config, client *client.Client) *Setlist {
 	}
 }
 
-type setlistArtist struct {
+type Artist struct {
 	Mbid           string `json:"mbid"`
 	Tmid           int    `json:"tmid"`
 	Name           string `json:"name"`
@@ -44,57 +52,82 @@ type setlistArtist struct {
 	Url            string `json:"url"`
 }
 
-type setlistCountry struct {
+type Country struct {
 	Name string `json:"name"`
 	Code string `json:"code"`
 }
 
-type setlistCity struct {
-	Id        string         `json:"id"`
-	Name      string         `json:"name"`
-	State     string         `json:"state"`
-	StateCode string         `json:"stateCode"`
-	Country   setlistCountry `json:"country"`
+type City struct {
+	Id        string  `json:"id"`
+	Name      string  `json:"name"`
+	State     string  `json:"state"`
+	StateCode string  `json:"stateCode"`
+	Country   Country `json:"country"`
 }
 
-type setlistVenue struct {
-	Id   string      `json:"id"`
-	Name string      `json:"name"`
-	Url  string      `json:"url"`
-	City setlistCity `json:"city"`
+type Venue struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	City City   `json:"city"`
 }
 
-type setlistTour struct {
+type Tour struct {
 	Name string `json:"name"`
 }
 
-type setlistSong struct {
+type Song struct {
 	Name string `json:"name"`
 	Info string `json:"info"`
 	Tape bool   `json:"tape"`
 }
 
-type setlistSet struct {
-	Encore int           `json:"encore"`
-	Name   string        `json:"name"`
-	Songs  []setlistSong `json:"song"`
+type Set struct {
+	Encore int    `json:"encore"`
+	Name   string `json:"name"`
+	Songs  []Song `json:"song"`
 }
 
-type setlistSets struct {
-	Set []setlistSet `json:"set"`
+type Sets struct {
+	Set []Set `json:"set"`
+}
+
+// Concert is a setlist for an artist at an event.
+type Concert struct {
+	Id          string `json:"id"`
+	VersionId   string `json:"versionId"`
+	EventDate   string `json:"eventDate"`
+	LastUpdated string `json:"lastUpdated"`
+	Artist      Artist `json:"artist"`
+	Venue       Venue  `json:"venue"`
+	Tour        Tour   `json:"tour"`
+	Sets        Sets   `json:"sets"`
+	Info        string `json:"info"`
+	Url         string `json:"url"`
+}
+
+// Date is the event date, which is dd-MM-yyyy.
+func (c Concert) Date() time.Time {
+	t, err := time.Parse("02-01-2006", c.EventDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
 }
 
-type setlist struct {
-	Id          string        `json:"id"`
-	VersionId   string        `json:"versionId"`
-	EventDate   string        `json:"eventDate"`
-	LastUpdated string        `json:"lastUpdated"`
-	Artist      setlistArtist `json:"artist"`
-	Venue       setlistVenue  `json:"venue"`
-	Tour        setlistTour   `json:"tour"`
-	Sets        setlistSets   `json:"sets"`
-	Info        string        `json:"info"`
-	Url         string        `json:"url"`
+// Songs are the songs played in order, including encores. Songs played from
+// tape are not included.
+func (c Concert) Songs() []Song {
+	var songs []Song
+	for _, set := range c.Sets.Set {
+		for _, s := range set.Songs {
+			if s.Tape || s.Name == "" {
+				continue
+			}
+			songs = append(songs, s)
+		}
+	}
+	return songs
 }
 
 type setlistResponse struct {
@@ -102,41 +135,59 @@ type setlistResponse struct {
 	ItemsPerPage int       `json:"itemsPerPage"`
 	Page         int       `json:"page"`
 	Total        int       `json:"total"`
-	Setlist      []setlist `json:"setlist"`
+	Setlist      []Concert `json:"setlist"`
 }
 
-func (s *Setlist) ArtistYear(arid string, year int) []setlist {
-	format := fmt.Sprintf("https://api.setlist.fm/rest/1.0/search/setlists?artistMbid=%s&year=%d",
-		arid, year)
-	return setlistFetch(format + "&page=%d")
+const searchURL = "https://api.setlist.fm/rest/1.0/search/setlists"
+
+// ArtistYear returns the artist's concerts during the year.
+func (s *Setlist) ArtistYear(arid string, year int) ([]Concert, error) {
+	params := url.Values{}
+	params.Set("artistMbid", arid)
+	params.Set("year", strconv.Itoa(year))
+	return s.setlistFetch(searchURL, params)
 }
 
-func (s *Setlist) setlistFetch(format string) []setlist {
-	var list []setlist
-	total := 0
+// ArtistTour returns the artist's concerts during the tour.
+func (s *Setlist) ArtistTour(arid string, tour string) ([]Concert, error) {
+	params := url.Values{}
+	params.Set("artistMbid", arid)
+	params.Set("tourName", tour)
+	return s.setlistFetch(searchURL, params)
+}
+
+// pageURL returns the search url for page, with params escaped.
+func pageURL(base string, params url.Values, page int) string {
+	params.Set("p", strconv.Itoa(page))
+	return base + "?" + params.Encode()
+}
+
+func (s *Setlist) setlistFetch(base string, params url.Values) ([]Concert, error) {
+	var list []Concert
 
 	for page := 1; ; page++ {
-		url := fmt.Sprintf(format, page)
-		result := s.setlistPage(url)
-		fmt.Printf("page %d, items per page %d, total %d\n",
-			result.Page, result.ItemsPerPage, result.Total)
+		result, err := s.setlistPage(pageURL(base, params, page))
+		if err != nil {
+			return list, err
+		}
 		list = append(list, result.Setlist...)
-		total += len(result.Setlist)
-		if total >= result.Total {
+		if len(result.Setlist) == 0 || len(list) >= result.Total {
 			break
 		}
 	}
 
-	return list
+	return list, nil
 }
 
-func (s *Setlist) setlistPage(url string) *setlistResponse {
-	fmt.Printf("url %s\n", url)
+func (s *Setlist) setlistPage(url string) (*setlistResponse, error) {
+	if s.config.Setlist.ApiKey == "" {
+		return nil, ErrMissingKey
+	}
 	headers := map[string]string{
 		"Accept":    "application/json",
-		"x-api-key": "TGRHYagNV144XhA74sNfNPqoa443ClIjUabD",
+		"x-api-key": s.config.Setlist.ApiKey,
 	}
 	var result setlistResponse
-	s.client.GetJsonWith(headers, url, &result)
-	return &result
+	err := s.client.GetJsonWith(headers, url, &result)
+	return &result, err
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/defsub/takeout/lib/client"
 	"testing"
 	"fmt"
+	"net/url"
 )
 
 func TestSetlist(t *testing.T) {
@@ -38,7 +39,10 @@ func TestSetlist(t *testing.T) {
 	}
 
 	s := NewSetlist(config, client.NewClient(&config.Client))
-	result := s.ArtistYear(arid, 2001)
+	result, err := s.ArtistYear(arid, 2001)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for _, sl := range result {
 		fmt.Printf("%s %s @ %s, %s, %s\n", sl.Tour.Name, sl.EventDate,
@@ -52,3 +56,30 @@ func TestSetlist(t *testing.T) {
 		}
 	}
 }
+
+func TestPageURL(t *testing.T) {
+	params := url.Values{}
+	params.Set("artistMbid", "6cb79cb2-9087-44d4-828b-5c6fdff2c957")
+	params.Set("tourName", "Rock 'n' Röll & Tour 100%")
+
+	u, err := url.Parse(pageURL(searchURL, params, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("tourName") != "Rock 'n' Röll & Tour 100%" {
+		t.Errorf("tourName %q", q.Get("tourName"))
+	}
+	if q.Get("p") != "2" {
+		t.Errorf("p %q", q.Get("p"))
+	}
+	if u.Scheme+"://"+u.Host+u.Path != searchURL {
+		t.Errorf("url %s", u)
+	}
+
+	// the page is replaced, not appended
+	u, _ = url.Parse(pageURL(searchURL, params, 3))
+	if p := u.Query()["p"]; len(p) != 1 || p[0] != "3" {
+		t.Errorf("p %v", p)
+	}
+}
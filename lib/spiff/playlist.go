@@ -31,13 +31,15 @@ type Header struct {
 	Image    string  `json:"image,omitempty"`
 	Location string  `json:"location,omitempty"`
 	Date     string  `json:"date,omitempty"` // "2005-01-08T17:10:47-05:00",
+	Duration int     `json:"duration,omitempty"` // total of entry durations
 }
 
 type Playlist struct {
-	Spiff    Spiff   `json:"playlist"`
-	Index    int     `json:"index"`
-	Position float64 `json:"position"`
-	Type     string  `json:"type"`
+	Spiff    Spiff    `json:"playlist"`
+	Index    int      `json:"index"`
+	Position float64  `json:"position"`
+	Type     string   `json:"type"`
+	Missing  []string `json:"missing,omitempty"` // resolved songs not in the library
 }
 
 type Spiff struct {
@@ -60,6 +62,11 @@ type Entry struct {
 	Identifier []string `json:"identifier,omitempty" spiff:"identifier"`
 	Size       []int64  `json:"size,omitempty"`
 	Date       string   `json:"date,omitempty" spiff:"date"` // "2005-01-08T17:10:47-05:00",
+	Duration   int      `json:"duration,omitempty" spiff:"duration"` // milliseconds
+	TrackGain  float64  `json:"trackGain,omitempty"`                 // ReplayGain dB
+	TrackPeak  float64  `json:"trackPeak,omitempty"`
+	AlbumGain  float64  `json:"albumGain,omitempty"`
+	AlbumPeak  float64  `json:"albumPeak,omitempty"`
 }
 
 const (
@@ -70,7 +77,7 @@ const (
 )
 
 func NewPlaylist(listType string) *Playlist {
-	return &Playlist{Spiff{Header{}, []Entry{}}, -1, 0, listType}
+	return &Playlist{Spiff{Header{}, []Entry{}}, -1, 0, listType, nil}
 }
 
 func Unmarshal(data []byte) (*Playlist, error) {
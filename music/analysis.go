@@ -0,0 +1,199 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/defsub/takeout/lib/analysis"
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/log"
+	"github.com/defsub/takeout/lib/search"
+)
+
+var (
+	ErrAnalysisNotFound = errors.New("analysis not found")
+)
+
+// SyncAnalysis streams tracks that haven't been analyzed through ffmpeg,
+// updates the album gain for each folder with new results and then reindexes
+// the releases. Tracks are analyzed again, including tracks that failed,
+// only when the etag changes.
+func (m *Music) SyncAnalysis(ctx context.Context) error {
+	if len(m.buckets) == 0 {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var syncErr error
+	folders := make(map[string]bool)
+	tracks := m.tracksWithoutAnalysis()
+	p := m.syncPool()
+	job.AddTotal(ctx, len(tracks))
+	for _, t := range tracks {
+		if ctx.Err() != nil {
+			break
+		}
+		t := t
+		p.Submit(func() {
+			defer job.Step(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			result, err := m.analyzer.Analyze(ctx, m.bucketURL(&t).String())
+			// serialize database updates
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("analysis %s: %s\n", t.Key, err)
+					// don't try again unless the track changes
+					m.updateTrackAnalysisETag(t)
+				}
+				return
+			}
+			if syncErr != nil {
+				return
+			}
+			a := newAnalysis(t.ETag, result)
+			syncErr = m.saveAnalysis(&a)
+			folders[t.folder()] = true
+		})
+	}
+	p.Wait()
+	if syncErr != nil {
+		return syncErr
+	}
+
+	reids := make(map[string]bool)
+	for folder := range folders {
+		tracks, err := m.updateAlbumGain(folder)
+		if err != nil {
+			return err
+		}
+		for _, t := range tracks {
+			if t.REID != "" {
+				reids[t.REID] = true
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	var list []string
+	for reid := range reids {
+		list = append(list, reid)
+	}
+	return m.reindexReleases(list)
+}
+
+func newAnalysis(etag string, r *analysis.Result) Analysis {
+	a := Analysis{
+		ETag:       etag,
+		Codec:      r.Codec,
+		Bitrate:    r.Bitrate / 1000,
+		SampleRate: r.SampleRate,
+		Channels:   r.Channels,
+		BitDepth:   r.BitDepth,
+		Loudness:   r.Loudness,
+		BPM:        r.BPM,
+	}
+	if r.Loudness != 0 {
+		a.TrackGain = analysis.TrackGain(r.Loudness)
+		a.TrackPeak = analysis.PeakAmplitude(r.Peak)
+	}
+	return a
+}
+
+// updateAlbumGain uses the loudness of the analyzed tracks in the folder to
+// update the album gain and peak.
+func (m *Music) updateAlbumGain(folder string) ([]Track, error) {
+	tracks := m.folderTracks(folder)
+	var list []*Analysis
+	var loudness, durations []float64
+	albumPeak := 0.0
+	for _, t := range tracks {
+		a, err := m.trackAnalysis(t.ETag)
+		if err != nil {
+			continue
+		}
+		list = append(list, a)
+		if a.Loudness != 0 {
+			loudness = append(loudness, a.Loudness)
+			durations = append(durations, float64(t.Duration)/1000)
+		}
+		if a.TrackPeak > albumPeak {
+			albumPeak = a.TrackPeak
+		}
+	}
+	if len(loudness) == 0 {
+		return tracks, nil
+	}
+	albumGain := analysis.TrackGain(analysis.AlbumLoudness(loudness, durations))
+	for _, a := range list {
+		a.AlbumGain = albumGain
+		a.AlbumPeak = albumPeak
+		err := m.saveAnalysis(a)
+		if err != nil {
+			return tracks, err
+		}
+	}
+	return tracks, nil
+}
+
+// TrackAnalysis returns the audio analysis for the track.
+func (m *Music) TrackAnalysis(t Track) (*Analysis, error) {
+	a, err := m.trackAnalysis(t.ETag)
+	if err != nil {
+		return nil, ErrAnalysisNotFound
+	}
+	return a, nil
+}
+
+// TrackAnalyses returns the audio analysis for each of the tracks, by etag.
+func (m *Music) TrackAnalyses(tracks []Track) map[string]Analysis {
+	var etags []string
+	for _, t := range tracks {
+		etags = append(etags, t.ETag)
+	}
+	result := make(map[string]Analysis)
+	if len(etags) == 0 {
+		return result
+	}
+	for _, a := range m.analysesFor(etags) {
+		result[a.ETag] = a
+	}
+	return result
+}
+
+func addAnalysisFields(fields search.FieldMap, a *Analysis) {
+	if a.Codec != "" {
+		fields[FieldCodec] = a.Codec
+	}
+	if a.Bitrate > 0 {
+		fields[FieldBitrate] = a.Bitrate
+	}
+	if a.SampleRate > 0 {
+		fields[FieldSampleRate] = a.SampleRate
+	}
+	if a.BPM > 0 {
+		fields[FieldBPM] = a.BPM
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/defsub/takeout/lib/audio"
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/log"
+)
+
+const (
+	ArtworkCover    = "cover"
+	ArtworkFolder   = "folder"
+	ArtworkFront    = "front"
+	ArtworkEmbedded = "embedded"
+	ArtworkArtist   = "artist"
+	// folder checked for embedded artwork and nothing found
+	ArtworkNone = "none"
+)
+
+var (
+	ErrArtworkNotFound = errors.New("artwork not found")
+)
+
+// preferred release artwork, lowest first
+var artworkRank = map[string]int{
+	ArtworkCover:    1,
+	ArtworkFolder:   2,
+	ArtworkFront:    3,
+	ArtworkEmbedded: 4,
+	ArtworkNone:     5,
+}
+
+// addLocalArtwork saves artwork found in the bucket unless the folder already
+// has preferred artwork.
+func (m *Music) addLocalArtwork(a *LocalArtwork) error {
+	curr, err := m.folderArtwork(a.Folder)
+	if err == nil && curr.Source != ArtworkArtist &&
+		artworkRank[curr.Source] < artworkRank[a.Source] {
+		return nil
+	}
+	return m.saveLocalArtwork(a)
+}
+
+// syncLocalArtwork links local artwork to releases and artists, and then
+// checks for embedded artwork in folders without image files. Only releases
+// without Cover Art Archive artwork are checked unless local artwork is
+// preferred.
+func (m *Music) syncLocalArtwork(ctx context.Context) error {
+	for _, a := range m.localArtwork() {
+		reid, arid := a.REID, a.ARID
+		if a.Source == ArtworkArtist {
+			if artist := m.Artist(a.Artist); artist != nil {
+				a.ARID = artist.ARID
+			}
+		} else if tracks := m.folderTracks(a.Folder); len(tracks) > 0 {
+			a.REID = tracks[0].REID
+		}
+		if a.REID != reid || a.ARID != arid {
+			err := m.saveLocalArtwork(&a)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(m.buckets) == 0 {
+		return nil
+	}
+
+	var tracks []Track
+	if m.config.Music.PreferLocalArtwork {
+		tracks = m.tracksWithRelease()
+	} else {
+		tracks = m.tracksWithoutCoverArt()
+	}
+	folders := make(map[string]Track)
+	for _, t := range tracks {
+		folder := t.folder()
+		if f, ok := folders[folder]; ok && f.DiscNum*1000+f.TrackNum < t.DiscNum*1000+t.TrackNum {
+			continue
+		}
+		folders[folder] = t
+	}
+
+	job.AddTotal(ctx, len(folders))
+	for folder, t := range folders {
+		if ctx.Err() != nil {
+			break
+		}
+		job.Step(ctx)
+		if _, err := m.folderArtwork(folder); err == nil {
+			continue
+		}
+		a := LocalArtwork{Folder: folder, Source: ArtworkNone, REID: t.REID}
+		_, err := audio.FrontPicture(m.bucketReader(&t), t.Size)
+		if err == nil {
+			a.Bucket = t.Bucket
+			a.Key = t.Key
+			a.Size = t.Size
+			a.Source = ArtworkEmbedded
+		} else if err != audio.ErrNoPicture {
+			log.Printf("embedded artwork %s: %s\n", t.Key, err)
+			continue
+		}
+		err = m.saveLocalArtwork(&a)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseArtwork returns the local artwork for the release.
+func (m *Music) ReleaseArtwork(reid string) (*LocalArtwork, error) {
+	a, err := m.releaseArtwork(reid)
+	if err != nil {
+		return nil, ErrArtworkNotFound
+	}
+	return a, nil
+}
+
+// ArtistArtwork returns the local artwork for the artist.
+func (m *Music) ArtistArtwork(arid string) (*LocalArtwork, error) {
+	a, err := m.artistArtwork(arid)
+	if err != nil {
+		return nil, ErrArtworkNotFound
+	}
+	return a, nil
+}
+
+// ArtworkURL is a presigned bucket URL for artwork image files. Embedded
+// artwork has no URL.
+func (m *Music) ArtworkURL(a *LocalArtwork) *url.URL {
+	if a.Source == ArtworkEmbedded || len(m.buckets) == 0 {
+		return nil
+	}
+	return m.bucketFor(a.Bucket).Presign(a.Key)
+}
+
+// ArtworkImage reads the artwork image from the bucket.
+func (m *Music) ArtworkImage(a *LocalArtwork) (*audio.Picture, error) {
+	if len(m.buckets) == 0 {
+		return nil, ErrArtworkNotFound
+	}
+	r := m.bucketFor(a.Bucket).ReaderAt(a.Key)
+	if a.Source == ArtworkEmbedded {
+		return audio.FrontPicture(r, a.Size)
+	}
+	data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, a.Size))
+	if err != nil {
+		return nil, err
+	}
+	mimeType := "image/jpeg"
+	if strings.EqualFold(path.Ext(a.Key), ".png") {
+		mimeType = "image/png"
+	}
+	return &audio.Picture{MIMEType: mimeType, Data: data}, nil
+}
+
+// releaseCover uses local artwork when preferred or when the Cover Art
+// Archive doesn't have artwork for the release.
+func (m *Music) releaseCover(r Release, size string) string {
+	coverArt := r.Artwork && (r.FrontArtwork || r.OtherArtwork != "")
+	if !coverArt || m.config.Music.PreferLocalArtwork {
+		if _, err := m.releaseArtwork(r.REID); err == nil {
+			return fmt.Sprintf("/img/local/re/%s", r.REID)
+		}
+	}
+	return Cover(r, size)
+}
+
+// artistImage uses the local artist image when preferred or when there's no
+// image from Fanart.
+func (m *Music) artistImage(artist *Artist, fanart string) string {
+	if fanart == "" || m.config.Music.PreferLocalArtwork {
+		if _, err := m.artistArtwork(artist.ARID); err == nil {
+			return fmt.Sprintf("/img/local/ar/%s", artist.ARID)
+		}
+	}
+	return fanart
+}
@@ -18,34 +18,57 @@
 package music
 
 import (
+	"io"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/defsub/takeout/lib/bucket"
 )
 
-// Asynchronously obtain all tracks from the bucket.
-func (m *Music) syncFromBucket(bucket bucket.Bucket, lastSync time.Time) (trackCh chan *Track, err error) {
+// Asynchronously obtain all tracks, artwork images and lyrics from the
+// bucket.
+func (m *Music) syncFromBucket(bucket bucket.Bucket, lastSync time.Time) (trackCh chan *Track, artCh chan *LocalArtwork, lyricsCh chan *Lyrics, err error) {
 	trackCh = make(chan *Track)
+	artCh = make(chan *LocalArtwork)
+	lyricsCh = make(chan *Lyrics)
 
 	go func() {
 		defer close(trackCh)
+		defer close(artCh)
+		defer close(lyricsCh)
 		objectCh, err := bucket.List(lastSync)
 		if err != nil {
 			return
 		}
 		for o := range objectCh {
-			checkObject(bucket, o, trackCh)
+			checkObject(bucket, o, trackCh, artCh, lyricsCh)
 		}
 	}()
 
 	return
 }
 
-func checkObject(b bucket.Bucket, object *bucket.Object, trackCh chan *Track) {
+func checkObject(b bucket.Bucket, object *bucket.Object, trackCh chan *Track, artCh chan *LocalArtwork, lyricsCh chan *Lyrics) {
+	if art := matchArtwork(object.Key, object.Path); art != nil {
+		art.Bucket = b.ID()
+		art.Key = object.Key
+		art.Size = object.Size
+		artCh <- art
+		return
+	}
+	if lyrics := matchLyrics(object.Key); lyrics != nil {
+		lyrics.Bucket = b.ID()
+		lyrics.Key = object.Key
+		lyrics.Size = object.Size
+		lyrics.ETag = object.ETag
+		lyricsCh <- lyrics
+		return
+	}
 	matchPath(b, object.Path, trackCh, func(t *Track, trackCh chan *Track) {
+		t.Bucket = b.ID()
 		t.Key = object.Key
 		t.ETag = object.ETag
 		t.Size = object.Size
@@ -58,7 +81,9 @@ func checkObject(b bucket.Bucket, object *bucket.Object, trackCh chan *Track) {
 // The Raconteurs / Help Us Stranger (2019) / 01-Bored and Razed.flac
 // Tubeway Army / Replicas - The First Recordings (2019) / 1-01-You Are in My Vision (early version).flac
 // Tubeway Army / Replicas - The First Recordings (2019) / 2-01-Replicas (early version 2).flac
-var coverRegexp = regexp.MustCompile(`cover\.(png|jpg)$`)
+var coverRegexp = regexp.MustCompile(`(?i)^(cover|folder|front)\.(png|jpe?g)$`)
+
+var artistImageRegexp = regexp.MustCompile(`(?i)^artist\.(png|jpe?g)$`)
 
 var pathRegexp = regexp.MustCompile(`([^\/]+)\/([^\/]+)\/([^\/]+)$`)
 
@@ -80,6 +105,29 @@ func matchPath(b bucket.Bucket, path string, trackCh chan *Track, doMatch func(t
 	}
 }
 
+// Examples:
+// Gary Numan / The Pleasure Principle (1998) / cover.jpg
+// Gary Numan / artist.jpg
+func matchArtwork(key, path string) *LocalArtwork {
+	keys := strings.Split(key, "/")
+	paths := strings.Split(path, "/")
+	name := paths[len(paths)-1]
+	if coverRegexp.MatchString(name) && len(keys) >= 3 {
+		matches := coverRegexp.FindStringSubmatch(name)
+		return &LocalArtwork{
+			Folder: strings.Join(keys[len(keys)-3:len(keys)-1], "/"),
+			Source: strings.ToLower(matches[1]),
+		}
+	} else if artistImageRegexp.MatchString(name) && len(keys) >= 2 && len(paths) >= 2 {
+		return &LocalArtwork{
+			Folder: keys[len(keys)-2],
+			Source: ArtworkArtist,
+			Artist: fixName(paths[len(paths)-2]),
+		}
+	}
+	return nil
+}
+
 var releaseRegexp = regexp.MustCompile(`(.+?)\s*(\(([\d]+)\))?\s*$`)
 // 1|1|Airlane|Music/Gary Numan/The Pleasure Principle (1998)/01-Airlane.flac
 // 1|1|Airlane|Music/Gary Numan/The Pleasure Principle (2009)/1-01-Airlane.flac
@@ -163,8 +211,22 @@ func matchTrack(file string, t *Track) bool {
 	return true
 }
 
+// bucketFor returns the bucket with the provided id. Objects synced before
+// the source bucket was recorded use the first bucket.
+func (m *Music) bucketFor(id string) *bucket.Bucket {
+	for i := range m.buckets {
+		if m.buckets[i].ID() == id {
+			return &m.buckets[i]
+		}
+	}
+	return &m.buckets[0]
+}
+
 // Generate a presigned url which expires based on config settings.
 func (m *Music) bucketURL(t *Track) *url.URL {
-	// TODO FIXME assume first bucket!!!
-	return m.buckets[0].Presign(t.Key)
+	return m.bucketFor(t.Bucket).Presign(t.Key)
+}
+
+func (m *Music) bucketReader(t *Track) io.ReaderAt {
+	return m.bucketFor(t.Bucket).ReaderAt(t.Key)
 }
@@ -156,3 +156,50 @@ func TestPattern(t *testing.T) {
 
 	}
 }
+
+func TestMatchArtwork(t *testing.T) {
+	for key, expect := range map[string]LocalArtwork{
+		"Music/Gary Numan/The Pleasure Principle (1998)/cover.jpg": {Folder: "Gary Numan/The Pleasure Principle (1998)", Source: ArtworkCover},
+		"Music/Gary Numan/Replicas (2008)/Folder.PNG":              {Folder: "Gary Numan/Replicas (2008)", Source: ArtworkFolder},
+		"Music/Gary Numan/Telekon (1980)/front.jpeg":               {Folder: "Gary Numan/Telekon (1980)", Source: ArtworkFront},
+		"Music/Gary Numan/artist.jpg":                              {Folder: "Gary Numan", Source: ArtworkArtist, Artist: "Gary Numan"},
+	} {
+		a := matchArtwork(key, key)
+		if a == nil {
+			t.Errorf("%s not matched", key)
+		} else if *a != expect {
+			t.Errorf("%s expected %+v got %+v", key, expect, *a)
+		}
+	}
+	for _, key := range []string{
+		"Music/Gary Numan/Telekon (1980)/back.jpg",
+		"Music/Gary Numan/Telekon (1980)/01-This Wreckage.flac",
+		"artist.jpg",
+	} {
+		if a := matchArtwork(key, key); a != nil {
+			t.Errorf("%s should not match", key)
+		}
+	}
+}
+
+func TestMatchLyrics(t *testing.T) {
+	for key, expect := range map[string]string{
+		"Music/Gary Numan/The Pleasure Principle (1998)/01-Airlane.lrc": LyricsLRC,
+		"Music/Gary Numan/Telekon (1980)/1-01-This Wreckage.TXT":        LyricsText,
+	} {
+		l := matchLyrics(key)
+		if l == nil {
+			t.Errorf("%s not matched", key)
+		} else if l.Source != expect || l.Base+"."+key[len(key)-3:] != key {
+			t.Errorf("%s unexpected %+v", key, *l)
+		}
+	}
+	for _, key := range []string{
+		"Music/Gary Numan/Telekon (1980)/01-This Wreckage.flac",
+		"notes.txt",
+	} {
+		if l := matchLyrics(key); l != nil {
+			t.Errorf("%s should not match", key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/defsub/takeout/lib/search"
+)
+
+// Catalogs used to browse the music collection.
+const (
+	CatalogDecades = "decades"
+	CatalogGenres  = "genres"
+	CatalogLabels  = "labels"
+	CatalogSeries  = "series"
+)
+
+var (
+	ErrInvalidCatalog = errors.New("invalid catalog")
+
+	decadeRegexp = regexp.MustCompile(`^([1-9]\d{2}0)s$`)
+
+	catalogFields = map[string]string{
+		CatalogGenres: FieldGenre,
+		CatalogLabels: FieldLabel,
+		CatalogSeries: FieldSeries,
+	}
+)
+
+// Catalog returns the labels, genres, decades or series in the collection
+// along with track counts and queries to find the tracks. Decades are ordered
+// by date and others by count.
+func (m *Music) Catalog(name string) ([]search.FacetTerm, error) {
+	var facet string
+	req := search.Request{FacetSize: m.config.Music.CatalogLimit}
+	if name == CatalogDecades {
+		facet = search.FacetDecade
+		req.Decades = FieldDate
+	} else if field, ok := catalogFields[name]; ok {
+		facet = field
+		req.Facets = []string{field}
+	} else {
+		return nil, ErrInvalidCatalog
+	}
+
+	s, err := m.newSearch()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	result, err := s.Query(req)
+	if err != nil {
+		return nil, err
+	}
+	terms := result.Facets[facet].Terms
+	if terms == nil {
+		terms = []search.FacetTerm{}
+	}
+	return terms, nil
+}
+
+// CatalogQuery returns the search query for a term in the catalog, such as
+// a label name or a decade like 1990s.
+func CatalogQuery(name, term string) (string, error) {
+	if name == CatalogDecades {
+		matches := decadeRegexp.FindStringSubmatch(term)
+		if matches == nil {
+			return "", ErrInvalidCatalog
+		}
+		year, _ := strconv.Atoi(matches[1])
+		return fmt.Sprintf(`+%s:>="%d-01-01" +%s:<"%d-01-01"`,
+			FieldDate, year, FieldDate, year+10), nil
+	}
+	field, ok := catalogFields[name]
+	if !ok || term == "" {
+		return "", ErrInvalidCatalog
+	}
+	return fmt.Sprintf(`+%s:"%s"`, field, strings.Replace(term, `"`, `\"`, -1)), nil
+}
+
+// CatalogRef returns a playlist ref for tracks matching a catalog query.
+func CatalogRef(query string) string {
+	return fmt.Sprintf("/music/search?q=%s&radio=1", url.QueryEscape(query))
+}
+
+// CatalogReleases returns a page of releases with tracks matching the
+// catalog query, ordered by date, along with the total number of releases.
+// Only the first CatalogLimit matching tracks are used.
+func (m *Music) CatalogReleases(query string, offset, limit int) ([]Release, int) {
+	seen := make(map[string]bool)
+	var reids []string
+	for _, t := range m.Search(query, m.config.Music.CatalogLimit) {
+		if t.REID != "" && !seen[t.REID] {
+			seen[t.REID] = true
+			reids = append(reids, t.REID)
+		}
+	}
+	if len(reids) == 0 {
+		return []Release{}, 0
+	}
+	return m.releasesFor(reids, offset, limit), len(reids)
+}
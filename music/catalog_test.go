@@ -0,0 +1,81 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+)
+
+func TestCatalogQuery(t *testing.T) {
+	q, err := CatalogQuery(CatalogDecades, "1990s")
+	if err != nil || q != `+date:>="1990-01-01" +date:<"2000-01-01"` {
+		t.Errorf("unexpected decade query %s %v", q, err)
+	}
+	q, err = CatalogQuery(CatalogLabels, `Sub "Pop"`)
+	if err != nil || q != `+label:"Sub \"Pop\""` {
+		t.Errorf("unexpected label query %s %v", q, err)
+	}
+	for _, v := range [][]string{
+		{CatalogDecades, "1995s"},
+		{CatalogDecades, "90s"},
+		{CatalogDecades, "1990"},
+		{CatalogGenres, ""},
+		{"artists", "x"},
+	} {
+		_, err = CatalogQuery(v[0], v[1])
+		if err != ErrInvalidCatalog {
+			t.Errorf("expected invalid catalog for %v", v)
+		}
+	}
+}
+
+func TestReleasesForPage(t *testing.T) {
+	m := testDB(t)
+	releases := []Release{
+		{REID: "r1", Artist: "Nirvana", Name: "Nevermind", Date: yearDate(1991)},
+		{REID: "r2", Artist: "Nirvana", Name: "Bleach", Date: yearDate(1989)},
+		{REID: "r3", Artist: "Soundgarden", Name: "Superunknown", Date: yearDate(1994)},
+		{REID: "r4", Artist: "Mudhoney", Name: "Superfuzz Bigmuff", Date: yearDate(1988)},
+	}
+	for i := range releases {
+		if err := m.db.Create(&releases[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	reids := []string{"r1", "r2", "r3"}
+	for _, v := range []struct {
+		offset, limit int
+		expect        []string
+	}{
+		{0, 0, []string{"r2", "r1", "r3"}},
+		{0, 2, []string{"r2", "r1"}},
+		{2, 2, []string{"r3"}},
+		{3, 2, nil},
+	} {
+		result := m.releasesFor(reids, v.offset, v.limit)
+		if len(result) != len(v.expect) {
+			t.Fatalf("%d,%d: expected %v got %+v", v.offset, v.limit, v.expect, result)
+		}
+		for i := range v.expect {
+			if result[i].REID != v.expect[i] {
+				t.Errorf("%d,%d: expected %s at %d got %s",
+					v.offset, v.limit, v.expect[i], i, result[i].REID)
+			}
+		}
+	}
+}
@@ -29,23 +29,30 @@ import (
 const (
 	FieldArtist      = "artist"
 	FieldAsin        = "asin"
+	FieldBitrate     = "bitrate"
+	FieldBPM         = "bpm"
+	FieldCodec       = "codec"
 	FieldDate        = "date"
 	FieldFirstDate   = "first_date"
 	FieldGenre       = "genre"
 	FieldLabel       = "label"
 	FieldLength      = "length"
+	FieldLyrics      = "lyrics"
 	FieldMedia       = "media"
 	FieldMediaTitle  = "media_title"
 	FieldPopularity  = "popularity"
 	FieldRating      = "rating"
 	FieldRelease     = "release"
 	FieldReleaseDate = "release_date"
+	FieldSampleRate  = "sample_rate"
 	FieldSeries      = "series"
+	FieldSortTitle   = "sort_title"
 	FieldStatus      = "status"
 	FieldTag         = "tag"
 	FieldTitle       = "title"
 	FieldTrack       = "track"
 	FieldType        = "type"
+	FieldWork        = "work"
 
 	FieldBass      = "base"
 	FieldClarinet  = "clarinet"
@@ -62,6 +69,63 @@ const (
 	TypeLive    = "live"
 )
 
+// CreditRole has the people credited with a role. Field is the search field
+// for the role.
+type CreditRole struct {
+	Role    string
+	Field   string
+	Credits []Credit
+}
+
+// CreditRoles groups credits by role, in order of first appearance, and
+// removes people credited more than once with the same role.
+func CreditRoles(credits []Credit) []CreditRole {
+	var roles []CreditRole
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, c := range credits {
+		key := c.Role + "/" + c.ARID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		i, ok := index[c.Role]
+		if !ok {
+			i = len(roles)
+			index[c.Role] = i
+			roles = append(roles, CreditRole{Role: c.Role, Field: creditField(c.Role)})
+		}
+		roles[i].Credits = append(roles[i].Credits, c)
+	}
+	return roles
+}
+
+// creditField is the search field for the role, see addField.
+func creditField(role string) string {
+	return strings.Replace(strings.ToLower(role), " ", "_", -1)
+}
+
+// ReleaseCredits returns release and recording credits for the release.
+func (m *Music) ReleaseCredits(r Release) []Credit {
+	return m.releaseCredits(r.REID)
+}
+
+// TrackCredits returns recording credits for the track along with credits
+// for the track's release.
+func (m *Music) TrackCredits(t Track) []Credit {
+	return m.trackCredits(t.REID, t.RID)
+}
+
+// ArtistCredits returns credits for a person using the MusicBrainz artist ID.
+func (m *Music) ArtistCredits(arid string) []Credit {
+	return m.artistCredits(arid)
+}
+
+// CreditedTracks returns tracks a person is credited on.
+func (m *Music) CreditedTracks(arid string) []Track {
+	return m.creditedTracks(arid)
+}
+
 type trackIndex struct {
 	// these fields are used to match against existing tracks
 	DiscNum  int
@@ -69,14 +133,23 @@ type trackIndex struct {
 	Title    string
 	Artist   string
 	RID      string
+	Length   int // milliseconds
 	// these are the indexed fields to store in the search db
-	Fields   search.FieldMap
+	Fields search.FieldMap
+	// recording credits to store in the music db
+	Credits []Credit
+	// track artist credits to store in the music db
+	ArtistCredits []ArtistCredit
+	// works performed in the recording to store in the music db
+	Works []Work
 }
 
-func (m *Music) creditsIndex(reid string) ([]trackIndex, error) {
+// creditsIndex returns the index for each release track along with the
+// release credits.
+func (m *Music) creditsIndex(reid string) ([]trackIndex, []Credit, error) {
 	rel, err := m.mbz.Release(reid)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	fields := make(search.FieldMap)
@@ -138,7 +211,10 @@ func (m *Music) creditsIndex(reid string) ([]trackIndex, error) {
 		}
 	}
 
-	relationCredits(fields, rel.Relations)
+	credits := relationCredits(fields, rel.Relations)
+	for i := range credits {
+		credits[i].REID = reid
+	}
 
 	var indices []trackIndex
 
@@ -157,26 +233,49 @@ func (m *Music) creditsIndex(reid string) ([]trackIndex, error) {
 				setField(trackFields, FieldFirstDate, t.Recording.FirstReleaseDate)
 			}
 			addField(trackFields, FieldTitle, t.Recording.Title)
+			setField(trackFields, FieldSortTitle, search.SortTitleKey(t.Recording.Title))
 			addField(trackFields, FieldLength, t.Recording.Length/1000)
-			relationCredits(trackFields, t.Recording.Relations)
+			trackCredits := relationCredits(trackFields, t.Recording.Relations)
+			for i := range trackCredits {
+				trackCredits[i].REID = reid
+				trackCredits[i].RID = t.Recording.ID
+			}
+			var artistCredits []ArtistCredit
 			for _, a := range t.ArtistCredit {
 				addField(trackFields, FieldArtist, a.Name)
+				if a.Artist.ID != "" {
+					artistCredits = append(artistCredits, ArtistCredit{
+						REID: reid,
+						RID:  t.Recording.ID,
+						ARID: a.Artist.ID,
+						Name: fixName(a.Name),
+					})
+				}
+			}
+
+			works := recordingWorks(reid, t.Recording)
+			for _, w := range works {
+				addField(trackFields, FieldWork, w.Title)
 			}
 
 			index := trackIndex{
-				DiscNum:  m.Position,
-				TrackNum: t.Position,
-				Title:    fixName(t.Recording.Title),
-				Artist:   fixName(t.Artist()),
-				RID:      t.Recording.ID,
-				Fields:   trackFields,
+				DiscNum:       m.Position,
+				TrackNum:      t.Position,
+				Title:         fixName(t.Recording.Title),
+				Artist:        fixName(t.Artist()),
+				RID:           t.Recording.ID,
+				Length:        t.Recording.Length,
+				Fields:        trackFields,
+				Credits:       trackCredits,
+				ArtistCredits: artistCredits,
+				Works:         works,
 			}
 			//fmt.Printf("%d/%d/%s/%s\n", index.DiscNum, index.TrackNum, index.Title, index.RID)
 			indices = append(indices, index)
 		}
 	}
 
-	return indices, nil
+	return indices, credits, nil
 }
 
 func setField(c search.FieldMap, key string, value interface{}) search.FieldMap {
@@ -245,7 +344,14 @@ func addField(c search.FieldMap, key string, value interface{}) search.FieldMap
 	return c
 }
 
-func relationCredits(c search.FieldMap, relations []musicbrainz.Relation) search.FieldMap {
+// relationCredits adds fields for relations and returns the people credited
+// by role.
+func relationCredits(c search.FieldMap, relations []musicbrainz.Relation) []Credit {
+	var credits []Credit
+	credit := func(role string, a musicbrainz.Artist) {
+		addField(c, role, a.Name)
+		credits = append(credits, Credit{Role: role, Name: a.Name, ARID: a.ID})
+	}
 	for _, r := range relations {
 		if "performance" == r.Type {
 			for _, wr := range r.Work.Relations {
@@ -253,7 +359,7 @@ func relationCredits(c search.FieldMap, relations []musicbrainz.Relation) search
 				case "arranger", "arrangement", "composer",
 					"lyricist", "orchestrator", "orchestration",
 					"writer":
-					addField(c, wr.Type, wr.Artist.Name)
+					credit(wr.Type, wr.Artist)
 				case "based on", "medley", "misc",
 					"instrument arranger", "named after",
 					"other version", "revised by",
@@ -274,7 +380,7 @@ func relationCredits(c search.FieldMap, relations []musicbrainz.Relation) search
 			}
 		} else if "instrument" == r.Type {
 			for _, a := range r.Attributes {
-				addField(c, a, r.Artist.Name)
+				credit(a, r.Artist)
 			}
 		} else if "part of" == r.Type && "series" == r.TargetType {
 			addField(c, FieldSeries, r.Series.Name)
@@ -283,18 +389,55 @@ func relationCredits(c search.FieldMap, relations []musicbrainz.Relation) search
 				attr := r.Attributes[0]
 				switch attr {
 				case "co":
-					addField(c, fmt.Sprintf("%s-%s", r.Attributes[0], r.Type), r.Artist.Name)
+					credit(fmt.Sprintf("%s-%s", r.Attributes[0], r.Type), r.Artist)
 				case "additional", "assistant":
-					addField(c, fmt.Sprintf("%s %s", r.Attributes[0], r.Type), r.Artist.Name)
+					credit(fmt.Sprintf("%s %s", r.Attributes[0], r.Type), r.Artist)
 				case "lead vocals":
-					addField(c, attr, r.Artist.Name)
+					credit(attr, r.Artist)
 				}
 			} else {
-				addField(c, r.Type, r.Artist.Name)
+				credit(r.Type, r.Artist)
 			}
 		}
 	}
-	return c
+	return credits
+}
+
+// recordingWorks returns the works performed in the recording. Movements
+// use the larger work they're part of along with the movement number.
+func recordingWorks(reid string, r musicbrainz.Recording) []Work {
+	var works []Work
+	for _, rel := range r.Relations {
+		if rel.Type != "performance" || rel.Work.ID == "" {
+			continue
+		}
+		w := Work{
+			REID:   reid,
+			RID:    r.ID,
+			WorkID: rel.Work.ID,
+			Title:  fixName(rel.Work.Title),
+		}
+		relations := rel.Work.Relations
+		for _, wr := range rel.Work.Relations {
+			if wr.Type == "parts" && wr.TargetType == "work" &&
+				wr.Direction == "backward" && wr.Work.ID != "" {
+				w.PartID, w.PartTitle = w.WorkID, w.Title
+				w.WorkID, w.Title = wr.Work.ID, fixName(wr.Work.Title)
+				w.Movement = wr.OrderingKey
+				relations = append(relations, wr.Work.Relations...)
+				break
+			}
+		}
+		for _, wr := range relations {
+			if wr.Type == "composer" && wr.Artist.ID != "" {
+				w.Composer = fixName(wr.Artist.Name)
+				w.ComposerID = wr.Artist.ID
+				break
+			}
+		}
+		works = append(works, w)
+	}
+	return works
 }
 
 func hasAttribute(attrs []string, name string) bool {
@@ -0,0 +1,119 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+
+	"github.com/defsub/takeout/lib/musicbrainz"
+	"github.com/defsub/takeout/lib/search"
+)
+
+func TestRelationCredits(t *testing.T) {
+	morello := musicbrainz.Artist{ID: "a1", Name: "Tom Morello"}
+	vig := musicbrainz.Artist{ID: "a2", Name: "Butch Vig"}
+	relations := []musicbrainz.Relation{
+		{Type: "instrument", Artist: morello, Attributes: []string{"lead guitar"}},
+		{Type: "producer", Artist: vig},
+		{Type: "producer", Artist: morello, Attributes: []string{"co"}},
+		{Type: "performance", Work: musicbrainz.Work{
+			Relations: []musicbrainz.Relation{
+				{Type: "composer", Artist: morello},
+			}}},
+	}
+	fields := make(search.FieldMap)
+	credits := relationCredits(fields, relations)
+	if len(credits) != 4 {
+		t.Fatalf("expected 4 credits got %+v", credits)
+	}
+	if fields["guitar"] != "Tom Morello" || fields["lead_guitar"] != "Tom Morello" {
+		t.Errorf("missing guitar fields %+v", fields)
+	}
+
+	roles := CreditRoles(append(credits, credits[0]))
+	if len(roles) != 4 {
+		t.Fatalf("expected 4 roles got %+v", roles)
+	}
+	if roles[0].Role != "lead guitar" || roles[0].Field != "lead_guitar" ||
+		len(roles[0].Credits) != 1 {
+		t.Errorf("unexpected role %+v", roles[0])
+	}
+	if roles[2].Role != "co-producer" || roles[2].Credits[0].ARID != "a1" {
+		t.Errorf("unexpected role %+v", roles[2])
+	}
+}
+
+func TestRecordingWorks(t *testing.T) {
+	beethoven := musicbrainz.Artist{ID: "a1", Name: "Ludwig van Beethoven"}
+	schiller := musicbrainz.Artist{ID: "a2", Name: "Friedrich Schiller"}
+	symphony := musicbrainz.Work{ID: "w1", Title: "Symphony no. 9 in D minor, op. 125",
+		Relations: []musicbrainz.Relation{
+			{Type: "composer", Artist: beethoven},
+		}}
+	recording := musicbrainz.Recording{ID: "r1",
+		Relations: []musicbrainz.Relation{
+			{Type: "performance", Work: musicbrainz.Work{ID: "w2",
+				Title: "Symphony no. 9 in D minor, op. 125: IV. Presto – Allegro assai",
+				Relations: []musicbrainz.Relation{
+					{Type: "lyricist", Artist: schiller},
+					{Type: "parts", TargetType: "work", Direction: "forward",
+						Work: musicbrainz.Work{ID: "w3"}},
+					{Type: "parts", TargetType: "work", Direction: "backward",
+						OrderingKey: 4, Work: symphony},
+				}}},
+			{Type: "performance", Work: musicbrainz.Work{ID: "w4", Title: "Für Elise",
+				Relations: []musicbrainz.Relation{
+					{Type: "composer", Artist: beethoven},
+				}}},
+			{Type: "performance"},
+			{Type: "instrument", Work: symphony},
+		}}
+
+	works := recordingWorks("re1", recording)
+	if len(works) != 2 {
+		t.Fatalf("expected 2 works got %+v", works)
+	}
+
+	// movement uses the parent work and its composer
+	w := works[0]
+	if w.REID != "re1" || w.RID != "r1" {
+		t.Errorf("unexpected ids %+v", w)
+	}
+	if w.WorkID != "w1" || w.Title != "Symphony no. 9 in D minor, op. 125" {
+		t.Errorf("expected parent work got %s %s", w.WorkID, w.Title)
+	}
+	if w.PartID != "w2" ||
+		w.PartTitle != "Symphony no. 9 in D minor, op. 125: IV. Presto - Allegro assai" {
+		t.Errorf("expected movement part got %s %s", w.PartID, w.PartTitle)
+	}
+	if w.Movement != 4 {
+		t.Errorf("expected movement 4 got %d", w.Movement)
+	}
+	if w.ComposerID != "a1" || w.Composer != "Ludwig van Beethoven" {
+		t.Errorf("expected parent composer got %s %s", w.ComposerID, w.Composer)
+	}
+
+	// work without a parent
+	w = works[1]
+	if w.WorkID != "w4" || w.Title != "Für Elise" || w.PartID != "" || w.Movement != 0 {
+		t.Errorf("unexpected work %+v", w)
+	}
+	if w.ComposerID != "a1" {
+		t.Errorf("expected composer got %s", w.ComposerID)
+	}
+}
@@ -19,9 +19,11 @@ package music
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/defsub/takeout/auth"
+	"github.com/defsub/takeout/lib/musicbrainz"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -47,8 +49,8 @@ func (m *Music) openDB() (err error) {
 		return
 	}
 
-	m.db.AutoMigrate(&Artist{}, &ArtistBackground{}, &ArtistImage{}, &ArtistTag{}, &Media{}, &Playlist{},
-		&Popular{}, &Similar{}, &Station{}, &Release{}, &Track{})
+	m.db.AutoMigrate(&Artist{}, &Analysis{}, &ArtistBackground{}, &ArtistCredit{}, &ArtistImage{}, &ArtistRelation{}, &ArtistTag{}, &Concert{}, &ConcertSearch{}, &Credit{}, &Fingerprint{}, &LocalArtwork{}, &Lyrics{},
+		&Media{}, &NewRelease{}, &Pin{}, &Playlist{}, &Popular{}, &Similar{}, &Station{}, &Release{}, &Track{}, &Work{})
 	return
 }
 
@@ -193,6 +195,23 @@ func (m *Music) tracksAddedSince(t time.Time) []Track {
 	return tracks
 }
 
+// Find tracks without a duration, optionally limited to the artists. Tracks
+// where the duration couldn't be read are skipped until the etag changes.
+func (m *Music) tracksWithoutDuration(artists []Artist) []Track {
+	var tracks []Track
+	tx := m.db.Where("duration = 0 or duration is null").
+		Where("duration_e_tag is null or duration_e_tag <> e_tag")
+	if artists != nil {
+		var names []string
+		for _, a := range artists {
+			names = append(names, a.Name)
+		}
+		tx = tx.Where("artist in ?", names)
+	}
+	tx.Find(&tracks)
+	return tracks
+}
+
 // Find all tracks without a corresponding release - same artist,
 // release name and track count. These likely have the wrong artist or
 // release name.
@@ -284,6 +303,29 @@ func (m *Music) updateTrackRID(t Track, rid string) (err error) {
 	return
 }
 
+func (m *Music) updateTrackDuration(t Track, duration int) (err error) {
+	err = m.db.Model(t).Update("duration", duration).Error
+	return
+}
+
+// Record that the duration couldn't be read for the current track etag.
+func (m *Music) updateTrackDurationETag(t Track) (err error) {
+	err = m.db.Model(t).Update("duration_e_tag", t.ETag).Error
+	return
+}
+
+// Record that the track couldn't be analyzed for the current track etag.
+func (m *Music) updateTrackAnalysisETag(t Track) (err error) {
+	err = m.db.Model(t).Update("analysis_e_tag", t.ETag).Error
+	return
+}
+
+// Record that the track couldn't be fingerprinted for the current track etag.
+func (m *Music) updateTrackFingerprintETag(t Track) (err error) {
+	err = m.db.Model(t).Update("fingerprint_e_tag", t.ETag).Error
+	return
+}
+
 // Part of the sync process to find releases that match the track. The
 // preferred release will be the first one so dates corresponding to
 // original release dates.
@@ -450,6 +492,12 @@ func (m *Music) ArtistSingleTracks(a Artist, limit ...int) []Track {
 	return tracks
 }
 
+// creditedTrack matches tracks with an artist credit for the artist ID, like
+// tracks on compilations.
+const creditedTrack = "exists (select artist_credits.ar_id from artist_credits" +
+	" where artist_credits.re_id = tracks.re_id and artist_credits.r_id = tracks.r_id" +
+	" and artist_credits.ar_id = ?)"
+
 func (m *Music) ArtistPopularTracks(a Artist, limit ...int) []Track {
 	var tracks []Track
 	l := m.config.Music.PopularLimit
@@ -464,9 +512,9 @@ func (m *Music) ArtistPopularTracks(a Artist, limit ...int) []Track {
 	// group by tracks.title
 	// order by popular.rank;
 
-	m.db.Where("b.title is null and tracks.artist = ?", a.Name).
+	m.db.Where("b.title is null and (tracks.artist = ? or "+creditedTrack+")", a.Name, a.ARID).
 		Joins("left outer join tracks b on tracks.title = b.title and tracks.date > b.date").
-		Joins("inner join popular on tracks.artist = popular.artist and tracks.title = popular.title").
+		Joins("inner join popular on popular.artist = ? and tracks.title = popular.title", a.Name).
 		Group("tracks.title").
 		Order("popular.rank").
 		Limit(l).
@@ -492,14 +540,27 @@ func (m *Music) artistDeepTracks(a Artist, limit ...int) []Track {
 	return tracks
 }
 
+// ArtistTracks returns the artist tracks including tracks credited to the
+// artist on other releases, like compilations.
 func (m *Music) ArtistTracks(a Artist) []Track {
 	var tracks []Track
-	m.db.Where("artist = ?", a.Name).
+	m.db.Where("tracks.artist = ? or "+creditedTrack, a.Name, a.ARID).
 		Order("release, date, disc_num, track_num").
 		Find(&tracks)
 	return tracks
 }
 
+// AppearsOn returns releases by other artists, like compilations, with
+// tracks credited to the artist.
+func (m *Music) AppearsOn(a *Artist) []Release {
+	var releases []Release
+	m.db.Where("releases.re_id in (select distinct tracks.re_id from tracks"+
+		" where tracks.artist != ? and "+creditedTrack+")", a.Name, a.ARID).
+		Where("releases.re_id not in (select distinct re_id from tracks where artist = ?)", a.Name).
+		Order("date asc").Find(&releases)
+	return releases
+}
+
 // All artist names ordered by sortName from MusicBrainz.
 func (m *Music) Artists() []Artist {
 	var artists []Artist
@@ -981,3 +1042,550 @@ func (m *Music) createArtistImage(img *ArtistImage) error {
 // secondary_type = '' and status = 'Official' and artist = 'Black Sabbath' and
 // lower(name) not in (select distinct lower(release) from tracks where artist
 // = 'Black Sabbath') group by name, date order by date;
+
+// replaceArtistCredits replaces the track artist credits for the release.
+func (m *Music) replaceArtistCredits(reid string, credits []ArtistCredit) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("re_id = ?", reid).Delete(ArtistCredit{}).Error
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for i := range credits {
+			c := &credits[i]
+			key := strings.Join([]string{c.RID, c.ARID}, "/")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			err = tx.Create(c).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// replaceWorks replaces the works performed on the release.
+func (m *Music) replaceWorks(reid string, works []Work) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("re_id = ?", reid).Delete(Work{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range works {
+			err = tx.Create(&works[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Music) Composers() []Composer {
+	var composers []Composer
+	m.db.Model(&Work{}).
+		Select("composer as name, composer_id, count(distinct work_id) as works").
+		Where("composer_id != ''").
+		Group("composer_id").
+		Order("composer").
+		Scan(&composers)
+	return composers
+}
+
+func (m *Music) ComposerWorks(composerID string) []Work {
+	var works []Work
+	m.db.Where("composer_id = ?", composerID).
+		Group("work_id").
+		Order("title").
+		Find(&works)
+	return works
+}
+
+// WorkReleases returns releases with the work ordered by the number of
+// recordings of the work on the release, most first.
+func (m *Music) WorkReleases(workID string) []Release {
+	var releases []Release
+	m.db.Joins("inner join works on works.re_id = releases.re_id").
+		Where("works.work_id = ? and works.deleted_at is null", workID).
+		Group("releases.re_id").
+		Order("count(works.r_id) desc, releases.date asc").
+		Find(&releases)
+	return releases
+}
+
+// WorkTracks returns the release tracks with the work in movement order.
+func (m *Music) WorkTracks(workID, reid string) []Track {
+	var tracks []Track
+	m.db.Joins("inner join works on works.re_id = tracks.re_id and works.r_id = tracks.r_id").
+		Where("works.work_id = ? and tracks.re_id = ? and works.deleted_at is null", workID, reid).
+		Order("works.movement, tracks.disc_num, tracks.track_num").
+		Find(&tracks)
+	return tracks
+}
+
+func (m *Music) LookupWork(workID string) (*Work, error) {
+	var work Work
+	err := m.db.Where("work_id = ?", workID).First(&work).Error
+	if err != nil {
+		return nil, err
+	}
+	return &work, nil
+}
+
+// replaceCredits replaces all release and recording credits for the release.
+func (m *Music) replaceCredits(reid string, credits []Credit) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("re_id = ?", reid).Delete(Credit{}).Error
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for i := range credits {
+			c := &credits[i]
+			key := strings.Join([]string{c.RID, c.ARID, c.Role}, "/")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			err = tx.Create(c).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Music) releaseCredits(reid string) []Credit {
+	var credits []Credit
+	m.db.Where("re_id = ?", reid).Order("role, name").Find(&credits)
+	return credits
+}
+
+func (m *Music) trackCredits(reid, rid string) []Credit {
+	var credits []Credit
+	m.db.Where("re_id = ? and (r_id = ? or r_id = '')", reid, rid).
+		Order("role, name").Find(&credits)
+	return credits
+}
+
+func (m *Music) artistCredits(arid string) []Credit {
+	var credits []Credit
+	m.db.Where("ar_id = ?", arid).Order("role").Find(&credits)
+	return credits
+}
+
+// creditedTracks are tracks with recording credits for the artist or on
+// releases with release credits for the artist.
+func (m *Music) creditedTracks(arid string) []Track {
+	var tracks []Track
+	m.db.Where("r_id in (select r_id from credits where ar_id = ? and r_id <> '')"+
+		" or re_id in (select re_id from credits where ar_id = ? and r_id = '')", arid, arid).
+		Order("release_date, release, disc_num, track_num").Find(&tracks)
+	return tracks
+}
+
+// replaceArtistRelations replaces all relations from the artist.
+func (m *Music) replaceArtistRelations(arid string, relations []ArtistRelation) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("ar_id = ?", arid).Delete(ArtistRelation{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range relations {
+			err = tx.Create(&relations[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Music) artistRelations(arid string) []ArtistRelation {
+	var relations []ArtistRelation
+	m.db.Where("ar_id = ?", arid).Order("type, begin, target_name").Find(&relations)
+	return relations
+}
+
+// familyARIDs are artists related to the artist along with artists that share
+// a related artist, such as other bands with the same member.
+func (m *Music) familyARIDs(arid string) []string {
+	var arids []string
+	m.db.Model(&ArtistRelation{}).Distinct("ar_id").
+		Where("target_ar_id in (select target_ar_id from artist_relations where ar_id = ?)"+
+			" or target_ar_id = ?", arid, arid).
+		Pluck("ar_id", &arids)
+	var targets []string
+	m.db.Model(&ArtistRelation{}).Distinct("target_ar_id").
+		Where("ar_id = ?", arid).Pluck("target_ar_id", &targets)
+	return append(arids, targets...)
+}
+
+// newReleaseSeen returns true if the release group was already found.
+func (m *Music) newReleaseSeen(rgid string) bool {
+	var count int64
+	m.db.Model(&NewRelease{}).Where("rg_id = ?", rgid).Count(&count)
+	return count > 0
+}
+
+func (m *Music) createNewRelease(r *NewRelease) error {
+	return m.db.Create(r).Error
+}
+
+// newReleases returns new releases that aren't in the library, most
+// recent first.
+func (m *Music) newReleases(limit int) []NewRelease {
+	var releases []NewRelease
+	m.db.Where("rg_id not in (select distinct rg_id from tracks where deleted_at is null)").
+		Order("date desc, first_seen desc").
+		Limit(limit).
+		Find(&releases)
+	return releases
+}
+
+// releaseGroupArtists maps release group IDs to the release artist. IDs are
+// queried in chunks to stay within the database variable limit.
+func (m *Music) releaseGroupArtists(rgids []string) map[string]string {
+	result := make(map[string]string)
+	chunkSize := 100
+	for i := 0; i < len(rgids); i += chunkSize {
+		end := i + chunkSize
+		if end > len(rgids) {
+			end = len(rgids)
+		}
+		var releases []Release
+		m.db.Where("rg_id in (?)", rgids[i:end]).Group("rg_id").Find(&releases)
+		for _, r := range releases {
+			result[r.RGID] = r.Artist
+		}
+	}
+	return result
+}
+
+// recordingDuplicateTracks returns tracks with a recording ID shared by
+// other tracks, ordered by recording ID.
+func (m *Music) recordingDuplicateTracks() []Track {
+	var tracks []Track
+	m.db.Where("r_id in (select r_id from tracks where r_id <> ''" +
+		" and deleted_at is null group by r_id having count(*) > 1)").
+		Order("r_id").Find(&tracks)
+	return tracks
+}
+
+// fileDuplicateTracks returns tracks with an ETag shared by other tracks,
+// ordered by ETag and size.
+func (m *Music) fileDuplicateTracks() []Track {
+	var tracks []Track
+	m.db.Where("e_tag in (select e_tag from tracks where e_tag <> ''" +
+		" and deleted_at is null group by e_tag, size having count(*) > 1)").
+		Order("e_tag, size").Find(&tracks)
+	return tracks
+}
+
+// tracksForETags returns tracks with any of the ETags.
+func (m *Music) tracksForETags(etags []string) []Track {
+	var tracks []Track
+	m.db.Where("e_tag in (?)", etags).Find(&tracks)
+	return tracks
+}
+
+// compilations returns the set of release IDs that are compilations.
+func (m *Music) compilations(reids []string) map[string]bool {
+	var releases []Release
+	m.db.Where("re_id in (?) and secondary_type = ?",
+		reids, musicbrainz.TypeCompilation).Find(&releases)
+	result := make(map[string]bool)
+	for _, r := range releases {
+		result[r.REID] = true
+	}
+	return result
+}
+
+// releasesFor returns releases with the release IDs ordered by date,
+// starting at offset. A zero limit returns all releases.
+func (m *Music) releasesFor(reids []string, offset, limit int) []Release {
+	var releases []Release
+	tx := m.db.Where("re_id in (?)", reids).Order("date, name")
+	if offset > 0 {
+		tx = tx.Offset(offset)
+	}
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	tx.Find(&releases)
+	return releases
+}
+
+// storeConcerts saves the concerts found by a setlist.fm search along with
+// the search.
+func (m *Music) storeConcerts(arid, query string, concerts []Concert) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		for i := range concerts {
+			c := &concerts[i]
+			err := tx.Unscoped().Where("setlist_id = ?", c.SetlistID).Delete(Concert{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(c).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Unscoped().Where("ar_id = ? and query = ?", arid, query).
+			Delete(ConcertSearch{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&ConcertSearch{ARID: arid, Query: query, Searched: time.Now()}).Error
+	})
+}
+
+// concertSearched returns when the setlist.fm search was stored, or the zero
+// time if it wasn't.
+func (m *Music) concertSearched(arid, query string) time.Time {
+	var search ConcertSearch
+	err := m.db.Where("ar_id = ? and query = ?", arid, query).First(&search).Error
+	if err != nil {
+		return time.Time{}
+	}
+	return search.Searched
+}
+
+func (m *Music) yearConcerts(arid string, year int) []Concert {
+	var concerts []Concert
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m.db.Where("ar_id = ? and date >= ? and date < ?", arid, start, start.AddDate(1, 0, 0)).
+		Order("date").Find(&concerts)
+	return concerts
+}
+
+func (m *Music) tourConcerts(arid, tour string) []Concert {
+	var concerts []Concert
+	m.db.Where("ar_id = ? and tour = ?", arid, tour).Order("date").Find(&concerts)
+	return concerts
+}
+
+func (m *Music) pins() []Pin {
+	var pins []Pin
+	m.db.Order("path").Find(&pins)
+	return pins
+}
+
+func (m *Music) savePin(p *Pin) error {
+	var curr Pin
+	err := m.db.Where("path = ?", p.Path).First(&curr).Error
+	if err == nil {
+		p.ID = curr.ID
+		p.CreatedAt = curr.CreatedAt
+		return m.db.Save(p).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return m.db.Create(p).Error
+	}
+	return err
+}
+
+func (m *Music) deletePin(p *Pin) error {
+	return m.db.Unscoped().Delete(p).Error
+}
+
+func (m *Music) lookupPin(id int) (Pin, error) {
+	var pin Pin
+	err := m.db.First(&pin, id).Error
+	return pin, err
+}
+
+// folderTracks are the tracks within the artist and release folder.
+func (m *Music) folderTracks(path string) []Track {
+	var tracks []Track
+	m.db.Where("key like ? or key like ?", path+"/%", "%/"+path+"/%").
+		Order("disc_num, track_num").Find(&tracks)
+	// like also matches _ and % in names so check the folder
+	var list []Track
+	for _, t := range tracks {
+		if t.folder() == path {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func (m *Music) releaseGroupReleases(rgid string) []Release {
+	var releases []Release
+	m.db.Where("rg_id = ?", rgid).Order("release_date").Find(&releases)
+	return releases
+}
+
+// clearTrackRelease removes the release assignment so the track will be
+// matched again during the next sync.
+func (m *Music) clearTrackRelease(t Track) error {
+	return m.db.Model(t).Update("re_id", "").Update("rg_id", "").Error
+}
+
+func (m *Music) fingerprint(etag string) (*Fingerprint, error) {
+	var fp Fingerprint
+	err := m.db.Where("e_tag = ?", etag).First(&fp).Error
+	if err != nil {
+		return nil, err
+	}
+	return &fp, nil
+}
+
+func (m *Music) saveFingerprint(fp *Fingerprint) error {
+	return m.db.Create(fp).Error
+}
+
+func (m *Music) deleteLocalArtwork() {
+	m.db.Exec("delete from local_artworks")
+}
+
+// saveLocalArtwork adds or replaces the folder artwork.
+func (m *Music) saveLocalArtwork(a *LocalArtwork) error {
+	var curr LocalArtwork
+	err := m.db.Where("folder = ?", a.Folder).First(&curr).Error
+	if err == nil {
+		a.ID = curr.ID
+		a.CreatedAt = curr.CreatedAt
+		return m.db.Save(a).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return m.db.Create(a).Error
+	}
+	return err
+}
+
+func (m *Music) localArtwork() []LocalArtwork {
+	var artwork []LocalArtwork
+	m.db.Find(&artwork)
+	return artwork
+}
+
+func (m *Music) folderArtwork(folder string) (*LocalArtwork, error) {
+	var artwork LocalArtwork
+	err := m.db.Where("folder = ?", folder).First(&artwork).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artwork, nil
+}
+
+func (m *Music) releaseArtwork(reid string) (*LocalArtwork, error) {
+	var artwork LocalArtwork
+	err := m.db.Where("re_id = ? and source != ?", reid, ArtworkNone).
+		First(&artwork).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artwork, nil
+}
+
+func (m *Music) artistArtwork(arid string) (*LocalArtwork, error) {
+	var artwork LocalArtwork
+	err := m.db.Where("ar_id = ? and source = ?", arid, ArtworkArtist).
+		First(&artwork).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artwork, nil
+}
+
+// tracksWithoutCoverArt are assigned tracks with releases that don't have
+// artwork from the Cover Art Archive.
+func (m *Music) tracksWithoutCoverArt() []Track {
+	var tracks []Track
+	m.db.Where("ifnull(re_id, '') != ''").
+		Where("artwork = 0 or (front_artwork = 0 and ifnull(other_artwork, '') = '')").
+		Find(&tracks)
+	return tracks
+}
+
+func (m *Music) tracksWithRelease() []Track {
+	var tracks []Track
+	m.db.Where("ifnull(re_id, '') != ''").Find(&tracks)
+	return tracks
+}
+
+func (m *Music) deleteSidecarLyrics() {
+	m.db.Unscoped().Where("source in (?)", []string{LyricsLRC, LyricsText}).
+		Delete(&Lyrics{})
+}
+
+// saveLyrics adds or replaces the track lyrics.
+func (m *Music) saveLyrics(l *Lyrics) error {
+	var curr Lyrics
+	err := m.db.Where("base = ?", l.Base).First(&curr).Error
+	if err == nil {
+		l.ID = curr.ID
+		l.CreatedAt = curr.CreatedAt
+		return m.db.Save(l).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return m.db.Create(l).Error
+	}
+	return err
+}
+
+func (m *Music) removeLyrics(l *Lyrics) error {
+	return m.db.Unscoped().Delete(l).Error
+}
+
+func (m *Music) allLyrics() []Lyrics {
+	var lyrics []Lyrics
+	m.db.Find(&lyrics)
+	return lyrics
+}
+
+func (m *Music) trackLyrics(base string) (*Lyrics, error) {
+	var lyrics Lyrics
+	err := m.db.Where("base = ?", base).First(&lyrics).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lyrics, nil
+}
+
+func (m *Music) allTracks() []Track {
+	var tracks []Track
+	m.db.Find(&tracks)
+	return tracks
+}
+
+func (m *Music) saveAnalysis(a *Analysis) error {
+	var curr Analysis
+	err := m.db.Where("e_tag = ?", a.ETag).First(&curr).Error
+	if err == nil {
+		a.ID = curr.ID
+		a.CreatedAt = curr.CreatedAt
+		return m.db.Save(a).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return m.db.Create(a).Error
+	}
+	return err
+}
+
+func (m *Music) trackAnalysis(etag string) (*Analysis, error) {
+	var a Analysis
+	err := m.db.Where("e_tag = ?", etag).First(&a).Error
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (m *Music) analysesFor(etags []string) []Analysis {
+	var analyses []Analysis
+	m.db.Where("e_tag in (?)", etags).Find(&analyses)
+	return analyses
+}
+
+// Find tracks without analysis. Tracks which couldn't be analyzed are
+// skipped until the etag changes.
+func (m *Music) tracksWithoutAnalysis() []Track {
+	var tracks []Track
+	m.db.Where("not exists" +
+		" (select analyses.e_tag from analyses where analyses.e_tag = tracks.e_tag)").
+		Where("analysis_e_tag is null or analysis_e_tag <> e_tag").
+		Find(&tracks)
+	return tracks
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2023 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+	"time"
+
+	"github.com/defsub/takeout/config"
+)
+
+// testDB opens an empty in-memory music database.
+func testDB(t *testing.T) *Music {
+	cfg := &config.Config{}
+	cfg.Music.DB.Driver = "sqlite3"
+	cfg.Music.DB.Source = ":memory:"
+	m := &Music{config: cfg}
+	err := m.openDB()
+	if err != nil {
+		t.Fatalf("open %s", err)
+	}
+	// each connection has its own in-memory database
+	conn, err := m.db.DB()
+	if err != nil {
+		t.Fatalf("db %s", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(m.closeDB)
+	return m
+}
+
+func yearDate(year int) time.Time {
+	return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAppearsOn(t *testing.T) {
+	m := testDB(t)
+	artist := Artist{Name: "David Bowie", ARID: "a1"}
+	releases := []Release{
+		{REID: "r1", Artist: "David Bowie", Name: "Low", Date: yearDate(1977)},
+		{REID: "r2", Artist: "Various Artists", Name: "Trainspotting", Date: yearDate(1996)},
+		{REID: "r3", Artist: "Queen", Name: "Hot Space", Date: yearDate(1982)},
+		{REID: "r4", Artist: "Various Artists", Name: "Christiane F.", Date: yearDate(1981)},
+	}
+	for i := range releases {
+		if err := m.db.Create(&releases[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracks := []Track{
+		{Artist: "David Bowie", Release: "Low", Title: "Sound and Vision", REID: "r1", RID: "t1"},
+		{Artist: "Various Artists", Release: "Trainspotting", Title: "Nightclubbing", REID: "r2", RID: "t2"},
+		{Artist: "Various Artists", Release: "Trainspotting", Title: "Lust for Life", REID: "r2", RID: "t3"},
+		{Artist: "Queen", Release: "Hot Space", Title: "Under Pressure", REID: "r3", RID: "t4"},
+		{Artist: "Queen", Release: "Hot Space", Title: "Staying Power", REID: "r3", RID: "t5"},
+		{Artist: "Various Artists", Release: "Christiane F.", Title: "Heroes", REID: "r4", RID: "t6"},
+	}
+	for i := range tracks {
+		if err := m.createTrack(&tracks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := m.replaceArtistCredits("r2", []ArtistCredit{
+		{REID: "r2", RID: "t2", ARID: "a2", Name: "Iggy Pop"},
+		{REID: "r2", RID: "t3", ARID: "a2", Name: "Iggy Pop"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.replaceArtistCredits("r3", []ArtistCredit{
+		{REID: "r3", RID: "t4", ARID: "a1", Name: "David Bowie"},
+		{REID: "r3", RID: "t4", ARID: "a1", Name: "David Bowie"}, // duplicate
+		{REID: "r3", RID: "t4", ARID: "a3", Name: "Queen"},
+		{REID: "r3", RID: "t5", ARID: "a3", Name: "Queen"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.replaceArtistCredits("r4", []ArtistCredit{
+		{REID: "r4", RID: "t6", ARID: "a1", Name: "David Bowie"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appears := m.AppearsOn(&artist)
+	if len(appears) != 2 || appears[0].REID != "r4" || appears[1].REID != "r3" {
+		t.Errorf("unexpected appears on %+v", appears)
+	}
+
+	// own tracks and credited tracks, not other tracks on the releases
+	var titles []string
+	for _, t := range m.ArtistTracks(artist) {
+		titles = append(titles, t.Title)
+	}
+	expect := []string{"Heroes", "Under Pressure", "Sound and Vision"}
+	if len(titles) != len(expect) {
+		t.Fatalf("expected %v got %v", expect, titles)
+	}
+	for i := range expect {
+		if titles[i] != expect[i] {
+			t.Errorf("expected %s at %d got %s", expect[i], i, titles[i])
+		}
+	}
+
+	// credits are replaced, not added
+	err = m.replaceArtistCredits("r4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appears = m.AppearsOn(&artist)
+	if len(appears) != 1 || appears[0].REID != "r3" {
+		t.Errorf("unexpected appears on after replace %+v", appears)
+	}
+}
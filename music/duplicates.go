@@ -0,0 +1,168 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Duplicate is a group of tracks that are copies of the same recording or
+// the same audio file. Tracks are ordered with the preferred copy first.
+type Duplicate struct {
+	ID     string
+	Tracks []Track
+}
+
+// Preferred is the copy of the track to play.
+func (d Duplicate) Preferred() Track {
+	return d.Tracks[0]
+}
+
+// RecordingDuplicates returns groups of tracks with the same MusicBrainz
+// recording, such as the album track along with the single, compilation and
+// other format copies.
+func (m *Music) RecordingDuplicates() []Duplicate {
+	return m.duplicates(m.recordingDuplicateTracks(), func(t Track) string {
+		return t.RID
+	})
+}
+
+// FileDuplicates returns groups of tracks with the same audio, by ETag and
+// size, such as a file copied to more than one bucket or folder.
+func (m *Music) FileDuplicates() []Duplicate {
+	return m.duplicates(m.fileDuplicateTracks(), fileID)
+}
+
+func fileID(t Track) string {
+	return fmt.Sprintf("%s/%d", t.ETag, t.Size)
+}
+
+func (m *Music) duplicates(tracks []Track, id func(Track) string) []Duplicate {
+	var result []Duplicate
+	index := make(map[string]int)
+	for _, t := range tracks {
+		k := id(t)
+		i, ok := index[k]
+		if !ok {
+			i = len(result)
+			index[k] = i
+			result = append(result, Duplicate{ID: k})
+		}
+		result[i].Tracks = append(result[i].Tracks, t)
+	}
+	// ETag query may include same etag with different sizes
+	var dups []Duplicate
+	for _, d := range result {
+		if len(d.Tracks) > 1 {
+			m.sortPreferred(d.Tracks)
+			dups = append(dups, d)
+		}
+	}
+	return dups
+}
+
+// formatRank is the position of the track file type in the preferred
+// formats, lower is better.
+func (m *Music) formatRank(t Track) int {
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(t.Key)), ".")
+	for i, f := range m.config.Music.PreferredFormats {
+		if strings.EqualFold(ext, f) {
+			return i
+		}
+	}
+	return len(m.config.Music.PreferredFormats)
+}
+
+// sortPreferred orders the tracks by the preferred-copy policy: preferred
+// format first, then original releases before compilations, then the
+// earliest release.
+func (m *Music) sortPreferred(tracks []Track) {
+	var reids []string
+	for _, t := range tracks {
+		reids = append(reids, t.REID)
+	}
+	compilations := m.compilations(reids)
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if ra, rb := m.formatRank(a), m.formatRank(b); ra != rb {
+			return ra < rb
+		}
+		if ca, cb := compilations[a.REID], compilations[b.REID]; ca != cb {
+			return cb
+		}
+		if !a.ReleaseDate.Equal(b.ReleaseDate) {
+			return a.ReleaseDate.Before(b.ReleaseDate)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// Dedupe removes copies of the same recording or audio file from the tracks,
+// keeping the order. Each remaining track is replaced with the preferred
+// copy in the library.
+func (m *Music) Dedupe(tracks []Track) []Track {
+	var rids, etags []string
+	for _, t := range tracks {
+		if t.RID != "" {
+			rids = append(rids, t.RID)
+		} else if t.ETag != "" {
+			etags = append(etags, t.ETag)
+		}
+	}
+	var copies []Track
+	if len(rids) > 0 {
+		copies = append(copies, m.tracksForRIDs(rids)...)
+	}
+	if len(etags) > 0 {
+		copies = append(copies, m.tracksForETags(etags)...)
+	}
+	m.sortPreferred(copies)
+
+	preferred := make(map[string]Track)
+	for _, t := range copies {
+		k := dedupeID(t)
+		if _, ok := preferred[k]; !ok {
+			preferred[k] = t
+		}
+	}
+
+	var result []Track
+	seen := make(map[string]bool)
+	for _, t := range tracks {
+		k := dedupeID(t)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if p, ok := preferred[k]; ok {
+			t = p
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+func dedupeID(t Track) string {
+	if t.RID != "" {
+		return t.RID
+	}
+	return fileID(t)
+}
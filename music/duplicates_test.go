@@ -0,0 +1,141 @@
+// Copyright (C) 2023 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+
+	"github.com/defsub/takeout/lib/gorm"
+	"github.com/defsub/takeout/lib/musicbrainz"
+)
+
+// testDuplicates has the album and compilation releases along with copies of
+// the same recordings.
+func testDuplicates(t *testing.T) *Music {
+	m := testDB(t)
+	m.config.Music.PreferredFormats = []string{"flac", "mp3"}
+	releases := []Release{
+		{REID: "album", Artist: "Pixies", Name: "Doolittle"},
+		{REID: "single", Artist: "Pixies", Name: "Here Comes Your Man"},
+		{REID: "best", Artist: "Pixies", Name: "Wave of Mutilation",
+			SecondaryType: musicbrainz.TypeCompilation},
+	}
+	for i := range releases {
+		if err := m.db.Create(&releases[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracks := []Track{
+		{Key: "best/03.flac", RID: "debaser", REID: "best", ETag: "e1", ReleaseDate: yearDate(2004)},
+		{Key: "album/01.mp3", RID: "debaser", REID: "album", ETag: "e2", ReleaseDate: yearDate(1989)},
+		{Key: "album/01.flac", RID: "debaser", REID: "album", ETag: "e3", ReleaseDate: yearDate(1989)},
+		{Key: "best/12.flac", RID: "hcym", REID: "best", ETag: "e4", ReleaseDate: yearDate(2004)},
+		{Key: "single/01.flac", RID: "hcym", REID: "single", ETag: "e5", ReleaseDate: yearDate(1990)},
+		{Key: "album/07.flac", RID: "hcym", REID: "album", ETag: "e6", ReleaseDate: yearDate(1989)},
+		{Key: "other/01.flac", ETag: "e7", Size: 100},
+		{Key: "copy/01.flac", ETag: "e7", Size: 100},
+		{Key: "demo/01.flac", ETag: "e8", Size: 200},
+	}
+	for i := range tracks {
+		if err := m.createTrack(&tracks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestSortPreferred(t *testing.T) {
+	m := testDuplicates(t)
+	cases := []struct {
+		name   string
+		tracks []Track
+		expect []string
+	}{
+		{"preferred format",
+			[]Track{{Model: gorm.Model{ID: 1}, Key: "a/01.mp3"}, {Model: gorm.Model{ID: 2}, Key: "a/01.flac"}},
+			[]string{"a/01.flac", "a/01.mp3"}},
+		{"unknown format last",
+			[]Track{{Model: gorm.Model{ID: 1}, Key: "a/01.ogg"}, {Model: gorm.Model{ID: 2}, Key: "a/01.mp3"}},
+			[]string{"a/01.mp3", "a/01.ogg"}},
+		{"format case",
+			[]Track{{Model: gorm.Model{ID: 1}, Key: "a/01.mp3"}, {Model: gorm.Model{ID: 2}, Key: "a/01.FLAC"}},
+			[]string{"a/01.FLAC", "a/01.mp3"}},
+		{"original before compilation",
+			[]Track{
+				{Model: gorm.Model{ID: 1}, Key: "best/01.flac", REID: "best", ReleaseDate: yearDate(1980)},
+				{Model: gorm.Model{ID: 2}, Key: "album/01.flac", REID: "album", ReleaseDate: yearDate(1989)}},
+			[]string{"album/01.flac", "best/01.flac"}},
+		{"earliest release",
+			[]Track{
+				{Model: gorm.Model{ID: 1}, Key: "single/01.flac", REID: "single", ReleaseDate: yearDate(1990)},
+				{Model: gorm.Model{ID: 2}, Key: "album/01.flac", REID: "album", ReleaseDate: yearDate(1989)}},
+			[]string{"album/01.flac", "single/01.flac"}},
+		{"lowest id",
+			[]Track{{Model: gorm.Model{ID: 2}, Key: "b/01.flac"}, {Model: gorm.Model{ID: 1}, Key: "a/01.flac"}},
+			[]string{"a/01.flac", "b/01.flac"}},
+	}
+	for _, c := range cases {
+		m.sortPreferred(c.tracks)
+		for i, key := range c.expect {
+			if c.tracks[i].Key != key {
+				t.Errorf("%s: expected %s at %d got %s", c.name, key, i, c.tracks[i].Key)
+			}
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	m := testDuplicates(t)
+	cases := []struct {
+		name   string
+		tracks []Track
+		expect []string
+	}{
+		{"replaced with preferred copy",
+			[]Track{{RID: "debaser", Key: "best/03.flac"}},
+			[]string{"album/01.flac"}},
+		{"recording copies removed in order",
+			[]Track{
+				{RID: "hcym", Key: "best/12.flac"},
+				{RID: "debaser", Key: "album/01.mp3"},
+				{RID: "hcym", Key: "single/01.flac"}},
+			[]string{"album/07.flac", "album/01.flac"}},
+		{"file copies removed",
+			[]Track{
+				{Key: "copy/01.flac", ETag: "e7", Size: 100},
+				{Key: "demo/01.flac", ETag: "e8", Size: 200},
+				{Key: "other/01.flac", ETag: "e7", Size: 100}},
+			[]string{"other/01.flac", "demo/01.flac"}},
+		{"unknown tracks kept",
+			[]Track{{RID: "unknown", Key: "x/01.flac"}, {Key: "y/01.flac"}},
+			[]string{"x/01.flac", "y/01.flac"}},
+		{"empty", nil, nil},
+	}
+	for _, c := range cases {
+		result := m.Dedupe(c.tracks)
+		if len(result) != len(c.expect) {
+			t.Errorf("%s: expected %v got %d tracks", c.name, c.expect, len(result))
+			continue
+		}
+		for i, key := range c.expect {
+			if result[i].Key != key {
+				t.Errorf("%s: expected %s at %d got %s", c.name, key, i, result[i].Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/defsub/takeout/lib/acoustid"
+	"github.com/defsub/takeout/lib/log"
+)
+
+const (
+	// minimum AcoustID score for matching recordings
+	fingerprintScore = 0.8
+	// audio is read from the bucket using range requests of this size
+	fingerprintBuffer = 1024 * 1024
+)
+
+// trackFingerprint returns the fingerprint for the track, which is cached by
+// ETag. New fingerprints are calculated from the bucket object and looked up
+// using AcoustID. Tracks that fpcalc can't fingerprint are recorded by ETag
+// and not tried again unless the track changes.
+func (m *Music) trackFingerprint(ctx context.Context, t Track) (*Fingerprint, error) {
+	if t.ETag != "" {
+		fp, err := m.fingerprint(t.ETag)
+		if err == nil {
+			return fp, nil
+		}
+	}
+
+	r := io.NewSectionReader(m.bucketReader(&t), 0, t.Size)
+	v, err := m.acoustid.Fingerprint(ctx, bufio.NewReaderSize(r, fingerprintBuffer))
+	if err != nil {
+		if ctx.Err() == nil && t.ETag != "" {
+			m.updateTrackFingerprintETag(t)
+		}
+		return nil, err
+	}
+	results, err := m.acoustid.Lookup(*v)
+	if err != nil {
+		return nil, err
+	}
+	rids, reids := fingerprintMatches(results)
+	fp := &Fingerprint{
+		ETag:        t.ETag,
+		Duration:    int(v.Duration),
+		Fingerprint: v.Fingerprint,
+		RIDs:        strings.Join(rids, ","),
+		REIDs:       strings.Join(reids, ","),
+	}
+	if t.ETag != "" {
+		err = m.saveFingerprint(fp)
+	}
+	return fp, err
+}
+
+// fingerprintMatches returns the recordings and releases from AcoustID
+// results with a good enough score.
+func fingerprintMatches(results []acoustid.Result) (rids, reids []string) {
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if r.Score < fingerprintScore {
+			continue
+		}
+		for _, rec := range r.Recordings {
+			if seen[rec.ID] {
+				continue
+			}
+			seen[rec.ID] = true
+			rids = append(rids, rec.ID)
+			for _, rel := range rec.Releases {
+				if seen[rel.ID] {
+					continue
+				}
+				seen[rel.ID] = true
+				reids = append(reids, rel.ID)
+			}
+		}
+	}
+	return
+}
+
+// commonReleases returns the release IDs found in every set.
+func commonReleases(sets [][]string) []string {
+	if len(sets) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, set := range sets {
+		seen := make(map[string]bool)
+		for _, id := range set {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			counts[id]++
+		}
+	}
+	var reids []string
+	for id, n := range counts {
+		if n == len(sets) {
+			reids = append(reids, id)
+		}
+	}
+	sort.Strings(reids)
+	return reids
+}
+
+// ambiguousTrackRelease is true when the track release name and counts don't
+// match a single release group.
+func (m *Music) ambiguousTrackRelease(t *Track) bool {
+	groups := make(map[string]bool)
+	for _, r := range m.trackReleases(t) {
+		groups[r.RGID] = true
+	}
+	return len(groups) != 1
+}
+
+// findTrackReleaseFingerprint fingerprints all the tracks in the track's
+// bucket folder and picks a release containing all the recordings.
+func (m *Music) findTrackReleaseFingerprint(ctx context.Context, t *Track) *Release {
+	var sets [][]string
+	for _, ft := range m.folderTracks(t.folder()) {
+		if ft.FingerprintETag != "" && ft.FingerprintETag == ft.ETag {
+			// fingerprint already failed for this track
+			return nil
+		}
+		fp, err := m.trackFingerprint(ctx, ft)
+		if err != nil {
+			log.Printf("fingerprint %s: %s\n", ft.Key, err)
+			return nil
+		}
+		if fp.REIDs == "" {
+			// recording not found
+			return nil
+		}
+		sets = append(sets, strings.Split(fp.REIDs, ","))
+	}
+	reids := commonReleases(sets)
+	if len(reids) == 0 {
+		return nil
+	}
+	var releases []Release
+	for _, r := range m.releasesFor(reids, 0, 0) {
+		if r.TrackCount == t.TrackCount && r.DiscCount == t.DiscCount {
+			releases = append(releases, r)
+		}
+	}
+	return m.pickRelease(releases)
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/defsub/takeout/lib/acoustid"
+)
+
+func TestFingerprintReleases(t *testing.T) {
+	results := []acoustid.Result{
+		{Score: 0.95, Recordings: []acoustid.Recording{
+			{ID: "rec1", Releases: []acoustid.Release{{ID: "a"}, {ID: "b"}}},
+			{ID: "rec2", Releases: []acoustid.Release{{ID: "b"}, {ID: "c"}}},
+		}},
+		{Score: 0.4, Recordings: []acoustid.Recording{
+			{ID: "rec3", Releases: []acoustid.Release{{ID: "d"}}},
+		}},
+	}
+	rids, reids := fingerprintMatches(results)
+	if !reflect.DeepEqual(rids, []string{"rec1", "rec2"}) {
+		t.Errorf("unexpected recordings %v", rids)
+	}
+	if !reflect.DeepEqual(reids, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected releases %v", reids)
+	}
+
+	common := commonReleases([][]string{reids, {"c", "b", "b"}, {"b", "c", "e"}})
+	if !reflect.DeepEqual(common, []string{"b", "c"}) {
+		t.Errorf("unexpected common releases %v", common)
+	}
+	if len(commonReleases(nil)) != 0 {
+		t.Errorf("expected no common releases")
+	}
+}
+
+func TestFingerprintETag(t *testing.T) {
+	m := testDB(t)
+	tracks := []Track{
+		{Key: "Music/Weezer/Weezer (1994)/01-My Name Is Jonas.flac", ETag: "e1"},
+		{Key: "Music/Weezer/Weezer (1994)/02-No One Else.flac", ETag: "e2"},
+	}
+	for i := range tracks {
+		if err := m.createTrack(&tracks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.updateTrackFingerprintETag(tracks[1]); err != nil {
+		t.Fatal(err)
+	}
+	list := m.folderTracks("Weezer/Weezer (1994)")
+	if len(list) != 2 || list[0].FingerprintETag != "" || list[1].FingerprintETag != "e2" {
+		t.Fatalf("unexpected tracks %+v", list)
+	}
+
+	// the first track is cached and the second isn't tried again so
+	// fpcalc and AcoustID aren't used
+	if err := m.saveFingerprint(&Fingerprint{ETag: "e1", REIDs: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := m.findTrackReleaseFingerprint(context.Background(), &list[0]); r != nil {
+		t.Errorf("expected no release got %+v", r)
+	}
+}
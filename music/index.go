@@ -0,0 +1,49 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+
+	"github.com/defsub/takeout/lib/search"
+)
+
+// RebuildIndex replaces the search and suggest indexes using the artists,
+// releases and tracks in the database. Release credits are obtained from the
+// HTTP cache when available rather than requesting them again.
+func (m *Music) RebuildIndex(ctx context.Context) error {
+	m.mbz.UseCacheFirst(true)
+	defer m.mbz.UseCacheFirst(false)
+	return m.indexAll(ctx, true)
+}
+
+// VerifyIndex reports index documents which no longer match tracks.
+func (m *Music) VerifyIndex() (*search.Report, error) {
+	s, err := m.newSearch()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.Verify(func(keys []string) []string {
+		var found []string
+		for _, t := range m.tracksFor(keys) {
+			found = append(found, t.Key)
+		}
+		return found
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/defsub/takeout/lib/audio"
+	"github.com/defsub/takeout/lib/encoding/lrc"
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/log"
+)
+
+const (
+	LyricsLRC      = "lrc"
+	LyricsText     = "txt"
+	LyricsEmbedded = "embedded"
+	// track checked for embedded lyrics and nothing found
+	LyricsNone = "none"
+
+	maxLyricsSize = 256 * 1024
+)
+
+var (
+	ErrLyricsNotFound = errors.New("lyrics not found")
+)
+
+// preferred lyrics, lowest first
+var lyricsRank = map[string]int{
+	LyricsLRC:      1,
+	LyricsText:     2,
+	LyricsEmbedded: 3,
+	LyricsNone:     4,
+}
+
+// Examples:
+// Gary Numan / The Pleasure Principle (1998) / 01-Airlane.lrc
+// Gary Numan / The Pleasure Principle (1998) / 01-Airlane.txt
+var lyricsRegexp = regexp.MustCompile(`(?i)\.(lrc|txt)$`)
+
+func matchLyrics(key string) *Lyrics {
+	matches := lyricsRegexp.FindStringSubmatch(key)
+	if matches == nil || len(strings.Split(key, "/")) < 3 {
+		return nil
+	}
+	return &Lyrics{
+		Base:   trackBase(key),
+		Source: strings.ToLower(matches[1]),
+	}
+}
+
+// trackBase is the key without the extension.
+func trackBase(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+// addLyrics saves a lyrics sidecar found in the bucket unless the track
+// already has preferred lyrics. The text is read later when the lyrics are
+// synced.
+func (m *Music) addLyrics(l *Lyrics) error {
+	curr, err := m.trackLyrics(l.Base)
+	if err == nil {
+		if lyricsRank[curr.Source] < lyricsRank[l.Source] {
+			return nil
+		}
+		if curr.Key == l.Key && curr.ETag == l.ETag {
+			// unchanged
+			return nil
+		}
+	}
+	return m.saveLyrics(l)
+}
+
+// syncLyrics reads the text of new lyrics sidecars and checks tracks added
+// since the last sync for embedded lyrics. Sidecars that don't match a track,
+// like notes.txt, are removed. Tracks are only checked again for embedded
+// lyrics when the track etag changes.
+func (m *Music) syncLyrics(ctx context.Context, lastSync time.Time) error {
+	if len(m.buckets) == 0 {
+		return nil
+	}
+
+	tracks := make(map[string]bool)
+	for _, t := range m.allTracks() {
+		tracks[trackBase(t.Key)] = true
+	}
+	lyrics := make(map[string]Lyrics)
+	for _, l := range m.allLyrics() {
+		lyrics[l.Base] = l
+	}
+	added := m.tracksAddedSince(lastSync)
+
+	job.AddTotal(ctx, len(lyrics)+len(added))
+	for base, l := range lyrics {
+		if ctx.Err() != nil {
+			return nil
+		}
+		job.Step(ctx)
+		if l.Source != LyricsLRC && l.Source != LyricsText {
+			continue
+		}
+		if _, ok := tracks[base]; !ok {
+			delete(lyrics, base)
+			if err := m.removeLyrics(&l); err != nil {
+				return err
+			}
+			continue
+		}
+		if l.Text != "" {
+			continue
+		}
+		text, err := m.readLyrics(&l)
+		if err != nil {
+			log.Printf("lyrics %s: %s\n", l.Key, err)
+			continue
+		}
+		l.Text = text
+		if err := m.saveLyrics(&l); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range added {
+		if ctx.Err() != nil {
+			return nil
+		}
+		job.Step(ctx)
+		base := trackBase(t.Key)
+		if l, ok := lyrics[base]; ok {
+			if l.Source == LyricsLRC || l.Source == LyricsText ||
+				(l.Key == t.Key && l.ETag == t.ETag) {
+				continue
+			}
+		}
+		l := Lyrics{Base: base, Bucket: t.Bucket, Key: t.Key, Size: t.Size,
+			ETag: t.ETag, Source: LyricsNone}
+		text, err := audio.Lyrics(m.bucketReader(&t), t.Size)
+		if err == nil {
+			l.Source = LyricsEmbedded
+			l.Text = text
+		} else if err != audio.ErrNoLyrics {
+			log.Printf("embedded lyrics %s: %s\n", t.Key, err)
+			continue
+		}
+		if err := m.saveLyrics(&l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLyrics reads a lyrics sidecar from its source bucket.
+func (m *Music) readLyrics(l *Lyrics) (string, error) {
+	size := l.Size
+	if size > maxLyricsSize {
+		size = maxLyricsSize
+	}
+	r := m.bucketFor(l.Bucket).ReaderAt(l.Key)
+	data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(data), "\ufeff")), nil
+}
+
+// TrackLyrics returns the lyrics for the track.
+func (m *Music) TrackLyrics(t Track) (*Lyrics, error) {
+	l, err := m.trackLyrics(trackBase(t.Key))
+	if err != nil || l.Text == "" {
+		return nil, ErrLyricsNotFound
+	}
+	return l, nil
+}
+
+// Synced is true when the lyrics have timestamps.
+func (l *Lyrics) Synced() bool {
+	return lrc.Synced(l.Text)
+}
+
+// Lines returns the timestamped lines of synced lyrics.
+func (l *Lyrics) Lines() []lrc.Line {
+	return lrc.Parse(l.Text)
+}
+
+// Unsynced returns the lyrics text without timestamps.
+func (l *Lyrics) Unsynced() string {
+	return lrc.Text(l.Text)
+}
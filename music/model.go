@@ -39,6 +39,21 @@ type Artist struct {
 	Genre          string
 }
 
+// NewRelease is a recent or upcoming release group by a library artist
+// found by the new release watcher. FirstSeen is when the watcher first
+// found it.
+type NewRelease struct {
+	gorm.Model
+	RGID           string `gorm:"uniqueIndex:idx_new_release_rgid"`
+	ARID           string `gorm:"index:idx_new_release_arid"`
+	Artist         string
+	Name           string
+	Disambiguation string
+	Type           string
+	Date           time.Time // first release date, may be in the future
+	FirstSeen      time.Time
+}
+
 // Release info from MusicBrainz.
 type Release struct {
 	gorm.Model
@@ -130,6 +145,7 @@ type Track struct {
 	TrackNum     int    `spiff:"tracknum"`
 	DiscNum      int
 	Title        string `spiff:"title" gorm:"index:idx_track_title"`
+	Bucket       string `json:"-"` // source bucket id
 	Key          string // TODO - unique constraint
 	Size         int64
 	ETag         string
@@ -148,6 +164,176 @@ type Track struct {
 	BackArtwork  bool
 	OtherArtwork string
 	GroupArtwork bool
+	Duration     int    `spiff:"duration"` // milliseconds
+	DurationETag string `json:"-"`         // etag when the duration couldn't be read
+	AnalysisETag string `json:"-"`         // etag when the track couldn't be analyzed
+	// etag when the track couldn't be fingerprinted
+	FingerprintETag string `json:"-"`
+}
+
+// ArtistCredit is an artist credited on a release track, from the
+// MusicBrainz track artist credits. Tracks on compilations have the release
+// artist, like Various Artists, so these link the track recording to each
+// performing artist.
+type ArtistCredit struct {
+	gorm.Model
+	REID string `gorm:"index:idx_artist_credit_reid"`
+	RID  string `gorm:"index:idx_artist_credit_rid"`
+	ARID string `gorm:"index:idx_artist_credit_arid"`
+	Name string
+}
+
+// Work is the MusicBrainz work performed in a release recording. Movements
+// are parts of a larger work, like a symphony, so WorkID and Title are for
+// the larger work and PartID and PartTitle are for the movement.
+type Work struct {
+	gorm.Model
+	REID       string `gorm:"index:idx_work_reid"`
+	RID        string `gorm:"index:idx_work_rid"`
+	WorkID     string `gorm:"index:idx_work_work_id"`
+	Title      string
+	PartID     string
+	PartTitle  string
+	Movement   int
+	Composer   string
+	ComposerID string `gorm:"index:idx_work_composer_id"`
+}
+
+// Composer has the number of works in the library by the composer.
+type Composer struct {
+	Name       string
+	ComposerID string
+	Works      int
+}
+
+// Credit is a person credited with a role on a release or recording, such
+// as producer, composer or guitar. Release credits have no recording ID.
+type Credit struct {
+	gorm.Model
+	REID string `gorm:"index:idx_credit_reid"`
+	RID  string `gorm:"index:idx_credit_rid"`
+	ARID string `gorm:"index:idx_credit_arid"`
+	Role string
+	Name string
+}
+
+// ArtistRelation is a relation from an artist to another artist, such as a
+// band member or collaboration, from MusicBrainz. The target artist may not
+// be in the library.
+type ArtistRelation struct {
+	gorm.Model
+	ARID       string `gorm:"index:idx_relation_arid"`
+	Type       string
+	TargetARID string `gorm:"index:idx_relation_target"`
+	TargetName string
+	Attributes string
+	Begin      time.Time
+	End        time.Time
+	Ended      bool
+}
+
+// Concert is a setlist from setlist.fm for an artist.
+type Concert struct {
+	gorm.Model
+	ARID      string `gorm:"index:idx_concert_arid"`
+	SetlistID string `gorm:"uniqueIndex:idx_concert_setlist"`
+	Date      time.Time
+	Tour      string
+	Venue     string
+	City      string
+	Country   string
+	URL       string
+	Songs     string // song names, one per line
+}
+
+// ConcertSearch is a setlist.fm search which has already been stored, so it
+// isn't requested again unless it may have new concerts.
+type ConcertSearch struct {
+	gorm.Model
+	ARID     string `gorm:"uniqueIndex:idx_concert_search"`
+	Query    string `gorm:"uniqueIndex:idx_concert_search"`
+	Searched time.Time
+}
+
+// Pin assigns the tracks in a bucket folder, like "Artist/Release (1999)",
+// to a specific MusicBrainz release or release group. Pins are used instead
+// of automatic release matching during sync.
+type Pin struct {
+	gorm.Model
+	Path string `gorm:"uniqueIndex:idx_pin_path"`
+	REID string
+	RGID string
+}
+
+// Fingerprint is the Chromaprint fingerprint of a bucket object, identified
+// by ETag, along with the AcoustID recordings (RIDs) and the releases with
+// those recordings (REIDs). IDs are comma separated.
+type Fingerprint struct {
+	gorm.Model
+	ETag        string `gorm:"uniqueIndex:idx_fingerprint_etag"`
+	Duration    int    // seconds
+	Fingerprint string
+	RIDs        string
+	REIDs       string
+}
+
+// LocalArtwork is an image in the bucket. Release covers are image files in
+// the release folder, like "Artist/Release (1999)/cover.jpg", or the picture
+// embedded in the first track. Artist images are in the artist folder, like
+// "Artist/artist.jpg".
+type LocalArtwork struct {
+	gorm.Model
+	Folder string `gorm:"uniqueIndex:idx_local_artwork_folder"`
+	Bucket string // source bucket id
+	Key    string
+	Size   int64
+	Source string
+	Artist string
+	REID   string `gorm:"index:idx_local_artwork_reid"`
+	ARID   string `gorm:"index:idx_local_artwork_arid"`
+}
+
+// Analysis has technical information and measurements of the track audio
+// stored by bucket object ETag. Bitrate is in kbps, loudness is integrated
+// loudness in LUFS, gains are ReplayGain in dB and peaks are linear
+// amplitude.
+type Analysis struct {
+	gorm.Model
+	ETag       string `gorm:"uniqueIndex:idx_analysis_etag"`
+	Codec      string
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Loudness   float64
+	TrackGain  float64
+	TrackPeak  float64
+	AlbumGain  float64
+	AlbumPeak  float64
+	BPM        float64
+}
+
+// Lyrics for a track. Sidecar files are next to the track with the same
+// name, like "Artist/Release (1999)/01-Title.lrc". Base is the track key
+// without the extension. Embedded lyrics use the track key and etag.
+type Lyrics struct {
+	gorm.Model
+	Base   string `gorm:"uniqueIndex:idx_lyrics_base"`
+	Bucket string // source bucket id
+	Key    string
+	Size   int64
+	ETag   string
+	Source string
+	Text   string
+}
+
+// TracksDuration is the total duration of the tracks in milliseconds.
+func TracksDuration(tracks []Track) int {
+	total := 0
+	for _, t := range tracks {
+		total += t.Duration
+	}
+	return total
 }
 
 func (t *Track) BeforeCreate(tx *g.DB) (err error) {
@@ -155,6 +341,16 @@ func (t *Track) BeforeCreate(tx *g.DB) (err error) {
 	return
 }
 
+// folder is the artist and release folder of the track, like
+// "Artist/Release (1999)".
+func (t Track) folder() string {
+	matches := pathRegexp.FindStringSubmatch(t.Key)
+	if matches == nil {
+		return ""
+	}
+	return matches[1] + "/" + matches[2]
+}
+
 func (t Track) releaseKey() string {
 	return fmt.Sprintf("%s/%s/%d/%d", t.Artist, t.Release, t.TrackCount, t.DiscCount)
 }
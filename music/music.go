@@ -28,12 +28,15 @@ import (
 
 	"github.com/defsub/takeout/auth"
 	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/acoustid"
+	"github.com/defsub/takeout/lib/analysis"
 	"github.com/defsub/takeout/lib/bucket"
 	"github.com/defsub/takeout/lib/client"
 	"github.com/defsub/takeout/lib/fanart"
 	"github.com/defsub/takeout/lib/lastfm"
 	"github.com/defsub/takeout/lib/musicbrainz"
 	"github.com/defsub/takeout/lib/search"
+	"github.com/defsub/takeout/lib/setlist"
 	"gorm.io/gorm"
 )
 
@@ -45,22 +48,28 @@ const (
 var coverCache map[string]string = make(map[string]string)
 
 type Music struct {
-	config  *config.Config
-	db      *gorm.DB
-	buckets []bucket.Bucket
-	client  *client.Client
-	lastfm  *lastfm.Lastfm
-	fanart  *fanart.Fanart
-	mbz     *musicbrainz.MusicBrainz
+	config   *config.Config
+	db       *gorm.DB
+	buckets  []bucket.Bucket
+	client   *client.Client
+	lastfm   *lastfm.Lastfm
+	fanart   *fanart.Fanart
+	mbz      *musicbrainz.MusicBrainz
+	setlist  *setlist.Setlist
+	acoustid *acoustid.AcoustID
+	analyzer *analysis.Analyzer
 }
 
 func NewMusic(config *config.Config) *Music {
 	return &Music{
-		config: config,
-		client: client.NewClient(&config.Client),
-		fanart: fanart.NewFanart(config),
-		lastfm: lastfm.NewLastfm(config),
-		mbz:    musicbrainz.NewMusicBrainz(config),
+		config:   config,
+		client:   client.NewClient(&config.Client),
+		fanart:   fanart.NewFanart(config),
+		lastfm:   lastfm.NewLastfm(config),
+		mbz:      musicbrainz.NewMusicBrainz(config),
+		setlist:  setlist.NewSetlist(config, client.NewClient(&config.Client)),
+		acoustid: acoustid.NewAcoustID(config, client.NewClient(&config.Client)),
+		analyzer: analysis.NewAnalyzer(config),
 	}
 }
 
@@ -120,7 +129,7 @@ func CoverArtArchiveImage(r Release) string {
 func (m *Music) CoverSmall(o interface{}) string {
 	switch o.(type) {
 	case Release:
-		return o.(Release).Cover("250")
+		return m.releaseCover(o.(Release), "250")
 	case Track:
 		return m.TrackCover(o.(Track), "250")
 	}
@@ -138,7 +147,7 @@ func (m *Music) TrackCover(t Track, size string) string {
 	if release == nil {
 		v = ""
 	} else {
-		v = Cover(*release, size)
+		v = m.releaseCover(*release, size)
 	}
 	coverCache[t.REID] = v
 	return v
@@ -215,6 +224,9 @@ func (m *Music) newSearch() (*search.Search, error) {
 	s := search.NewSearch(m.config)
 	s.Keywords = []string{
 		FieldGenre,
+		FieldLabel,
+		FieldSeries,
+		FieldSortTitle,
 		FieldStatus,
 		FieldTag,
 		FieldType,
@@ -226,6 +238,91 @@ func (m *Music) newSearch() (*search.Search, error) {
 	return s, nil
 }
 
+const (
+	SuggestArtist  = "artist"
+	SuggestRelease = "release"
+	SuggestTrack   = "track"
+)
+
+func (m *Music) newSuggest() (*search.Suggest, error) {
+	s := search.NewSuggest(m.config)
+	err := s.Open("music_suggest")
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Suggest artist, release and track names which match the prefix.
+func (m *Music) Suggest(prefix string, limit int) []search.Suggestion {
+	s, err := m.newSuggest()
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	defer s.Close()
+	list, err := s.Suggest(prefix, limit)
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	return list
+}
+
+var (
+	sortFields = map[string]string{
+		search.SortDate:       FieldDate,
+		search.SortPopularity: FieldPopularity, // rank
+		search.SortTitle:      FieldSortTitle,
+	}
+	facetFields = []string{
+		FieldGenre,
+		FieldLabel,
+		FieldType,
+	}
+)
+
+// SearchPage returns tracks for one page of results in the sort order along
+// with the total hits, scores and facet counts.
+func (m *Music) SearchPage(q string, offset, limit int, sort string) ([]Track, *search.Result, error) {
+	order, err := search.SortOrder(sort, sortFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := m.newSearch()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.Close()
+
+	result, err := s.Query(search.Request{
+		Query:   q,
+		Offset:  offset,
+		Size:    limit,
+		Sort:    order,
+		Facets:  facetFields,
+		Decades: FieldDate,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := result.Keys()
+	tracks := make(map[string]Track)
+	for _, t := range m.tracksFor(keys) {
+		tracks[t.Key] = t
+	}
+	// keep hit order and scores aligned with tracks
+	var list []Track
+	var hits []search.Hit
+	for _, h := range result.Hits {
+		if t, ok := tracks[h.ID]; ok {
+			list = append(list, t)
+			hits = append(hits, h)
+		}
+	}
+	result.Hits = hits
+	return list, result, nil
+}
+
 func (m *Music) Search(q string, limit ...int) []Track {
 	s, err := m.newSearch()
 	if err != nil {
@@ -350,9 +447,9 @@ func (m *Music) CreateStations() {
 }
 
 func (m *Music) ArtistRadio(artist Artist) []Track {
-	tracks := m.ArtistSimilar(artist,
+	tracks := m.Dedupe(m.ArtistSimilar(artist,
 		m.config.Music.ArtistRadioDepth,
-		m.config.Music.ArtistRadioBreadth)
+		m.config.Music.ArtistRadioBreadth))
 	if len(tracks) > m.config.Music.RadioLimit {
 		tracks = tracks[:m.config.Music.RadioLimit]
 	}
@@ -387,7 +484,7 @@ func (m *Music) ArtistShuffle(artist Artist, depth int) []Track {
 		}
 		pick++
 	}
-	return Shuffle(tracks)
+	return Shuffle(m.Dedupe(tracks))
 }
 
 func (m *Music) ArtistDeep(artist Artist, depth int) []Track {
@@ -400,6 +497,10 @@ func contains(tracks []Track, t Track) bool {
 		if v.Title == t.Title && v.Artist == t.Artist {
 			return true
 		}
+		if v.RID != "" && v.RID == t.RID {
+			// same recording on another release
+			return true
+		}
 	}
 
 	return false
@@ -424,6 +525,10 @@ func (m *Music) UnmatchedTracks() []Track {
 }
 
 func (m *Music) ArtistImage(artist *Artist) string {
+	return m.artistImage(artist, m.fanartImage(artist))
+}
+
+func (m *Music) fanartImage(artist *Artist) string {
 	imgs := m.artistImages(artist)
 	if len(imgs) == 0 {
 		return ""
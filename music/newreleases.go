@@ -0,0 +1,129 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/log"
+	"github.com/defsub/takeout/lib/musicbrainz"
+)
+
+// SyncNewReleases checks MusicBrainz for release groups by library artists
+// with a first release date within Music.NewReleaseWindow or in the future.
+// Each release group is stored once along with the time it was first seen.
+func (m *Music) SyncNewReleases(ctx context.Context) error {
+	now := time.Now()
+	since := now.Add(-m.config.Music.NewReleaseWindow)
+
+	var mu sync.Mutex
+	var syncErr error
+	artists := m.Artists()
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
+	for _, a := range artists {
+		if ctx.Err() != nil {
+			break
+		}
+		a := a
+		p.Submit(func() {
+			defer job.Step(ctx)
+			if ctx.Err() != nil || a.ARID == "" {
+				return
+			}
+			// cached release groups are only used within the sync
+			// interval so new announcements are found
+			groups, err := m.mbz.ArtistReleaseGroups(a.ARID,
+				m.config.Music.NewReleaseSyncInterval)
+			if err != nil {
+				log.Printf("new releases %s: %s\n", a.Name, err)
+				return
+			}
+			// serialize database updates
+			mu.Lock()
+			defer mu.Unlock()
+			for _, rg := range groups {
+				if syncErr != nil {
+					return
+				}
+				if !m.newReleaseType(rg) {
+					continue
+				}
+				d := rg.FirstReleaseTime()
+				if d.IsZero() || d.Before(since) || m.newReleaseSeen(rg.ID) {
+					continue
+				}
+				syncErr = m.createNewRelease(&NewRelease{
+					RGID:           rg.ID,
+					ARID:           a.ARID,
+					Artist:         a.Name,
+					Name:           fixName(rg.Title),
+					Disambiguation: rg.Disambiguation,
+					Type:           rg.PrimaryType,
+					Date:           d,
+					FirstSeen:      now,
+				})
+			}
+		})
+	}
+	p.Wait()
+	return syncErr
+}
+
+// newReleaseType returns true for release groups with a primary type in
+// Music.NewReleaseTypes and no secondary types, like live or compilation.
+func (m *Music) newReleaseType(rg musicbrainz.ReleaseGroup) bool {
+	if len(rg.SecondaryTypes) > 0 {
+		return false
+	}
+	for _, t := range m.config.Music.NewReleaseTypes {
+		if strings.EqualFold(t, rg.PrimaryType) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewReleases returns recent and upcoming releases by library artists that
+// aren't in the library, most recent first. Artist plays are optional
+// release group play counts used to list releases by the most played
+// artists first, see Music.NewReleaseActivity.
+func (m *Music) NewReleases(plays map[string]int) []NewRelease {
+	releases := m.newReleases(m.config.Music.NewReleaseLimit)
+	if !m.config.Music.NewReleaseActivity || len(plays) == 0 {
+		return releases
+	}
+
+	var rgids []string
+	for rgid := range plays {
+		rgids = append(rgids, rgid)
+	}
+	artistPlays := make(map[string]int)
+	for rgid, artist := range m.releaseGroupArtists(rgids) {
+		artistPlays[artist] += plays[rgid]
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return artistPlays[releases[i].Artist] > artistPlays[releases[j].Artist]
+	})
+	return releases
+}
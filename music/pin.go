@@ -0,0 +1,193 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/defsub/takeout/lib/log"
+)
+
+var (
+	ErrInvalidPin      = errors.New("pin requires either a release or release group ID")
+	ErrPinNotFound     = errors.New("pin not found")
+	ErrNoTracks        = errors.New("no tracks in folder")
+	ErrReleaseNotFound = errors.New("release not found")
+)
+
+// Pins returns all release pins ordered by path.
+func (m *Music) Pins() []Pin {
+	return m.pins()
+}
+
+// PinFolder saves a pin of the tracks in the bucket folder to a MusicBrainz
+// release (reid) or release group (rgid). The tracks are assigned to the
+// release by SyncPin or during the next sync.
+func (m *Music) PinFolder(path, reid, rgid string) (*Pin, error) {
+	path = strings.Trim(path, "/")
+	if (reid == "") == (rgid == "") {
+		return nil, ErrInvalidPin
+	}
+	if len(m.folderTracks(path)) == 0 {
+		return nil, ErrNoTracks
+	}
+	pin := &Pin{Path: path, REID: reid, RGID: rgid}
+	err := m.savePin(pin)
+	if err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+// Unpin removes the pin and clears the release for the pinned tracks so they
+// are matched automatically during the next sync.
+func (m *Music) Unpin(id int) error {
+	pin, err := m.lookupPin(id)
+	if err != nil {
+		return ErrPinNotFound
+	}
+	for _, t := range m.folderTracks(pin.Path) {
+		err = m.clearTrackRelease(t)
+		if err != nil {
+			return err
+		}
+	}
+	return m.deletePin(&pin)
+}
+
+// ReleaseChoices are the candidate releases for the tracks in the bucket
+// folder.
+func (m *Music) ReleaseChoices(path string) ([]Release, error) {
+	tracks := m.folderTracks(strings.Trim(path, "/"))
+	if len(tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+	t := tracks[0]
+	releases := m.trackReleaseChoices(&t)
+	if len(releases) == 0 {
+		releases = m.disambiguate(t.Artist, t.TrackCount, t.DiscCount)
+	}
+	return releases, nil
+}
+
+// pinnedPaths are the folders with pins.
+func (m *Music) pinnedPaths() map[string]bool {
+	paths := make(map[string]bool)
+	for _, p := range m.pins() {
+		paths[p.Path] = true
+	}
+	return paths
+}
+
+// applyPins assigns pinned tracks to their pinned releases.
+func (m *Music) applyPins() (bool, error) {
+	modified := false
+	for _, p := range m.pins() {
+		changed, err := m.applyPin(p)
+		if err != nil {
+			log.Printf("pin %s: %s\n", p.Path, err)
+			continue
+		}
+		modified = modified || changed
+	}
+	return modified, nil
+}
+
+func (m *Music) applyPin(p Pin) (bool, error) {
+	tracks := m.folderTracks(p.Path)
+	if len(tracks) == 0 {
+		return false, nil
+	}
+	r, err := m.pinnedRelease(p, tracks[0])
+	if err != nil {
+		return false, err
+	}
+	modified := false
+	for _, t := range tracks {
+		if t.REID == r.REID && t.RGID == r.RGID {
+			continue
+		}
+		err := m.assignTrackRelease(&t, r)
+		if err != nil {
+			return modified, err
+		}
+		modified = true
+	}
+	if modified {
+		err = m.checkReleaseArtwork(r)
+		if err != nil {
+			log.Println(err)
+		}
+		if a := m.Artist(r.Artist); a != nil {
+			err = m.fixTrackReleaseTitlesFor([]Artist{*a})
+		}
+	}
+	return modified, err
+}
+
+// pinnedRelease finds the pinned release, requesting it from MusicBrainz when
+// it's not already synced. For release groups, releases with the same track
+// and disc counts are preferred.
+func (m *Music) pinnedRelease(p Pin, t Track) (*Release, error) {
+	if p.REID != "" {
+		r, _ := m.release(p.REID)
+		if r != nil {
+			return r, nil
+		}
+		v, err := m.mbz.Release(p.REID)
+		if err != nil {
+			return nil, err
+		}
+		err = m.updateReleases([]Release{doRelease(t.Artist, *v)})
+		if err != nil {
+			return nil, err
+		}
+		return m.release(p.REID)
+	}
+
+	releases := m.releaseGroupReleases(p.RGID)
+	if len(releases) == 0 {
+		list, err := m.mbz.Releases(p.RGID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			releases = append(releases, doRelease(t.Artist, v))
+		}
+		err = m.updateReleases(releases)
+		if err != nil {
+			return nil, err
+		}
+		releases = m.releaseGroupReleases(p.RGID)
+	}
+	var matched []Release
+	for _, r := range releases {
+		if r.TrackCount == t.TrackCount && r.DiscCount == t.DiscCount {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) > 0 {
+		releases = matched
+	}
+	r := m.pickRelease(releases)
+	if r == nil {
+		return nil, ErrReleaseNotFound
+	}
+	return r, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+)
+
+func TestTrackFolder(t *testing.T) {
+	for key, folder := range map[string]string{
+		"Music/Gary Numan/The Pleasure Principle (1998)/01-Airlane.flac": "Gary Numan/The Pleasure Principle (1998)",
+		"AC_DC/Back in Black/1-01-Hells Bells.mp3":                       "AC_DC/Back in Black",
+		"Airlane.flac": "",
+	} {
+		v := Track{Key: key}.folder()
+		if v != folder {
+			t.Errorf("expected '%s' got '%s'", folder, v)
+		}
+	}
+}
+
+func TestPinFolder(t *testing.T) {
+	m := testDB(t)
+	track := Track{Key: "Music/Weezer/Weezer (1994)/01-My Name Is Jonas.flac",
+		Artist: "Weezer", Release: "Weezer", Title: "My Name Is Jonas"}
+	if err := m.createTrack(&track); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.PinFolder("Weezer/Weezer (1994)", "", ""); err != ErrInvalidPin {
+		t.Errorf("expected invalid pin got %v", err)
+	}
+	if _, err := m.PinFolder("Weezer/Weezer (1994)", "r1", "rg1"); err != ErrInvalidPin {
+		t.Errorf("expected invalid pin got %v", err)
+	}
+	if _, err := m.PinFolder("Weezer/Pinkerton (1996)", "r1", ""); err != ErrNoTracks {
+		t.Errorf("expected no tracks got %v", err)
+	}
+
+	// the pin is saved without assigning the tracks
+	pin, err := m.PinFolder("/Weezer/Weezer (1994)/", "r1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := m.Pins()
+	if len(pins) != 1 || pins[0].ID != pin.ID ||
+		pins[0].Path != "Weezer/Weezer (1994)" || pins[0].REID != "r1" {
+		t.Errorf("unexpected pins %+v", pins)
+	}
+	if tracks := m.folderTracks(pin.Path); len(tracks) != 1 || tracks[0].REID != "" {
+		t.Errorf("expected unassigned track got %+v", tracks)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"strings"
+
+	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/musicbrainz"
+)
+
+// Artist relation types from the point of view of the artist.
+const (
+	RelationMember        = "member"        // band has member
+	RelationMemberOf      = "member of"     // person is member of band
+	RelationCollaborator  = "collaborator"  // collaboration has collaborator
+	RelationCollaboration = "collaboration" // person is part of collaboration
+	RelationPerformsAs    = "performs as"   // person performs as
+	RelationIsPerson      = "is person"     // performance name is person
+)
+
+var relationTypes = map[string][2]string{
+	// MusicBrainz type: forward, backward
+	"member of band": {RelationMemberOf, RelationMember},
+	"collaboration":  {RelationCollaboration, RelationCollaborator},
+	"is person":      {RelationPerformsAs, RelationIsPerson},
+}
+
+// artistRelations returns the supported artist relations from MusicBrainz
+// artist detail.
+func artistRelations(detail *musicbrainz.Artist) []ArtistRelation {
+	var relations []ArtistRelation
+	for _, r := range detail.Relations {
+		if r.TargetType != "artist" || r.Artist.ID == "" {
+			continue
+		}
+		types, ok := relationTypes[r.Type]
+		if !ok {
+			continue
+		}
+		relType := types[0]
+		if r.Direction == "backward" {
+			relType = types[1]
+		}
+		relations = append(relations, ArtistRelation{
+			ARID:       detail.ID,
+			Type:       relType,
+			TargetARID: r.Artist.ID,
+			TargetName: r.Artist.Name,
+			Attributes: strings.Join(r.Attributes, ", "),
+			Begin:      date.ParseDate(r.Begin),
+			End:        date.ParseDate(r.End),
+			Ended:      r.Ended,
+		})
+	}
+	return relations
+}
+
+// RelatedArtist is an artist relation with the target artist when it's in
+// the library.
+type RelatedArtist struct {
+	Relation ArtistRelation
+	Artist   *Artist
+}
+
+// RelatedArtists returns the band members, bands, collaborations and
+// performance names related to the artist.
+func (m *Music) RelatedArtists(artist Artist) []RelatedArtist {
+	relations := m.artistRelations(artist.ARID)
+	var arids []string
+	for _, r := range relations {
+		arids = append(arids, r.TargetARID)
+	}
+	library := make(map[string]Artist)
+	for _, a := range m.artistsByMBID(arids) {
+		library[a.ARID] = a
+	}
+	var related []RelatedArtist
+	for _, r := range relations {
+		v := RelatedArtist{Relation: r}
+		if a, ok := library[r.TargetARID]; ok {
+			v.Artist = &a
+		}
+		related = append(related, v)
+	}
+	return related
+}
+
+// ArtistFamily returns library artists related to the artist, including
+// other projects of the artist's members.
+func (m *Music) ArtistFamily(artist Artist) []Artist {
+	var family []Artist
+	for _, a := range m.artistsByMBID(m.familyARIDs(artist.ARID)) {
+		if a.ARID != artist.ARID {
+			family = append(family, a)
+		}
+	}
+	return family
+}
+
+// ArtistFamilyRadio returns popular tracks from the artist and the artist's
+// family.
+func (m *Music) ArtistFamilyRadio(artist Artist) []Track {
+	depth := m.config.Music.ArtistRadioDepth
+	tracks := m.ArtistPopularTracks(artist, depth)
+	for _, a := range m.ArtistFamily(artist) {
+		tracks = append(tracks, m.ArtistPopularTracks(a, depth)...)
+	}
+	tracks = Shuffle(tracks)
+	if len(tracks) > m.config.Music.RadioLimit {
+		tracks = tracks[:m.config.Music.RadioLimit]
+	}
+	return tracks
+}
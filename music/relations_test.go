@@ -0,0 +1,53 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+
+	"github.com/defsub/takeout/lib/musicbrainz"
+)
+
+func TestArtistRelations(t *testing.T) {
+	grohl := musicbrainz.Artist{ID: "a1", Name: "Dave Grohl"}
+	detail := &musicbrainz.Artist{
+		ID:   "a2",
+		Name: "Nirvana",
+		Relations: []musicbrainz.Relation{
+			{Type: "member of band", TargetType: "artist", Direction: "backward",
+				Artist: grohl, Begin: "1990-09", Attributes: []string{"drums"}},
+			{Type: "collaboration", TargetType: "artist", Direction: "forward",
+				Artist: musicbrainz.Artist{ID: "a3", Name: "Sound City Players"}},
+			{Type: "tribute", TargetType: "artist", Direction: "backward",
+				Artist: musicbrainz.Artist{ID: "a4"}},
+			{Type: "official homepage", TargetType: "url"},
+		},
+	}
+	relations := artistRelations(detail)
+	if len(relations) != 2 {
+		t.Fatalf("expected 2 relations, got %d", len(relations))
+	}
+	r := relations[0]
+	if r.ARID != "a2" || r.Type != RelationMember || r.TargetARID != "a1" ||
+		r.TargetName != "Dave Grohl" || r.Attributes != "drums" || r.Begin.Year() != 1990 {
+		t.Errorf("unexpected member %+v", r)
+	}
+	if relations[1].Type != RelationCollaboration {
+		t.Errorf("expected collaboration got %s", relations[1].Type)
+	}
+}
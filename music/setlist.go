@@ -0,0 +1,166 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/defsub/takeout/lib/setlist"
+)
+
+var (
+	ErrConcertNotFound = errors.New("concert not found")
+)
+
+// ConcertSetlist has the library tracks for the songs played at a concert
+// along with songs which aren't in the library.
+type ConcertSetlist struct {
+	Concert Concert
+	Tracks  []Track
+	Missing []string
+}
+
+func (c Concert) songs() []string {
+	if c.Songs == "" {
+		return nil
+	}
+	return strings.Split(c.Songs, "\n")
+}
+
+func concert(arid string, c setlist.Concert) Concert {
+	var songs []string
+	for _, s := range c.Songs() {
+		songs = append(songs, strings.ReplaceAll(s.Name, "\n", " "))
+	}
+	return Concert{
+		ARID:      arid,
+		SetlistID: c.Id,
+		Date:      c.Date(),
+		Tour:      c.Tour.Name,
+		Venue:     c.Venue.Name,
+		City:      c.Venue.City.Name,
+		Country:   c.Venue.City.Country.Name,
+		URL:       c.Url,
+		Songs:     strings.Join(songs, "\n"),
+	}
+}
+
+// ArtistYearSetlist returns the setlist for the artist's most complete
+// concert during the year.
+func (m *Music) ArtistYearSetlist(artist Artist, year int) (*ConcertSetlist, error) {
+	query := fmt.Sprintf("year:%d", year)
+	current := year >= time.Now().Year()
+	err := m.fetchConcerts(artist, query, current, func() ([]setlist.Concert, error) {
+		return m.setlist.ArtistYear(artist.ARID, year)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.concertSetlist(artist, m.yearConcerts(artist.ARID, year))
+}
+
+// ArtistTourSetlist returns the setlist for the artist's most complete
+// concert during the tour.
+func (m *Music) ArtistTourSetlist(artist Artist, tour string) (*ConcertSetlist, error) {
+	query := fmt.Sprintf("tour:%s", tour)
+	current := m.currentTour(artist.ARID, tour)
+	err := m.fetchConcerts(artist, query, current, func() ([]setlist.Concert, error) {
+		return m.setlist.ArtistTour(artist.ARID, tour)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.concertSetlist(artist, m.tourConcerts(artist.ARID, tour))
+}
+
+// currentTour returns true if the tour has no stored concerts or has
+// concerts within the configured Setlist.TourRecent.
+func (m *Music) currentTour(arid, tour string) bool {
+	concerts := m.tourConcerts(arid, tour)
+	if len(concerts) == 0 {
+		return true
+	}
+	last := concerts[len(concerts)-1].Date
+	return time.Since(last) < m.config.Setlist.TourRecent
+}
+
+// fetchConcerts gets concerts from setlist.fm unless the same search was
+// already stored. Current searches, which may have new concerts, are
+// fetched again after the configured Setlist.SearchTTL.
+func (m *Music) fetchConcerts(artist Artist, query string, current bool,
+	fetch func() ([]setlist.Concert, error)) error {
+	searched := m.concertSearched(artist.ARID, query)
+	if !searched.IsZero() {
+		if !current || time.Since(searched) < m.config.Setlist.SearchTTL {
+			return nil
+		}
+	}
+	list, err := fetch()
+	if err != nil {
+		return err
+	}
+	var concerts []Concert
+	for _, c := range list {
+		if c.Id == "" || len(c.Songs()) == 0 {
+			continue
+		}
+		concerts = append(concerts, concert(artist.ARID, c))
+	}
+	return m.storeConcerts(artist.ARID, query, concerts)
+}
+
+// concertSetlist matches the songs from the concert with the most songs,
+// preferring later concerts, to library tracks.
+func (m *Music) concertSetlist(artist Artist, concerts []Concert) (*ConcertSetlist, error) {
+	var best *Concert
+	for i := range concerts {
+		c := &concerts[i]
+		if best == nil || len(c.songs()) >= len(best.songs()) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, ErrConcertNotFound
+	}
+
+	result := &ConcertSetlist{Concert: *best}
+	for _, song := range best.songs() {
+		tracks := m.SearchTracks(song, artist.Name, "")
+		if len(tracks) == 0 {
+			result.Missing = append(result.Missing, song)
+			continue
+		}
+		result.Tracks = append(result.Tracks, tracks[0])
+	}
+	return result, nil
+}
+
+// SetlistYearRef is a playlist ref for the artist's concert setlist during
+// the year.
+func SetlistYearRef(artist Artist, year int) string {
+	return fmt.Sprintf("/music/artists/%d/setlist/%d", artist.ID, year)
+}
+
+// SetlistTourRef is a playlist ref for the artist's concert setlist during
+// the tour. The tour name is used as is, refs aren't URLs.
+func SetlistTourRef(artist Artist, tour string) string {
+	return fmt.Sprintf("/music/artists/%d/setlist/tour/%s", artist.ID, tour)
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+
+	"github.com/defsub/takeout/lib/setlist"
+)
+
+func TestConcert(t *testing.T) {
+	c := setlist.Concert{
+		Id:        "63de4613",
+		EventDate: "17-04-1992",
+		Tour:      setlist.Tour{Name: "Nevermind"},
+		Sets: setlist.Sets{Set: []setlist.Set{
+			{Songs: []setlist.Song{{Name: "Intro", Tape: true}, {Name: "Drain You"}, {Name: "Breed"}}},
+			{Encore: 1, Songs: []setlist.Song{{Name: "Smells Like Teen Spirit"}}},
+		}},
+	}
+	v := concert("a1", c)
+	if v.ARID != "a1" || v.SetlistID != "63de4613" || v.Tour != "Nevermind" ||
+		v.Date.Year() != 1992 || v.Date.Day() != 17 {
+		t.Errorf("unexpected concert %+v", v)
+	}
+	songs := v.songs()
+	if len(songs) != 3 || songs[0] != "Drain You" || songs[2] != "Smells Like Teen Spirit" {
+		t.Errorf("unexpected songs %v", songs)
+	}
+}
+
+func TestSetlistRef(t *testing.T) {
+	artist := Artist{Name: "Nirvana"}
+	artist.ID = 7
+	if ref := SetlistYearRef(artist, 1992); ref != "/music/artists/7/setlist/1992" {
+		t.Errorf("unexpected year ref %s", ref)
+	}
+	ref := SetlistTourRef(artist, "In Utero 100% Tour")
+	if ref != "/music/artists/7/setlist/tour/In Utero 100% Tour" {
+		t.Errorf("unexpected tour ref %s", ref)
+	}
+}
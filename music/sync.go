@@ -18,18 +18,24 @@
 package music
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/audio"
 	"github.com/defsub/takeout/lib/client"
 	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/job"
 	"github.com/defsub/takeout/lib/log"
 	"github.com/defsub/takeout/lib/musicbrainz"
+	"github.com/defsub/takeout/lib/pool"
 	"github.com/defsub/takeout/lib/search"
 	"github.com/defsub/takeout/lib/str"
 )
@@ -76,53 +82,88 @@ func (m *Music) LastModified() time.Time {
 	return m.lastModified()
 }
 
-func (m *Music) Sync(options SyncOptions) {
+// Sync music metadata based on the provided options. Sync stops early and
+// returns the context error if the context is canceled. Otherwise all steps
+// are run and the first step error is returned.
+func (m *Music) Sync(ctx context.Context, options SyncOptions) error {
+	// record the first error and continue with the remaining steps
+	var syncErr error
+	check := func(err error) {
+		if err != nil {
+			log.Println(err)
+			if syncErr == nil {
+				syncErr = err
+			}
+		}
+	}
+
 	if options.Since.IsZero() {
 		if options.Tracks {
 			log.Printf("sync tracks\n")
-			log.CheckError(m.syncBucketTracks())
+			check(m.syncBucketTracks())
 			log.Printf("sync artists\n")
-			log.CheckError(m.syncArtists())
+			check(m.syncArtists(ctx))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Releases {
 			log.Printf("sync releases\n")
-			log.CheckError(m.syncReleases())
+			check(m.syncReleases(ctx))
 			log.Printf("fix track releases\n")
 			_, err := m.fixTrackReleases()
-			log.CheckError(err)
+			check(err)
 			log.Printf("assign track releases\n")
-			_, err = m.assignTrackReleases()
-			log.CheckError(err)
+			_, err = m.assignTrackReleases(ctx)
+			check(err)
 			log.Printf("fix track release titles\n")
-			log.CheckError(m.fixTrackReleaseTitles())
+			check(m.fixTrackReleaseTitles())
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Popular {
 			log.Printf("sync popular\n")
-			log.CheckError(m.syncPopular())
+			check(m.syncPopular(ctx))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Similar {
 			log.Printf("sync similar\n")
-			log.CheckError(m.syncSimilar())
+			check(m.syncSimilar(ctx))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Artwork {
 			log.Printf("sync artwork\n")
-			log.CheckError(m.syncArtwork())
+			check(m.syncArtwork(ctx))
+			log.Printf("sync local artwork\n")
+			check(m.syncLocalArtwork(ctx))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Index {
+			log.Printf("sync lyrics\n")
+			check(m.syncLyrics(ctx, time.Time{}))
 			log.Printf("sync index\n")
-			log.CheckError(m.syncIndex())
+			check(m.syncIndex(ctx))
+			log.Printf("sync durations\n")
+			check(m.syncDurations(ctx, nil))
 		}
 	} else {
 		if options.Resolve {
 			log.Printf("resolving")
-			err := m.resolve()
-			log.CheckError(err)
+			err := m.resolve(ctx)
+			check(err)
 		}
 		if options.Tracks {
 			modified, err := m.syncBucketTracksSince(options.Since)
-			log.CheckError(err)
+			check(err)
 			if modified {
-				log.CheckError(m.syncArtists())
+				check(m.syncArtists(ctx))
 			}
 		}
 		var artists []Artist
@@ -132,7 +173,7 @@ func (m *Music) Sync(options SyncOptions) {
 				artists = []Artist{*a}
 			} else {
 				a, err := m.syncArtist(options.Artist)
-				log.CheckError(err)
+				check(err)
 				if a != nil {
 					artists = []Artist{*a}
 				}
@@ -140,32 +181,62 @@ func (m *Music) Sync(options SyncOptions) {
 		} else {
 			artists = m.trackArtistsSince(options.Since)
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if options.Releases {
-			log.CheckError(m.syncReleasesFor(artists))
+			check(m.syncReleasesFor(ctx, artists))
 			_, err := m.fixTrackReleases()
-			log.CheckError(err)
-			modified, err := m.assignTrackReleases()
-			log.CheckError(err)
+			check(err)
+			modified, err := m.assignTrackReleases(ctx)
+			check(err)
 			if modified {
-				log.CheckError(m.fixTrackReleaseTitles())
+				check(m.fixTrackReleaseTitles())
 			}
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if options.Popular {
-			log.CheckError(m.syncPopularFor(artists))
+			check(m.syncPopularFor(ctx, artists))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Similar {
-			log.CheckError(m.syncSimilarFor(artists))
+			check(m.syncSimilarFor(ctx, artists))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		if options.Artwork {
-			log.CheckError(m.syncArtworkFor(artists))
+			check(m.syncArtworkFor(ctx, artists))
 			if len(artists) > 0 {
-				log.CheckError(m.syncMissingArtwork())
+				check(m.syncMissingArtwork())
+				check(m.syncLocalArtwork(ctx))
 			}
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if options.Index {
-			log.CheckError(m.syncIndexFor(artists))
+			check(m.syncLyrics(ctx, options.Since))
+			if m.indexStale() {
+				// mapping changed so index everything
+				log.Printf("sync stale index\n")
+				check(m.syncIndex(ctx))
+			} else {
+				check(m.syncIndexFor(ctx, artists))
+			}
+			if len(artists) > 0 {
+				check(m.syncDurations(ctx, artists))
+			}
 		}
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return syncErr
 }
 
 // TODO update steps
@@ -192,25 +263,52 @@ func (m *Music) Sync(options SyncOptions) {
 
 func (m *Music) syncBucketTracks() error {
 	m.deleteTracks() // !!!
+	m.deleteLocalArtwork()
+	m.deleteSidecarLyrics()
 	_, err := m.syncBucketTracksSince(time.Time{})
 	return err
 }
 
 func (m *Music) syncBucketTracksSince(lastSync time.Time) (modified bool, err error) {
 	for _, b := range m.buckets {
-		trackCh, err := m.syncFromBucket(b, lastSync)
+		trackCh, artCh, lyricsCh, err := m.syncFromBucket(b, lastSync)
 		if err != nil {
 			log.Printf("got sync err %s\n", err)
 			return false, err
 		}
-		for t := range trackCh {
-			//log.Printf("sync: %s/%s/%s\n", t.Artist, t.Release, t.Title)
-			t.Artist = fixName(t.Artist)
-			t.Release = fixName(t.Release)
-			t.Title = fixName(t.Title)
-			// TODO: title may have underscores - picard
-			m.createTrack(t)
-			modified = true
+		for trackCh != nil || artCh != nil || lyricsCh != nil {
+			select {
+			case t, ok := <-trackCh:
+				if !ok {
+					trackCh = nil
+					continue
+				}
+				//log.Printf("sync: %s/%s/%s\n", t.Artist, t.Release, t.Title)
+				t.Artist = fixName(t.Artist)
+				t.Release = fixName(t.Release)
+				t.Title = fixName(t.Title)
+				// TODO: title may have underscores - picard
+				m.createTrack(t)
+				modified = true
+			case a, ok := <-artCh:
+				if !ok {
+					artCh = nil
+					continue
+				}
+				err := m.addLocalArtwork(a)
+				if err != nil {
+					log.Printf("artwork %s: %s\n", a.Key, err)
+				}
+			case l, ok := <-lyricsCh:
+				if !ok {
+					lyricsCh = nil
+					continue
+				}
+				err := m.addLyrics(l)
+				if err != nil {
+					log.Printf("lyrics %s: %s\n", l.Key, err)
+				}
+			}
 		}
 		err = m.updateTrackCount()
 	}
@@ -238,78 +336,107 @@ func (m *Music) trackArtistsSince(lastSync time.Time) []Artist {
 
 // Obtain all releases for each track artist. This will update
 // existing releases as well.
-func (m *Music) syncReleases() error {
-	return m.syncReleasesFor(m.Artists())
+func (m *Music) syncReleases(ctx context.Context) error {
+	return m.syncReleasesFor(ctx, m.Artists())
 }
 
-func (m *Music) syncReleasesFor(artists []Artist) error {
+func (m *Music) syncReleasesFor(ctx context.Context, artists []Artist) error {
+	var mu sync.Mutex
+	var syncErr error
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
-		var releases []Release
-		log.Printf("releases for %s\n", a.Name)
-		if a.Name == VariousArtists {
-			// various artists has many thousands of releases so
-			// instead of getting all releases, search for them by
-			// name and then get releases
-			names := m.artistTrackReleases(a.Name)
-			for _, name := range names {
-				result, _ := m.mbz.SearchReleaseGroup(a.ARID, name)
-				for _, rg := range result.ReleaseGroups {
-					r, _ := m.mbz.Releases(rg.ID)
-					for _, v := range r {
-						releases = append(releases, doRelease(a.Name, v))
-					}
-				}
+		if ctx.Err() != nil {
+			break
+		}
+		a := a
+		p.Submit(func() {
+			defer job.Step(ctx)
+			releases := m.artistReleases(a)
+			// serialize database updates
+			mu.Lock()
+			defer mu.Unlock()
+			if syncErr != nil {
+				return
 			}
-		} else {
-			r, _ := m.mbz.ArtistReleases(a.Name, a.ARID)
-			for _, v := range r {
-				releases = append(releases, doRelease(a.Name, v))
+			syncErr = m.updateReleases(releases)
+		})
+	}
+	p.Wait()
+	return syncErr
+}
+
+// artistReleases obtains all releases for the artist from MusicBrainz.
+func (m *Music) artistReleases(a Artist) []Release {
+	var releases []Release
+	log.Printf("releases for %s\n", a.Name)
+	if a.Name == VariousArtists {
+		// various artists has many thousands of releases so
+		// instead of getting all releases, search for them by
+		// name and then get releases
+		names := m.artistTrackReleases(a.Name)
+		for _, name := range names {
+			result, _ := m.mbz.SearchReleaseGroup(a.ARID, name)
+			for _, rg := range result.ReleaseGroups {
+				r, _ := m.mbz.Releases(rg.ID)
+				for _, v := range r {
+					releases = append(releases, doRelease(a.Name, v))
+				}
 			}
 		}
-		for _, r := range releases {
-			r.Name = fixName(r.Name)
-			r.SingleName = fixName(r.SingleName)
-			for i := range r.Media {
-				r.Media[i].Name = fixName(r.Media[i].Name)
-			}
+	} else {
+		r, _ := m.mbz.ArtistReleases(a.Name, a.ARID)
+		for _, v := range r {
+			releases = append(releases, doRelease(a.Name, v))
+		}
+	}
+	return releases
+}
 
-			curr, _ := m.release(r.REID)
-			if curr == nil {
-				err := m.createRelease(&r)
+func (m *Music) updateReleases(releases []Release) error {
+	for _, r := range releases {
+		r.Name = fixName(r.Name)
+		r.SingleName = fixName(r.SingleName)
+		for i := range r.Media {
+			r.Media[i].Name = fixName(r.Media[i].Name)
+		}
+
+		curr, _ := m.release(r.REID)
+		if curr == nil {
+			err := m.createRelease(&r)
+			if err != nil {
+				log.Println(err)
+				return err
+			}
+			for _, d := range r.Media {
+				err := m.createMedia(&d)
 				if err != nil {
 					log.Println(err)
 					return err
 				}
-				for _, d := range r.Media {
-					err := m.createMedia(&d)
-					if err != nil {
-						log.Println(err)
-						return err
-					}
-				}
-			} else {
-				if curr.Artist != r.Artist {
-					log.Printf("release artist conflict '%s' vs. '%s'\n", curr.Artist, r.Artist)
-				}
-				err := m.replaceRelease(curr, &r)
+			}
+		} else {
+			if curr.Artist != r.Artist {
+				log.Printf("release artist conflict '%s' vs. '%s'\n", curr.Artist, r.Artist)
+			}
+			err := m.replaceRelease(curr, &r)
+			if err != nil {
+				log.Println(err)
+				return err
+			}
+			// update any assigned tracks
+			tracks := m.ReleaseTracks(r)
+			for _, t := range tracks {
+				m.assignTrackRelease(&t, &r)
+			}
+			// delete existing release and (re)add new
+			m.deleteReleaseMedia(r.REID)
+			for _, d := range r.Media {
+				err := m.createMedia(&d)
 				if err != nil {
 					log.Println(err)
 					return err
 				}
-				// update any assigned tracks
-				tracks := m.ReleaseTracks(r)
-				for _, t := range tracks {
-					m.assignTrackRelease(&t, &r)
-				}
-				// delete existing release and (re)add new
-				m.deleteReleaseMedia(r.REID)
-				for _, d := range r.Media {
-					err := m.createMedia(&d)
-					if err != nil {
-						log.Println(err)
-						return err
-					}
-				}
 			}
 		}
 	}
@@ -410,23 +537,43 @@ func fixName(name string) string {
 // David Bowie:
 //   ★ (Blackstar)
 //   Blackstar
-func (m *Music) assignTrackReleases() (bool, error) {
-	modified := false
+// Tracks in pinned folders are always assigned to the pinned release. When
+// fingerprinting is enabled, ambiguous releases are matched using the
+// AcoustID recordings of all the tracks in the folder.
+func (m *Music) assignTrackReleases(ctx context.Context) (bool, error) {
+	modified, err := m.applyPins()
+	if err != nil {
+		return modified, err
+	}
+	pinned := m.pinnedPaths()
 	notfound := make(map[string]bool)
 	artChecked := make(map[string]bool)
 	cache := make(map[string]*Release)
+	fingerprint := m.config.Music.Fingerprint && len(m.buckets) > 0
 
 	tracks := m.tracksWithoutAssignedRelease()
 
 	for _, t := range tracks {
+		if pinned[t.folder()] {
+			continue
+		}
 		cacheKey := t.releaseKey()
+		if fingerprint {
+			// folders with the same names can have different releases
+			cacheKey = t.folder() + "/" + cacheKey
+		}
 		if _, ok := notfound[cacheKey]; ok {
 			continue
 		}
 
 		r, ok := cache[cacheKey]
 		if !ok {
-			r = m.findTrackRelease(&t)
+			if fingerprint && m.ambiguousTrackRelease(&t) {
+				r = m.findTrackReleaseFingerprint(ctx, &t)
+			}
+			if r == nil {
+				r = m.findTrackRelease(&t)
+			}
 			if r != nil {
 				cache[cacheKey] = r
 			}
@@ -569,8 +716,13 @@ func (m *Music) fixTrackReleases() (bool, error) {
 	var fixTracks []map[string]interface{}
 	//tracks := m.tracksWithoutReleases()
 	tracks := m.tracksWithoutAssignedRelease()
+	pinned := m.pinnedPaths()
 
 	for _, t := range tracks {
+		if pinned[t.folder()] {
+			// pinned releases are assigned as is
+			continue
+		}
 		artist := m.Artist(t.Artist)
 		if artist == nil {
 			log.Printf("artist not found: %s\n", t.Artist)
@@ -697,73 +849,99 @@ func (m *Music) fixTrackReleaseTitlesFor(artists []Artist) error {
 }
 
 // Sync popular tracks for each artist from Last.fm.
-func (m *Music) syncPopular() error {
-	return m.syncPopularFor(m.Artists())
+func (m *Music) syncPopular(ctx context.Context) error {
+	return m.syncPopularFor(ctx, m.Artists())
 }
 
-func (m *Music) syncPopularFor(artists []Artist) error {
+func (m *Music) syncPopularFor(ctx context.Context, artists []Artist) error {
+	var mu sync.Mutex
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
-		log.Printf("popular for %s\n", a.Name)
-		tracks := m.lastfm.ArtistTopTracks(a.ARID)
-		if len(tracks) == 0 {
-			continue
+		if ctx.Err() != nil {
+			break
 		}
-		// remove what we have now
-		m.deletePopularFor(a.Name)
-		for _, t := range tracks {
-			// TODO how to check for specific error?
-			// - UNIQUE constraint failed
-			p := Popular{
-				Artist: a.Name,
-				Title:  t.Track,
-				Rank:   t.Rank,
+		a := a
+		p.Submit(func() {
+			defer job.Step(ctx)
+			log.Printf("popular for %s\n", a.Name)
+			tracks := m.lastfm.ArtistTopTracks(a.ARID)
+			if len(tracks) == 0 {
+				return
 			}
-			m.createPopular(&p)
-		}
+			mu.Lock()
+			defer mu.Unlock()
+			// remove what we have now
+			m.deletePopularFor(a.Name)
+			for _, t := range tracks {
+				// TODO how to check for specific error?
+				// - UNIQUE constraint failed
+				p := Popular{
+					Artist: a.Name,
+					Title:  t.Track,
+					Rank:   t.Rank,
+				}
+				m.createPopular(&p)
+			}
+		})
 	}
+	p.Wait()
 	return nil
 }
 
 // Sync similar artists for each artist from Last.fm.
-func (m *Music) syncSimilar() error {
-	return m.syncSimilarFor(m.Artists())
+func (m *Music) syncSimilar(ctx context.Context) error {
+	return m.syncSimilarFor(ctx, m.Artists())
 }
 
-func (m *Music) syncSimilarFor(artists []Artist) error {
+func (m *Music) syncSimilarFor(ctx context.Context, artists []Artist) error {
+	var mu sync.Mutex
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
-		log.Printf("similar for %s\n", a.Name)
-		rank := m.lastfm.SimilarArtists(a.ARID)
-		if len(rank) == 0 {
-			continue
-		}
-		// remove what we have now
-		m.deleteSimilarFor(a.Name)
-
-		mbids := make([]string, 0, len(rank))
-		for k := range rank {
-			mbids = append(mbids, k)
+		if ctx.Err() != nil {
+			break
 		}
+		a := a
+		p.Submit(func() {
+			defer job.Step(ctx)
+			log.Printf("similar for %s\n", a.Name)
+			rank := m.lastfm.SimilarArtists(a.ARID)
+			if len(rank) == 0 {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			// remove what we have now
+			m.deleteSimilarFor(a.Name)
+
+			mbids := make([]string, 0, len(rank))
+			for k := range rank {
+				mbids = append(mbids, k)
+			}
 
-		list := m.artistsByMBID(mbids)
-		sort.Slice(list, func(i, j int) bool {
-			return rank[list[i].ARID] > rank[list[j].ARID]
-		})
-
-		var similar []Similar
-		for index, v := range list {
-			similar = append(similar, Similar{
-				Artist: a.Name,
-				ARID:   v.ARID,
-				Rank:   index,
+			list := m.artistsByMBID(mbids)
+			sort.Slice(list, func(i, j int) bool {
+				return rank[list[i].ARID] > rank[list[j].ARID]
 			})
-		}
 
-		for _, s := range similar {
-			// TODO how to check for specific error?
-			// - UNIQUE constraint failed
-			m.createSimilar(&s)
-		}
+			var similar []Similar
+			for index, v := range list {
+				similar = append(similar, Similar{
+					Artist: a.Name,
+					ARID:   v.ARID,
+					Rank:   index,
+				})
+			}
+
+			for _, s := range similar {
+				// TODO how to check for specific error?
+				// - UNIQUE constraint failed
+				m.createSimilar(&s)
+			}
+		})
 	}
+	p.Wait()
 	return nil
 }
 
@@ -772,43 +950,56 @@ func (m *Music) syncMissingArtwork() error {
 }
 
 // Sync artwork from Fanart
-func (m *Music) syncArtwork() error {
-	return m.syncArtworkFor(m.Artists())
+func (m *Music) syncArtwork(ctx context.Context) error {
+	return m.syncArtworkFor(ctx, m.Artists())
 }
 
-func (m *Music) syncArtworkFor(artists []Artist) error {
+func (m *Music) syncArtworkFor(ctx context.Context, artists []Artist) error {
+	var mu sync.Mutex
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
-		log.Printf("artwork for %s\n", a.Name)
-		artwork := m.fanart.ArtistArt(a.ARID)
-		if artwork == nil {
-			continue
+		if ctx.Err() != nil {
+			break
 		}
-		source := "fanart"
-		for _, art := range artwork.ArtistBackgrounds {
-			bg := ArtistBackground{
-				Artist: a.Name,
-				URL:    art.URL,
-				Source: source,
-				Rank:   str.Atoi(art.Likes),
+		a := a
+		p.Submit(func() {
+			defer job.Step(ctx)
+			log.Printf("artwork for %s\n", a.Name)
+			artwork := m.fanart.ArtistArt(a.ARID)
+			if artwork == nil {
+				return
 			}
-			m.createArtistBackground(&bg)
-		}
-		for _, art := range artwork.ArtistThumbs {
-			img := ArtistImage{
-				Artist: a.Name,
-				URL:    art.URL,
-				Source: source,
-				Rank:   str.Atoi(art.Likes),
+			mu.Lock()
+			defer mu.Unlock()
+			source := "fanart"
+			for _, art := range artwork.ArtistBackgrounds {
+				bg := ArtistBackground{
+					Artist: a.Name,
+					URL:    art.URL,
+					Source: source,
+					Rank:   str.Atoi(art.Likes),
+				}
+				m.createArtistBackground(&bg)
 			}
-			m.createArtistImage(&img)
-		}
+			for _, art := range artwork.ArtistThumbs {
+				img := ArtistImage{
+					Artist: a.Name,
+					URL:    art.URL,
+					Source: source,
+					Rank:   str.Atoi(art.Likes),
+				}
+				m.createArtistImage(&img)
+			}
+		})
 	}
+	p.Wait()
 	return nil
 }
 
-func (m *Music) resolve() error {
+func (m *Music) resolve(ctx context.Context) error {
 	// try to resolve any missing artists
-	err := m.syncArtists()
+	err := m.syncArtists(ctx)
 	if err != nil {
 		return err
 	}
@@ -818,7 +1009,7 @@ func (m *Music) resolve() error {
 		return err
 	}
 	// try to assign any unassigned releases
-	_, err = m.assignTrackReleases()
+	_, err = m.assignTrackReleases(ctx)
 	if err != nil {
 		return err
 	}
@@ -830,13 +1021,18 @@ func (m *Music) resolve() error {
 // Get the artist names from tracks and try to find the correct artist
 // from MusicBrainz. This doesn't always work since there can be
 // multiple artists with the same name. Last.fm is used to help.
-func (m *Music) syncArtists() error {
+func (m *Music) syncArtists(ctx context.Context) error {
 	artists := m.trackArtistNames()
+	job.AddTotal(ctx, len(artists))
 	for _, name := range artists {
+		if ctx.Err() != nil {
+			break
+		}
 		_, err := m.syncArtist(name)
 		if err != nil {
 			return err
 		}
+		job.Step(ctx)
 	}
 	return nil
 }
@@ -881,6 +1077,10 @@ func (m *Music) syncArtist(name string) (*Artist, error) {
 	artist.EndDate = date.ParseDate(detail.LifeSpan.End)
 	artist.Genre = detail.PrimaryGenre()
 	m.updateArtist(artist)
+	err = m.replaceArtistRelations(artist.ARID, artistRelations(detail))
+	if err != nil {
+		log.Printf("%s\n", err)
+	}
 	return artist, nil
 }
 
@@ -950,7 +1150,34 @@ func (m *Music) releaseIndex(release Release) (search.IndexMap, error) {
 		}
 	}
 
-	indices, err := m.creditsIndex(reid)
+	indices, credits, err := m.creditsIndex(reid)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indices {
+		credits = append(credits, index.Credits...)
+	}
+	err = m.replaceCredits(reid, credits)
+	if err != nil {
+		return nil, err
+	}
+	composerArtist := len(indices) > 0 && m.config.Music.ComposerArtist &&
+		m.classicalRelease(indices[0].Fields)
+	var artistCredits []ArtistCredit
+	var works []Work
+	for i, index := range indices {
+		if composerArtist {
+			// composer is the primary artist for classical releases
+			indices[i] = withComposerArtist(index)
+		}
+		artistCredits = append(artistCredits, indices[i].ArtistCredits...)
+		works = append(works, index.Works...)
+	}
+	err = m.replaceArtistCredits(reid, artistCredits)
+	if err != nil {
+		return nil, err
+	}
+	err = m.replaceWorks(reid, works)
 	if err != nil {
 		return nil, err
 	}
@@ -969,6 +1196,9 @@ func (m *Music) releaseIndex(release Release) (search.IndexMap, error) {
 				if index.RID != "" {
 					m.updateTrackRID(t, index.RID)
 				}
+				if index.Length > 0 && t.Duration != index.Length {
+					m.updateTrackDuration(t, index.Length)
+				}
 				if index.Artist != "" {
 					m.assignTrackArtist(t, index.Artist)
 				}
@@ -1024,6 +1254,27 @@ func (m *Music) releaseIndex(release Release) (search.IndexMap, error) {
 		}
 	}
 
+	// add unsynced lyrics text
+	for k, fields := range newIndex {
+		l, err := m.trackLyrics(trackBase(k))
+		if err == nil && l.Text != "" {
+			fields[FieldLyrics] = l.Unsynced()
+		}
+	}
+
+	// add audio analysis
+	for _, t := range tracks {
+		fields, ok := newIndex[t.Key]
+		if !ok {
+			continue
+		}
+		a, err := m.trackAnalysis(t.ETag)
+		if err != nil {
+			continue
+		}
+		addAnalysisFields(fields, a)
+	}
+
 	return newIndex, nil
 }
 
@@ -1042,14 +1293,23 @@ func (m *Music) artistIndex(a *Artist) ([]search.IndexMap, error) {
 	return indices, nil
 }
 
-func (m *Music) syncIndexFor(artists []Artist) error {
+func (m *Music) syncIndexFor(ctx context.Context, artists []Artist) error {
 	s, err := m.newSearch()
 	if err != nil {
 		return err
 	}
 	defer s.Close()
 
+	suggest, err := m.newSuggest()
+	if err != nil {
+		return err
+	}
+	defer suggest.Close()
+
 	for _, a := range artists {
+		if ctx.Err() != nil {
+			break
+		}
 		log.Printf("index for %s\n", a.Name)
 		index, err := m.artistIndex(&a)
 		if err != nil {
@@ -1058,13 +1318,160 @@ func (m *Music) syncIndexFor(artists []Artist) error {
 		for _, idx := range index {
 			s.Index(idx)
 		}
+		// replace all the artist suggestions to remove releases and
+		// tracks no longer associated with the artist
+		err = suggest.ReplaceGroup(artistGroup(a), m.artistSuggestions(a))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindexReleases updates the search index for just the releases.
+func (m *Music) reindexReleases(reids []string) error {
+	if len(reids) == 0 {
+		return nil
+	}
+	s, err := m.newSearch()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, reid := range reids {
+		r, err := m.release(reid)
+		if err != nil {
+			return err
+		}
+		index, err := m.releaseIndex(*r)
+		if err != nil {
+			return err
+		}
+		s.Index(index)
 	}
 	return nil
 }
 
-func (m *Music) syncIndex() error {
+func (m *Music) syncIndex(ctx context.Context) error {
+	return m.indexAll(ctx, false)
+}
+
+// indexAll indexes all artists, starting over with an empty search index
+// when reset or when the index is stale.
+func (m *Music) indexAll(ctx context.Context, reset bool) error {
+	// track ids change with a full sync so start with new suggestions
+	suggest, err := m.newSuggest()
+	if err != nil {
+		return err
+	}
+	err = suggest.Reset("music_suggest")
+	suggest.Close()
+	if err != nil {
+		return err
+	}
+
+	s, err := m.newSearch()
+	if err != nil {
+		return err
+	}
+	if reset || s.Stale() {
+		// start over with the current mapping
+		err = s.Reset("music")
+	}
+	s.Close()
+	if err != nil {
+		return err
+	}
+
 	artists := m.Artists()
-	return m.syncIndexFor(artists)
+	err = m.syncIndexFor(ctx, artists)
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	s, err = m.newSearch()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Indexed()
+}
+
+// indexStale is true when the search index needs to be rebuilt.
+func (m *Music) indexStale() bool {
+	s, err := m.newSearch()
+	if err != nil {
+		return false
+	}
+	defer s.Close()
+	return s.Stale()
+}
+
+func artistGroup(a Artist) string {
+	return strconv.Itoa(int(a.ID))
+}
+
+// artistSuggestions has the names of the artist and the artist's releases
+// and tracks, grouped by artist.
+func (m *Music) artistSuggestions(a Artist) []search.Suggestion {
+	group := artistGroup(a)
+	list := []search.Suggestion{{
+		Type:  SuggestArtist,
+		ID:    strconv.Itoa(int(a.ID)),
+		Name:  a.Name,
+		Group: group,
+	}}
+	for _, r := range m.ArtistReleases(&a) {
+		list = append(list, search.Suggestion{
+			Type:  SuggestRelease,
+			ID:    strconv.Itoa(int(r.ID)),
+			Name:  r.Name,
+			Group: group,
+		})
+	}
+	for _, t := range m.ArtistTracks(a) {
+		list = append(list, search.Suggestion{
+			Type:  SuggestTrack,
+			ID:    strconv.Itoa(int(t.ID)),
+			Name:  t.Title,
+			Group: group,
+		})
+	}
+	return list
+}
+
+// Track durations are obtained from MusicBrainz recordings during indexing.
+// Probe the audio headers in the bucket for any tracks still without a
+// duration. Use nil artists for all tracks.
+func (m *Music) syncDurations(ctx context.Context, artists []Artist) error {
+	if len(m.buckets) == 0 {
+		return nil
+	}
+	tracks := m.tracksWithoutDuration(artists)
+	var mu sync.Mutex
+	p := m.syncPool()
+	job.AddTotal(ctx, len(tracks))
+	for _, t := range tracks {
+		if ctx.Err() != nil {
+			break
+		}
+		t := t
+		p.Submit(func() {
+			defer job.Step(ctx)
+			d, err := audio.Duration(m.bucketReader(&t), t.Size)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("duration %s: %s\n", t.Key, err)
+				// don't try again unless the track changes
+				m.updateTrackDurationETag(t)
+				return
+			}
+			m.updateTrackDuration(t, int(d.Milliseconds()))
+		})
+	}
+	p.Wait()
+	return nil
 }
 
 func doArtist(artist *musicbrainz.Artist) (a *Artist, tags []ArtistTag) {
@@ -1142,42 +1549,72 @@ func doRelease(artist string, r musicbrainz.Release) Release {
 	}
 }
 
-func (m *Music) SyncCovers(cfg config.ClientConfig) error {
-	return m.syncCoversFor(cfg, m.Artists())
+func (m *Music) SyncCovers(ctx context.Context, cfg config.ClientConfig) error {
+	return m.syncCoversFor(ctx, cfg, m.Artists())
 }
 
-func (m *Music) syncCoversFor(cfg config.ClientConfig, artists []Artist) error {
+func (m *Music) syncCoversFor(ctx context.Context, cfg config.ClientConfig, artists []Artist) error {
 	client := client.NewClient(&cfg)
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
+		if ctx.Err() != nil {
+			break
+		}
 		releases := m.ArtistReleases(&a)
 		for _, r := range releases {
 			img := CoverArtArchiveImage(r)
 			if img != "" {
-				log.Printf("sync %s/%s %s\n", a.Name, r.Name, img)
-				client.Get(img)
+				name := a.Name + "/" + r.Name
+				p.Submit(func() {
+					log.Printf("sync %s %s\n", name, img)
+					client.Get(img)
+				})
 			}
 		}
+		job.Step(ctx)
 	}
-	return nil
+	p.Wait()
+	return ctx.Err()
 }
 
-func (m *Music) SyncFanArt(cfg config.ClientConfig) error {
-	return m.syncFanArtFor(cfg, m.Artists())
+func (m *Music) SyncFanArt(ctx context.Context, cfg config.ClientConfig) error {
+	return m.syncFanArtFor(ctx, cfg, m.Artists())
 }
 
-func (m *Music) syncFanArtFor(cfg config.ClientConfig, artists []Artist) error {
+func (m *Music) syncFanArtFor(ctx context.Context, cfg config.ClientConfig, artists []Artist) error {
 	client := client.NewClient(&cfg)
+	p := m.syncPool()
+	job.AddTotal(ctx, len(artists))
 	for _, a := range artists {
+		if ctx.Err() != nil {
+			break
+		}
+		name := a.Name
 		thumbs := m.artistImages(&a)
 		for _, img := range thumbs {
-			log.Printf("sync %s thumb %s\n", a.Name, img)
-			client.Get(img)
+			img := img
+			p.Submit(func() {
+				log.Printf("sync %s thumb %s\n", name, img)
+				client.Get(img)
+			})
 		}
 		bgs := m.artistBackgrounds(&a)
 		for _, img := range bgs {
-			log.Printf("sync %s bg %s\n", a.Name, img)
-			client.Get(img)
+			img := img
+			p.Submit(func() {
+				log.Printf("sync %s bg %s\n", name, img)
+				client.Get(img)
+			})
 		}
+		job.Step(ctx)
 	}
-	return nil
+	p.Wait()
+	return ctx.Err()
+}
+
+// syncPool creates a worker pool used to sync metadata concurrently. Host
+// rate limits are handled by the client.
+func (m *Music) syncPool() *pool.Pool {
+	return pool.NewPool(m.config.Music.SyncWorkers)
 }
@@ -0,0 +1,234 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+const (
+	ReasonNoArtist  = "no artist found"
+	ReasonNoRelease = "no release with the same track/disc count"
+	ReasonAmbiguous = "ambiguous disambiguation"
+	ReasonNoName    = "no release with the same name"
+	ReasonPending   = "release found, waiting for sync"
+
+	unmatchedCandidates = 10
+)
+
+// UnmatchedFolder is a bucket folder with tracks that aren't assigned to a
+// release, along with the fields parsed from the first track, the reason
+// matching failed and ranked candidate releases.
+type UnmatchedFolder struct {
+	Path       string
+	Artist     string
+	Release    string
+	TrackCount int
+	DiscCount  int
+	Reason     string
+	Tracks     []Track
+	Candidates []Release
+}
+
+// UnmatchedFolders groups unmatched tracks by bucket folder.
+func (m *Music) UnmatchedFolders() []UnmatchedFolder {
+	var paths []string
+	folders := make(map[string][]Track)
+	for _, t := range m.tracksWithoutAssignedRelease() {
+		path := t.folder()
+		if _, ok := folders[path]; !ok {
+			paths = append(paths, path)
+		}
+		folders[path] = append(folders[path], t)
+	}
+	sort.Strings(paths)
+
+	var result []UnmatchedFolder
+	for _, path := range paths {
+		result = append(result, m.unmatchedFolder(path, folders[path]))
+	}
+	return result
+}
+
+// UnmatchedFolder returns the unmatched tracks in a single bucket folder.
+func (m *Music) UnmatchedFolder(path string) (*UnmatchedFolder, error) {
+	path = strings.Trim(path, "/")
+	var tracks []Track
+	for _, t := range m.folderTracks(path) {
+		if t.REID == "" || t.RGID == "" {
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+	f := m.unmatchedFolder(path, tracks)
+	return &f, nil
+}
+
+// unmatchedFolder uses the first track for the folder fields and reason.
+func (m *Music) unmatchedFolder(path string, tracks []Track) UnmatchedFolder {
+	t := tracks[0]
+	f := UnmatchedFolder{
+		Path:       path,
+		Artist:     t.Artist,
+		Release:    t.Release,
+		TrackCount: t.TrackCount,
+		DiscCount:  t.DiscCount,
+		Tracks:     tracks,
+	}
+	f.Reason, f.Candidates = m.unmatchedReason(t)
+	return f
+}
+
+// MatchFolder assigns the tracks in the bucket folder to the release and
+// resyncs just that folder. The choice is saved as a release pin so it's
+// kept after a full sync.
+func (m *Music) MatchFolder(ctx context.Context, path, reid string) (*Release, error) {
+	pin, err := m.PinFolder(path, reid, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.SyncPin(ctx, *pin)
+}
+
+// SyncPin resyncs just the pinned bucket folder and assigns the tracks to
+// the pinned release.
+func (m *Music) SyncPin(ctx context.Context, pin Pin) (*Release, error) {
+	tracks := m.folderTracks(pin.Path)
+	if len(tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+	artists, err := m.syncFolderReleases(ctx, tracks[0])
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.applyPin(pin)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.pinnedRelease(pin, tracks[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(artists) == 0 {
+		// artist not found so only the release can be reindexed
+		return r, m.reindexReleases([]string{r.REID})
+	}
+	err = m.fixTrackReleaseTitlesFor(artists)
+	if err != nil {
+		return r, err
+	}
+	return r, m.syncIndexFor(ctx, artists)
+}
+
+// syncFolderReleases follows the same steps as Sync to obtain the artist and
+// releases for a folder track.
+func (m *Music) syncFolderReleases(ctx context.Context, t Track) ([]Artist, error) {
+	a := m.Artist(t.Artist)
+	if a == nil {
+		var err error
+		a, err = m.syncArtist(t.Artist)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			return nil, nil
+		}
+	}
+	artists := []Artist{*a}
+	return artists, m.syncReleasesFor(ctx, artists)
+}
+
+// unmatchedReason follows the same steps as assignTrackReleases to explain
+// why the track wasn't matched to a release.
+func (m *Music) unmatchedReason(t Track) (string, []Release) {
+	artist := m.Artist(t.Artist)
+	if artist == nil {
+		return ReasonNoArtist, nil
+	}
+	releases := m.releases(artist)
+	candidates := m.rankReleases(t, releases)
+	if len(m.trackReleases(&t)) > 0 {
+		return ReasonPending, candidates
+	}
+	counted := false
+	for _, r := range releases {
+		if r.TrackCount == t.TrackCount && r.DiscCount == t.DiscCount {
+			counted = true
+			break
+		}
+	}
+	if !counted {
+		return ReasonNoRelease, candidates
+	}
+	if len(m.disambiguate(t.Artist, t.TrackCount, t.DiscCount)) > 0 {
+		return ReasonAmbiguous, candidates
+	}
+	return ReasonNoName, candidates
+}
+
+// rankReleases orders releases by how well they match the track, preferring
+// similar names, the same track and disc counts, and then the same things as
+// pickRelease.
+func (m *Music) rankReleases(t Track, releases []Release) []Release {
+	countryMap := m.countryMap()
+	name := strings.ToLower(FuzzyName(t.Release))
+	scores := make(map[string]int)
+	var ranked []Release
+	for _, r := range releases {
+		score := 0
+		other := strings.ToLower(FuzzyName(r.Name))
+		if name == other {
+			score += 8
+		} else if name != "" && other != "" &&
+			(strings.Contains(name, other) || strings.Contains(other, name)) {
+			score += 4
+		}
+		if r.TrackCount == t.TrackCount {
+			score += 4
+		}
+		if r.DiscCount == t.DiscCount {
+			score += 2
+		}
+		if score < 4 {
+			// neither the name nor track count are close
+			continue
+		}
+		if r.FrontArtwork {
+			score++
+		}
+		if r.official() {
+			score++
+		}
+		if _, ok := countryMap[r.Country]; ok {
+			score++
+		}
+		scores[r.REID] = score
+		ranked = append(ranked, r)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].REID] > scores[ranked[j].REID]
+	})
+	if len(ranked) > unmatchedCandidates {
+		ranked = ranked[:unmatchedCandidates]
+	}
+	return ranked
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"testing"
+
+	"github.com/defsub/takeout/config"
+)
+
+func TestRankReleases(t *testing.T) {
+	m := &Music{config: &config.Config{}}
+	track := Track{Release: "Pinkerton", TrackCount: 10, DiscCount: 1}
+	releases := []Release{
+		{REID: "1", Name: "Maladroit", TrackCount: 13, DiscCount: 1},
+		{REID: "2", Name: "Pinkerton (Deluxe Edition)", TrackCount: 35, DiscCount: 2},
+		{REID: "3", Name: "Weezer", TrackCount: 10, DiscCount: 1},
+		{REID: "4", Name: "Pinkerton", TrackCount: 10, DiscCount: 1},
+	}
+	ranked := m.rankReleases(track, releases)
+	if len(ranked) != 3 {
+		t.Fatalf("expected 3 candidates got %d", len(ranked))
+	}
+	for i, reid := range []string{"4", "3", "2"} {
+		if ranked[i].REID != reid {
+			t.Errorf("expected %s at %d got %s", reid, i, ranked[i].REID)
+		}
+	}
+}
@@ -17,31 +17,235 @@
 
 package music
 
-func (m *Music) WantArtistReleases(a Artist) []Release {
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/musicbrainz"
+	"gorm.io/gorm"
+)
+
+const (
+	WantAlbum  = "album"
+	WantEP     = "ep"
+	WantSingle = "single"
+	WantLive   = "live"
+)
+
+var (
+	ErrInvalidWantType = errors.New("invalid wantlist type")
+)
+
+// WantFilter selects releases for the wantlist. Empty fields match
+// everything except Types, which defaults to albums. Releases are always
+// limited to the configured release countries.
+type WantFilter struct {
+	Artists  []string  // artist names
+	Types    []string  // album, ep, single, live
+	After    time.Time // first released on or after
+	Before   time.Time // first released before
+	Official bool      // only official releases
+	Asin     bool      // only releases with an ASIN
+	// Release group plays used to only include artists that were played,
+	// nil to include all artists.
+	Played map[string]int
+	Offset int
+	Limit  int // zero for no limit
+}
+
+// NewWantFilter has the defaults used by the wantlist, official albums with
+// an ASIN from all artists.
+func NewWantFilter() WantFilter {
+	return WantFilter{
+		Types:    []string{WantAlbum},
+		Official: true,
+		Asin:     true,
+	}
+}
+
+// ParseWantTypes splits a comma separated list of wantlist types.
+func ParseWantTypes(s string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch t {
+		case "":
+			continue
+		case WantAlbum, WantEP, WantSingle, WantLive:
+			types = append(types, t)
+		default:
+			return nil, ErrInvalidWantType
+		}
+	}
+	return types, nil
+}
+
+// WantReleases returns releases by library artists that aren't in the
+// library, ordered by artist and date, along with the total number of
+// releases before applying the offset and limit. One release is included
+// for each release group.
+func (m *Music) WantReleases(f WantFilter) ([]Release, int64) {
 	var releases []Release
-	m.db.Where("type = 'Album' and secondary_type = '' and status = 'Official' and asin <> ''"+
-		" and country in ? and artist = ?"+
-		" and lower(name) not in"+
-		" (select distinct lower(release) from tracks where artist = ?)"+
-		" and lower(name || ' (' || disambiguation || ')') not in"+
-		" (select distinct lower(release) from tracks where artist = ?)",
-		m.config.Music.ReleaseCountries, a.Name, a.Name, a.Name).
-		Group("rg_id").
-		Order("date").
-		Find(&releases)
+	var total int64
+
+	if f.Played != nil {
+		var rgids []string
+		for rgid := range f.Played {
+			rgids = append(rgids, rgid)
+		}
+		var played []string
+		seen := make(map[string]bool)
+		for _, artist := range m.releaseGroupArtists(rgids) {
+			if !seen[artist] {
+				seen[artist] = true
+				played = append(played, artist)
+			}
+		}
+		if len(played) == 0 {
+			return releases, 0
+		}
+		if len(f.Artists) > 0 {
+			played = intersect(f.Artists, played)
+		}
+		f.Artists = played
+		if len(f.Artists) == 0 {
+			return releases, 0
+		}
+	}
+
+	query := func() *gorm.DB {
+		tx := m.db.Model(&Release{}).
+			Joins("inner join artists on artists.name = releases.artist").
+			Where("lower(releases.name) not in"+
+				" (select distinct lower(release) from tracks where tracks.artist = releases.artist)"+
+				" and lower(releases.name || ' (' || releases.disambiguation || ')') not in"+
+				" (select distinct lower(release) from tracks where tracks.artist = releases.artist)"+
+				" and releases.rg_id not in (select distinct rg_id from tracks where rg_id <> '')").
+			Where("releases.country in ?", m.config.Music.ReleaseCountries)
+		if len(f.Artists) > 0 {
+			tx = tx.Where("releases.artist in ?", f.Artists)
+		}
+		if f.Official {
+			tx = tx.Where("releases.status = 'Official'")
+		}
+		if f.Asin {
+			tx = tx.Where("releases.asin <> ''")
+		}
+		if !f.After.IsZero() {
+			tx = tx.Where("releases.date >= ?", f.After)
+		}
+		if !f.Before.IsZero() {
+			tx = tx.Where("releases.date < ?", f.Before)
+		}
+		types := f.Types
+		if len(types) == 0 {
+			types = []string{WantAlbum}
+		}
+		var conds []string
+		var args []interface{}
+		for _, t := range types {
+			switch t {
+			case WantAlbum:
+				conds = append(conds, "(releases.type = ? and releases.secondary_type = '')")
+				args = append(args, musicbrainz.PrimaryTypeAlbum)
+			case WantEP:
+				conds = append(conds, "(releases.type = ? and releases.secondary_type = '')")
+				args = append(args, musicbrainz.PrimaryTypeEP)
+			case WantSingle:
+				conds = append(conds, "(releases.type = ? and releases.secondary_type = '')")
+				args = append(args, musicbrainz.PrimaryTypeSingle)
+			case WantLive:
+				conds = append(conds, "releases.secondary_type = ?")
+				args = append(args, musicbrainz.TypeLive)
+			}
+		}
+		if len(conds) > 0 {
+			tx = tx.Where(strings.Join(conds, " or "), args...)
+		}
+		return tx
+	}
+
+	query().Distinct("releases.rg_id").Count(&total)
+
+	tx := query().Select("releases.*").
+		Group("releases.rg_id").
+		Order("artists.sort_name, releases.date")
+	if f.Offset > 0 {
+		tx = tx.Offset(f.Offset)
+	}
+	if f.Limit > 0 {
+		tx = tx.Limit(f.Limit)
+	}
+	tx.Find(&releases)
+	return releases, total
+}
+
+// WantArtistReleases returns wantlist releases by the artist using the
+// wantlist defaults.
+func (m *Music) WantArtistReleases(a Artist) []Release {
+	f := NewWantFilter()
+	f.Artists = []string{a.Name}
+	releases, _ := m.WantReleases(f)
 	return releases
 }
 
-func (m *Music) WantList() []Release {
-	var list []Release
+func intersect(a, b []string) []string {
+	set := make(map[string]bool)
+	for _, v := range b {
+		set[v] = true
+	}
+	var result []string
+	for _, v := range a {
+		if set[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func releaseGroupURL(r Release) string {
+	return fmt.Sprintf("https://musicbrainz.org/release-group/%s", r.RGID)
+}
 
-	artists := m.Artists()
-	for _, a := range artists {
-		releases := m.WantArtistReleases(a)
-		if len(releases) > 0 {
-			list = append(list, releases...)
+// WriteWantMarkdown writes the releases as a Markdown list grouped by artist.
+func WriteWantMarkdown(w io.Writer, releases []Release) error {
+	_, err := fmt.Fprintln(w, "# Takeout: Wantlist")
+	if err != nil {
+		return err
+	}
+	var prevArtist string
+	for _, r := range releases {
+		var disamb = ""
+		if r.Disambiguation != "" {
+			disamb = fmt.Sprintf(" (%s)", r.Disambiguation)
+		}
+		if r.Artist != prevArtist {
+			fmt.Fprintf(w, "## %s\n", r.Artist)
 		}
+		_, err = fmt.Fprintf(w, "- %04d [%s%s](%s)\n", r.Date.Year(), r.Name, disamb, releaseGroupURL(r))
+		if err != nil {
+			return err
+		}
+		prevArtist = r.Artist
 	}
+	return nil
+}
 
-	return list
+// WriteWantCSV writes the releases as CSV with a header row.
+func WriteWantCSV(w io.Writer, releases []Release) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"artist", "release", "disambiguation", "type",
+		"secondary_type", "date", "status", "country", "rgid", "reid", "url"})
+	for _, r := range releases {
+		cw.Write([]string{r.Artist, r.Name, r.Disambiguation, r.Type,
+			r.SecondaryType, date.YMD(r.Date), r.Status, r.Country,
+			r.RGID, r.REID, releaseGroupURL(r)})
+	}
+	cw.Flush()
+	return cw.Error()
 }
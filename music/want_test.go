@@ -0,0 +1,187 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseWantTypes(t *testing.T) {
+	types, err := ParseWantTypes("Album, ep,,live")
+	if err != nil || len(types) != 3 ||
+		types[0] != WantAlbum || types[1] != WantEP || types[2] != WantLive {
+		t.Errorf("unexpected types %v %v", types, err)
+	}
+	_, err = ParseWantTypes("album,bootleg")
+	if err != ErrInvalidWantType {
+		t.Errorf("expected invalid type got %v", err)
+	}
+}
+
+func TestWriteWant(t *testing.T) {
+	releases := []Release{
+		{Artist: "Weezer", Name: "Weezer", Disambiguation: "Red Album", RGID: "rg1",
+			Type: "Album", Status: "Official", Date: time.Date(2008, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{Artist: "Weezer", Name: "Pacific Daydream", RGID: "rg2",
+			Type: "Album", Status: "Official", Date: time.Date(2017, 10, 27, 0, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	err := WriteWantMarkdown(&buf, releases)
+	expect := "# Takeout: Wantlist\n## Weezer\n" +
+		"- 2008 [Weezer (Red Album)](https://musicbrainz.org/release-group/rg1)\n" +
+		"- 2017 [Pacific Daydream](https://musicbrainz.org/release-group/rg2)\n"
+	if err != nil || buf.String() != expect {
+		t.Errorf("unexpected markdown %q %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	err = WriteWantCSV(&buf, releases[:1])
+	expect = "artist,release,disambiguation,type,secondary_type,date,status,country,rgid,reid,url\n" +
+		"Weezer,Weezer,Red Album,Album,,2008-06-03,Official,,rg1,,https://musicbrainz.org/release-group/rg1\n"
+	if err != nil || buf.String() != expect {
+		t.Errorf("unexpected csv %q %v", buf.String(), err)
+	}
+}
+
+func TestWantReleases(t *testing.T) {
+	m := testDB(t)
+	m.config.Music.ReleaseCountries = []string{"US", "XW"}
+	artists := []Artist{
+		{Name: "Weezer", SortName: "Weezer", ARID: "a1"},
+		{Name: "Pixies", SortName: "Pixies", ARID: "a2"},
+	}
+	for i := range artists {
+		if err := m.db.Create(&artists[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	release := func(reid, rgid, artist, name string, year int) Release {
+		return Release{REID: reid, RGID: rgid, Artist: artist, Name: name,
+			Type: "Album", Status: "Official", Country: "US", Asin: "B0" + reid,
+			Date: yearDate(year)}
+	}
+	releases := []Release{
+		release("r1", "rg1", "Weezer", "Weezer", 1994),
+		release("r2", "rg2", "Weezer", "Pinkerton", 1996),
+		release("r3", "rg2", "Weezer", "Pinkerton", 1996), // same group
+		release("r4", "rg3", "Weezer", "Maladroit", 2002),
+		release("r5", "rg4", "Weezer", "Make Believe", 2005),
+		release("r6", "rg5", "Weezer", "Raditude", 2009),
+		release("r7", "rg6", "Pixies", "Doolittle", 1989),
+		release("r8", "rg7", "Weezer", "Death to False Metal", 2010),
+	}
+	releases[3].Asin = ""              // no asin
+	releases[4].Country = "GB"         // other country
+	releases[5].Status = "Bootleg"     // not official
+	releases[7].SecondaryType = "Live" // not an album
+	for i := range releases {
+		if err := m.db.Create(&releases[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	track := Track{Artist: "Weezer", Release: "Weezer", Title: "Buddy Holly",
+		REID: "r1", RGID: "rg1", RID: "t1"}
+	if err := m.createTrack(&track); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(releases []Release) []string {
+		var result []string
+		for _, r := range releases {
+			result = append(result, r.Name)
+		}
+		return result
+	}
+	check := func(f WantFilter, total int64, expect ...string) {
+		t.Helper()
+		result, n := m.WantReleases(f)
+		got := names(result)
+		if n != total || len(got) != len(expect) {
+			t.Fatalf("expected %v (%d) got %v (%d)", expect, total, got, n)
+		}
+		for i := range expect {
+			if got[i] != expect[i] {
+				t.Errorf("expected %s at %d got %s", expect[i], i, got[i])
+			}
+		}
+	}
+
+	// defaults are official albums with an asin, sorted by artist and date
+	f := NewWantFilter()
+	check(f, 2, "Doolittle", "Pinkerton")
+
+	f.Artists = []string{"Weezer"}
+	check(f, 1, "Pinkerton")
+	if got := names(m.WantArtistReleases(artists[0])); len(got) != 1 || got[0] != "Pinkerton" {
+		t.Errorf("unexpected artist releases %v", got)
+	}
+
+	f = NewWantFilter()
+	f.Asin = false
+	f.Official = false
+	check(f, 4, "Doolittle", "Pinkerton", "Maladroit", "Raditude")
+
+	f.Types = []string{WantLive}
+	check(f, 1, "Death to False Metal")
+
+	f = NewWantFilter()
+	f.Asin = false
+	f.After = yearDate(1990)
+	f.Offset = 1
+	f.Limit = 1
+	check(f, 2, "Maladroit")
+
+	// release countries always apply
+	m.config.Music.ReleaseCountries = nil
+	check(NewWantFilter(), 0)
+}
+
+func TestReleaseGroupArtists(t *testing.T) {
+	m := testDB(t)
+	var rgids []string
+	for i := 0; i < 250; i++ {
+		r := Release{REID: fmt.Sprintf("r%d", i), RGID: fmt.Sprintf("rg%d", i),
+			Artist: fmt.Sprintf("artist %d", i%3), Name: fmt.Sprintf("release %d", i)}
+		if err := m.db.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+		rgids = append(rgids, r.RGID)
+	}
+	rgids = append(rgids, "missing")
+
+	result := m.releaseGroupArtists(rgids)
+	if len(result) != 250 || result["rg0"] != "artist 0" || result["rg249"] != "artist 0" {
+		t.Errorf("unexpected artists %d %v", len(result), result["rg249"])
+	}
+
+	// many played release groups filter the wantlist
+	played := make(map[string]int)
+	for _, rgid := range rgids {
+		played[rgid] = 1
+	}
+	f := NewWantFilter()
+	f.Played = played
+	m.config.Music.ReleaseCountries = []string{"US"}
+	if releases, total := m.WantReleases(f); len(releases) != 0 || total != 0 {
+		t.Errorf("unexpected releases %d", total)
+	}
+}
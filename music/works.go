@@ -0,0 +1,80 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package music
+
+import (
+	"strings"
+
+	"github.com/defsub/takeout/lib/search"
+)
+
+// WorkRelease returns the release and tracks used to play the complete
+// work. The release with the most movements is used when reid is empty.
+func (m *Music) WorkRelease(workID, reid string) (Release, []Track, error) {
+	if reid == "" {
+		releases := m.WorkReleases(workID)
+		if len(releases) == 0 {
+			return Release{}, nil, ErrReleaseNotFound
+		}
+		reid = releases[0].REID
+	}
+	release, err := m.LookupREID(reid)
+	if err != nil {
+		return Release{}, nil, err
+	}
+	return release, m.WorkTracks(workID, reid), nil
+}
+
+// classicalRelease returns true when the release genres include one of the
+// configured classical genres.
+func (m *Music) classicalRelease(fields search.FieldMap) bool {
+	var genres []string
+	switch v := fields[FieldGenre].(type) {
+	case string:
+		genres = []string{v}
+	case []string:
+		genres = v
+	}
+	for _, g := range genres {
+		for _, c := range m.config.Music.ClassicalGenres {
+			if strings.EqualFold(g, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withComposerArtist uses the composer of the first work as the track
+// artist and credits the composer on the track.
+func withComposerArtist(index trackIndex) trackIndex {
+	for _, w := range index.Works {
+		if w.ComposerID == "" {
+			continue
+		}
+		index.Artist = w.Composer
+		index.ArtistCredits = append(index.ArtistCredits, ArtistCredit{
+			REID: w.REID,
+			RID:  w.RID,
+			ARID: w.ComposerID,
+			Name: w.Composer,
+		})
+		break
+	}
+	return index
+}
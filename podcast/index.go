@@ -0,0 +1,86 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package podcast
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/search"
+)
+
+// RebuildIndex replaces the search and suggest indexes using the series and
+// episodes in the database. Feeds are not fetched.
+func (p *Podcast) RebuildIndex(ctx context.Context) error {
+	s, err := p.newSearch()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.Reset("podcast")
+	if err != nil {
+		return err
+	}
+	suggest, err := p.newSuggest()
+	if err != nil {
+		return err
+	}
+	defer suggest.Close()
+	err = suggest.Reset("podcast_suggest")
+	if err != nil {
+		return err
+	}
+
+	list := p.Series()
+	job.AddTotal(ctx, len(list))
+	for i := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		series := &list[i]
+		index := make(search.IndexMap)
+		episodes := p.Episodes(*series)
+		for j := range episodes {
+			index[episodes[j].EID] = episodeFields(series, &episodes[j])
+		}
+		s.Index(index)
+		err = suggest.Add(SuggestSeries, strconv.Itoa(int(series.ID)), series.Title)
+		if err != nil {
+			return err
+		}
+		job.Step(ctx)
+	}
+	return s.Indexed()
+}
+
+// VerifyIndex reports index documents which no longer match episodes.
+func (p *Podcast) VerifyIndex() (*search.Report, error) {
+	s, err := p.newSearch()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.Verify(func(keys []string) []string {
+		var found []string
+		for _, e := range p.episodesFor(keys) {
+			found = append(found, e.EID)
+		}
+		return found
+	})
+}
@@ -54,6 +54,33 @@ func (p *Podcast) newSearch() (*search.Search, error) {
 	return s, nil
 }
 
+const (
+	SuggestSeries = "series"
+)
+
+func (p *Podcast) newSuggest() (*search.Suggest, error) {
+	s := search.NewSuggest(p.config)
+	err := s.Open("podcast_suggest")
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Suggest series titles which match the prefix.
+func (p *Podcast) Suggest(prefix string, limit int) []search.Suggestion {
+	s, err := p.newSuggest()
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	defer s.Close()
+	list, err := s.Suggest(prefix, limit)
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	return list
+}
+
 func mergeClientConfig(cfg *config.Config) *config.ClientConfig {
 	var merged config.ClientConfig
 	merged = cfg.Client
@@ -18,12 +18,15 @@
 package podcast
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/defsub/takeout/lib/hash"
+	"github.com/defsub/takeout/lib/job"
 	"github.com/defsub/takeout/lib/rss"
 	"github.com/defsub/takeout/lib/search"
 )
@@ -36,23 +39,71 @@ const (
 	FieldTitle       = "title"
 )
 
-func (p *Podcast) Sync() error {
-	return p.SyncSince(time.Time{})
+func (p *Podcast) Sync(ctx context.Context) error {
+	return p.SyncSince(ctx, time.Time{})
 }
 
-func (p *Podcast) SyncSince(lastSync time.Time) error {
+func (p *Podcast) SyncSince(ctx context.Context, lastSync time.Time) error {
 	// TODO lastSync isn't used yet
+	stale, err := p.resetStaleIndex()
+	if err != nil {
+		return err
+	}
+	job.AddTotal(ctx, len(p.config.Podcast.Series))
 	for _, url := range p.config.Podcast.Series {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		err := p.syncPodcast(url)
 		if err != nil {
 			fmt.Printf("err %s\n", err)
 			return err
 		}
+		job.Step(ctx)
+	}
+	if stale {
+		// all episodes were indexed again
+		err = p.indexed()
+		if err != nil {
+			return err
+		}
 	}
 	// TODO cleanup old series and episodes
 	return nil
 }
 
+// resetStaleIndex starts over with empty search and suggest indexes when the
+// index mapping has changed.
+func (p *Podcast) resetStaleIndex() (bool, error) {
+	s, err := p.newSearch()
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	if !s.Stale() {
+		return false, nil
+	}
+	err = s.Reset("podcast")
+	if err != nil {
+		return true, err
+	}
+	suggest, err := p.newSuggest()
+	if err != nil {
+		return true, err
+	}
+	defer suggest.Close()
+	return true, suggest.Reset("podcast_suggest")
+}
+
+func (p *Podcast) indexed() error {
+	s, err := p.newSearch()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Indexed()
+}
+
 func (p *Podcast) syncPodcast(url string) error {
 	rss := rss.NewRSS(p.client)
 	channel, err := rss.Fetch(url)
@@ -114,6 +165,11 @@ func (p *Podcast) syncPodcast(url string) error {
 		}
 	}
 
+	err = p.suggestSeries(series)
+	if err != nil {
+		return err
+	}
+
 	index := make(search.IndexMap)
 
 	var episodes []string
@@ -159,13 +215,7 @@ func (p *Podcast) syncPodcast(url string) error {
 			}
 		}
 
-		fields := make(search.FieldMap)
-		search.AddField(fields, FieldAuthor, episode.Author)
-		search.AddField(fields, FieldDate, episode.Date)
-		search.AddField(fields, FieldDescription, episode.Description) // html
-		search.AddField(fields, FieldSeries, series.Title + " / " + series.Author)
-		search.AddField(fields, FieldTitle, episode.Title)
-		index[episode.EID] = fields
+		index[episode.EID] = episodeFields(series, episode)
 
 		episodes = append(episodes, eid)
 	}
@@ -181,3 +231,22 @@ func (p *Podcast) syncPodcast(url string) error {
 
 	return nil
 }
+
+func episodeFields(series *Series, episode *Episode) search.FieldMap {
+	fields := make(search.FieldMap)
+	search.AddField(fields, FieldAuthor, episode.Author)
+	search.AddField(fields, FieldDate, episode.Date)
+	search.AddField(fields, FieldDescription, episode.Description) // html
+	search.AddField(fields, FieldSeries, series.Title+" / "+series.Author)
+	search.AddField(fields, FieldTitle, episode.Title)
+	return fields
+}
+
+func (p *Podcast) suggestSeries(series *Series) error {
+	s, err := p.newSuggest()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Add(SuggestSeries, strconv.Itoa(int(series.ID)), series.Title)
+}
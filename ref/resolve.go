@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -58,8 +59,8 @@ type Context interface {
 	Locator
 }
 
-func trackEntry(ctx Context, t music.Track) spiff.Entry {
-	return spiff.Entry{
+func trackEntry(ctx Context, t music.Track, analyses map[string]music.Analysis) spiff.Entry {
+	entry := spiff.Entry{
 		Creator:    t.PreferredArtist(),
 		Album:      t.ReleaseTitle,
 		Title:      t.Title,
@@ -68,7 +69,16 @@ func trackEntry(ctx Context, t music.Track) spiff.Entry {
 		Identifier: []string{t.ETag},
 		Size:       []int64{t.Size},
 		Date:       date.FormatJson(t.ReleaseDate),
+		Duration:   t.Duration,
+	}
+	// ReplayGain for clients to normalize volume
+	if a, ok := analyses[t.ETag]; ok {
+		entry.TrackGain = a.TrackGain
+		entry.TrackPeak = a.TrackPeak
+		entry.AlbumGain = a.AlbumGain
+		entry.AlbumPeak = a.AlbumPeak
 	}
+	return entry
 }
 
 func movieEntry(ctx Context, m video.Movie) spiff.Entry {
@@ -81,6 +91,7 @@ func movieEntry(ctx Context, m video.Movie) spiff.Entry {
 		Identifier: []string{m.ETag},
 		Size:       []int64{m.Size},
 		Date:       date.FormatJson(m.Date),
+		Duration:   m.Runtime * 60 * 1000,
 	}
 }
 
@@ -102,8 +113,9 @@ func episodeEntry(ctx Context, series podcast.Series, e podcast.Episode) spiff.E
 }
 
 func addTrackEntries(ctx Context, tracks []music.Track, entries []spiff.Entry) []spiff.Entry {
+	analyses := ctx.Music().TrackAnalyses(tracks)
 	for _, t := range tracks {
-		entries = append(entries, trackEntry(ctx, t))
+		entries = append(entries, trackEntry(ctx, t, analyses))
 	}
 	return entries
 }
@@ -140,6 +152,8 @@ func resolveArtistTrackList(v *view.Artist, res string) view.TrackList {
 	switch res {
 	case "deep":
 		tracks = v.Deep
+	case "family":
+		tracks = v.Family
 	case "popular":
 		tracks = v.Popular
 	case "radio", "similar":
@@ -154,6 +168,28 @@ func resolveArtistTrackList(v *view.Artist, res string) view.TrackList {
 	return tracks
 }
 
+// /music/artists/{id}/setlist/{year}
+// /music/artists/{id}/setlist/tour/{tour}
+// Setlist songs that aren't in the library are returned as missing.
+func resolveSetlistRef(ctx Context, id, year, tour string, entries []spiff.Entry) ([]spiff.Entry, []string, error) {
+	artist, err := ctx.FindArtist(id)
+	if err != nil {
+		return entries, nil, err
+	}
+	var setlist *music.ConcertSetlist
+	if year != "" {
+		y, _ := strconv.Atoi(year)
+		setlist, err = ctx.Music().ArtistYearSetlist(artist, y)
+	} else {
+		setlist, err = ctx.Music().ArtistTourSetlist(artist, tour)
+	}
+	if err != nil {
+		return entries, nil, err
+	}
+	entries = addTrackEntries(ctx, setlist.Tracks, entries)
+	return entries, setlist.Missing, nil
+}
+
 // /music/releases/{id}/tracks
 func resolveReleaseRef(ctx Context, id string, entries []spiff.Entry) ([]spiff.Entry, error) {
 	release, err := ctx.FindRelease(id)
@@ -166,6 +202,17 @@ func resolveReleaseRef(ctx Context, id string, entries []spiff.Entry) ([]spiff.E
 	return entries, nil
 }
 
+// /music/works/{id}
+// /music/works/{id}/releases/{reid}
+func resolveWorkRef(ctx Context, id, reid string, entries []spiff.Entry) ([]spiff.Entry, error) {
+	_, tracks, err := ctx.Music().WorkRelease(id, reid)
+	if err != nil {
+		return entries, err
+	}
+	entries = addTrackEntries(ctx, tracks, entries)
+	return entries, nil
+}
+
 // /music/tracks/{id}
 func resolveTrackRef(ctx Context, id string, entries []spiff.Entry) ([]spiff.Entry, error) {
 	t, err := ctx.FindTrack(id)
@@ -237,7 +284,7 @@ func resolveSearchRef(ctx Context, uri string, entries []spiff.Entry) ([]spiff.E
 	}
 
 	if radio {
-		tracks = music.Shuffle(tracks)
+		tracks = music.Shuffle(ctx.Music().Dedupe(tracks))
 		limit := ctx.Config().Music.RadioLimit
 		if len(tracks) > limit {
 			tracks = tracks[:limit]
@@ -354,8 +401,12 @@ func RefreshStation(ctx Context, s *music.Station) *spiff.Playlist {
 
 var (
 	artistsRegexp      = regexp.MustCompile(`^/music/artists/([0-9a-zA-Z-]+)/([\w]+)$`)
+	setlistYearRegexp  = regexp.MustCompile(`^/music/artists/([0-9a-zA-Z-]+)/setlist/([\d]{4})$`)
+	setlistTourRegexp  = regexp.MustCompile(`^/music/artists/([0-9a-zA-Z-]+)/setlist/tour/(.+)$`)
 	releasesRegexp     = regexp.MustCompile(`^/music/releases/([0-9a-zA-Z-]+)/tracks$`)
 	tracksRegexp       = regexp.MustCompile(`^/music/tracks/([\d]+)$`)
+	worksRegexp        = regexp.MustCompile(`^/music/works/([0-9a-zA-Z-]+)$`)
+	workReleaseRegexp  = regexp.MustCompile(`^/music/works/([0-9a-zA-Z-]+)/releases/([0-9a-zA-Z-]+)$`)
 	searchRegexp       = regexp.MustCompile(`^/music/search.*`)
 	radioRegexp        = regexp.MustCompile(`^/music/radio/stations/([\d]+)$`)
 	moviesRegexp       = regexp.MustCompile(`^/movies/([\d]+)$`)
@@ -367,6 +418,7 @@ var (
 
 func Resolve(ctx Context, plist *spiff.Playlist) (err error) {
 	var entries []spiff.Entry
+	var missing []string
 
 	for _, e := range plist.Spiff.Entries {
 		if e.Ref == "" {
@@ -385,6 +437,28 @@ func Resolve(ctx Context, plist *spiff.Playlist) (err error) {
 			continue
 		}
 
+		matches = setlistYearRegexp.FindStringSubmatch(pathRef)
+		if matches != nil {
+			var songs []string
+			entries, songs, err = resolveSetlistRef(ctx, matches[1], matches[2], "", entries)
+			if err != nil {
+				return err
+			}
+			missing = append(missing, songs...)
+			continue
+		}
+
+		matches = setlistTourRegexp.FindStringSubmatch(pathRef)
+		if matches != nil {
+			var songs []string
+			entries, songs, err = resolveSetlistRef(ctx, matches[1], "", matches[2], entries)
+			if err != nil {
+				return err
+			}
+			missing = append(missing, songs...)
+			continue
+		}
+
 		matches = releasesRegexp.FindStringSubmatch(pathRef)
 		if matches != nil {
 			entries, err = resolveReleaseRef(ctx, matches[1], entries)
@@ -394,6 +468,24 @@ func Resolve(ctx Context, plist *spiff.Playlist) (err error) {
 			continue
 		}
 
+		matches = worksRegexp.FindStringSubmatch(pathRef)
+		if matches != nil {
+			entries, err = resolveWorkRef(ctx, matches[1], "", entries)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		matches = workReleaseRegexp.FindStringSubmatch(pathRef)
+		if matches != nil {
+			entries, err = resolveWorkRef(ctx, matches[1], matches[2], entries)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		matches = tracksRegexp.FindStringSubmatch(pathRef)
 		if matches != nil {
 			entries, err = resolveTrackRef(ctx, matches[1], entries)
@@ -467,6 +559,11 @@ func Resolve(ctx Context, plist *spiff.Playlist) (err error) {
 	}
 
 	plist.Spiff.Entries = entries
+	plist.Missing = missing
+	plist.Spiff.Duration = 0
+	for _, e := range entries {
+		plist.Spiff.Duration += e.Duration
+	}
 
 	return nil
 }
@@ -501,6 +598,18 @@ func ResolveReleasePlaylist(ctx Context, v *view.Release, path string) *spiff.Pl
 	return plist
 }
 
+func ResolveWorkPlaylist(ctx Context, v *view.Work, path string) *spiff.Playlist {
+	// /music/works/{id}
+	plist := spiff.NewPlaylist(spiff.TypeMusic)
+	plist.Spiff.Location = path
+	plist.Spiff.Creator = v.Work.Composer
+	plist.Spiff.Title = v.Work.Title
+	plist.Spiff.Image = v.CoverSmall(v.Release)
+	plist.Spiff.Date = date.FormatJson(v.Release.Date)
+	plist.Spiff.Entries = addTrackEntries(ctx, v.Tracks, plist.Spiff.Entries)
+	return plist
+}
+
 func ResolveMoviePlaylist(ctx Context, v *view.Movie, path string) *spiff.Playlist {
 	// /movies/{id}
 	var directing []string
@@ -23,14 +23,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/defsub/takeout/activity"
 	"github.com/defsub/takeout/auth"
 	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/encoding/atom"
 	"github.com/defsub/takeout/lib/encoding/xspf"
 	"github.com/defsub/takeout/lib/log"
+	"github.com/defsub/takeout/lib/search"
 	"github.com/defsub/takeout/lib/spiff"
 	"github.com/defsub/takeout/lib/str"
 	"github.com/defsub/takeout/music"
@@ -41,6 +44,9 @@ import (
 
 const (
 	ApplicationJson = "application/json"
+	TextPlain       = "text/plain; charset=utf-8"
+	TextCSV         = "text/csv; charset=utf-8"
+	TextMarkdown    = "text/markdown; charset=utf-8"
 
 	ParamID   = ":id"
 	ParamRes  = ":res"
@@ -55,6 +61,7 @@ var (
 	HeaderLastModified  = http.CanonicalHeaderKey("Last-Modified")
 	HeaderCacheControl  = http.CanonicalHeaderKey("Cache-Control")
 	HeaderETag          = http.CanonicalHeaderKey("ETag")
+	HeaderTotalCount    = http.CanonicalHeaderKey("X-Total-Count")
 )
 
 type credentials struct {
@@ -64,8 +71,8 @@ type credentials struct {
 
 type status struct {
 	Status  int
-	Message string `json:,omitempty`
-	Cookie  string `json:,omitempty`
+	Message string `json:",omitempty"`
+	Cookie  string `json:",omitempty"`
 }
 
 // apiLogin handles login requests and returns a cookie.
@@ -205,7 +212,11 @@ func apiCodeGet(w http.ResponseWriter, r *http.Request) {
 	var resp codeResponse
 	var err error
 	ctx.Auth().DeleteExpiredCodes();
-	code := ctx.Auth().GenerateCode()
+	code, err := ctx.Auth().GenerateCode()
+	if err != nil {
+		serverErr(w, err)
+		return
+	}
 	resp.Code = code.Value
 	resp.AccessToken, err = ctx.Auth().NewCodeToken(code.Value)
 	if err != nil {
@@ -456,14 +467,92 @@ func apiIndex(w http.ResponseWriter, r *http.Request) {
 func apiSearch(w http.ResponseWriter, r *http.Request) {
 	ctx := contextValue(r)
 	if v := r.URL.Query().Get("q"); v != "" {
-		// /api/search?q={pattern}
-		view := view.SearchView(ctx, strings.TrimSpace(v))
+		// /api/search?q={pattern}[&offset={offset}][&limit={limit}][&sort={sort}]
+		//   [&track_offset={offset}][&movie_offset={offset}]
+		page, err := searchPageParams(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		view := view.SearchView(ctx, strings.TrimSpace(v), page)
 		apiView(w, r, view)
 	} else {
 		notFoundErr(w)
 	}
 }
 
+// searchParams parses the optional search paging and sort parameters.
+func searchParams(r *http.Request) (offset, limit int, sort string, err error) {
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset = str.Atoi(v)
+		if offset < 0 || v != str.Itoa(offset) {
+			return 0, 0, "", ErrInvalidOffset
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit = str.Atoi(v)
+		if limit <= 0 {
+			return 0, 0, "", ErrInvalidLimit
+		}
+	}
+	sort = r.URL.Query().Get("sort")
+	if !search.ValidSort(sort) {
+		return 0, 0, "", search.ErrInvalidSort
+	}
+	return offset, limit, sort, nil
+}
+
+// searchPageParams parses the search paging and sort parameters. Tracks and
+// movies are paged separately using track_offset and movie_offset, which
+// default to offset.
+func searchPageParams(r *http.Request) (view.SearchPage, error) {
+	offset, limit, sort, err := searchParams(r)
+	if err != nil {
+		return view.SearchPage{}, err
+	}
+	page := view.SearchPage{
+		TrackOffset: offset,
+		MovieOffset: offset,
+		Limit:       limit,
+		Sort:        sort,
+	}
+	if v := r.URL.Query().Get("track_offset"); v != "" {
+		page.TrackOffset = str.Atoi(v)
+		if page.TrackOffset < 0 || v != str.Itoa(page.TrackOffset) {
+			return view.SearchPage{}, ErrInvalidOffset
+		}
+	}
+	if v := r.URL.Query().Get("movie_offset"); v != "" {
+		page.MovieOffset = str.Atoi(v)
+		if page.MovieOffset < 0 || v != str.Itoa(page.MovieOffset) {
+			return view.SearchPage{}, ErrInvalidOffset
+		}
+	}
+	return page, nil
+}
+
+func apiSuggest(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	v := strings.TrimSpace(r.URL.Query().Get("q"))
+	if v == "" {
+		badRequest(w, ErrMissingQuery)
+		return
+	}
+	// /api/suggest?q={prefix}[&limit={limit}]
+	limit := ctx.Config().Search.SuggestLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n := str.Atoi(l)
+		if n <= 0 {
+			badRequest(w, ErrInvalidLimit)
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+	apiView(w, r, view.SuggestView(ctx, v, limit))
+}
+
 func apiArtists(w http.ResponseWriter, r *http.Request) {
 	ctx := contextValue(r)
 	apiView(w, r, view.ArtistsView(ctx))
@@ -497,12 +586,45 @@ func apiArtistGetResource(w http.ResponseWriter, r *http.Request) {
 			apiArtistGetPlaylist(w, r)
 		case "wantlist":
 			apiView(w, r, view.WantListView(ctx, artist))
+		case "setlist":
+			apiArtistSetlist(w, r, artist)
 		default:
 			notFoundErr(w)
 		}
 	}
 }
 
+// apiArtistSetlist matches a concert setlist to library tracks.
+// /api/artists/:id/setlist?year={year}
+// /api/artists/:id/setlist?tour={tour}
+func apiArtistSetlist(w http.ResponseWriter, r *http.Request, artist music.Artist) {
+	ctx := contextValue(r)
+	m := ctx.Music()
+	var setlist *music.ConcertSetlist
+	var ref string
+	var err error
+	if tour := r.URL.Query().Get("tour"); tour != "" {
+		ref = music.SetlistTourRef(artist, tour)
+		setlist, err = m.ArtistTourSetlist(artist, tour)
+	} else {
+		year := str.Atoi(r.URL.Query().Get("year"))
+		if year < 1000 || year > 9999 {
+			badRequest(w, ErrInvalidYear)
+			return
+		}
+		ref = music.SetlistYearRef(artist, year)
+		setlist, err = m.ArtistYearSetlist(artist, year)
+	}
+	if err == music.ErrConcertNotFound {
+		notFoundErr(w)
+		return
+	} else if err != nil {
+		serverErr(w, err)
+		return
+	}
+	apiView(w, r, view.SetlistView(ctx, artist, setlist, ref))
+}
+
 func apiArtistGetPlaylist(w http.ResponseWriter, r *http.Request) {
 	ctx := contextValue(r)
 	id := r.URL.Query().Get(ParamID)
@@ -759,6 +881,242 @@ func apiReleaseGet(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func apiTrackGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	id := r.URL.Query().Get(ParamID)
+	track, err := ctx.FindTrack(id)
+	if err != nil {
+		notFoundErr(w)
+	} else {
+		apiView(w, r, view.TrackView(ctx, track))
+	}
+}
+
+func apiCreditsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	arid := r.URL.Query().Get(ParamID)
+	view := view.CreditsView(ctx, arid)
+	if view.Name == "" {
+		notFoundErr(w)
+	} else {
+		apiView(w, r, view)
+	}
+}
+
+// wantFilter returns the wantlist filter from the request query:
+// artist={name} (repeated), type={album,ep,single,live}, after={date},
+// before={date}, official={bool}, played={duration|true}, offset and limit.
+func wantFilter(ctx Context, r *http.Request) (music.WantFilter, error) {
+	f := music.NewWantFilter()
+	q := r.URL.Query()
+	f.Artists = q["artist"]
+	if v := q.Get("type"); v != "" {
+		types, err := music.ParseWantTypes(v)
+		if err != nil {
+			return f, err
+		}
+		f.Types = types
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"after", &f.After}, {"before", &f.Before}} {
+		if v := q.Get(p.name); v != "" {
+			*p.t = date.ParseDate(v)
+			if p.t.IsZero() {
+				return f, ErrInvalidDate
+			}
+		}
+	}
+	if v := q.Get("official"); v != "" {
+		official, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, err
+		}
+		f.Official = official
+	}
+	if v := q.Get("played"); v != "" {
+		// played within a duration or the recent duration
+		d := ctx.Config().Music.Recent
+		if played, err := strconv.ParseBool(v); err == nil {
+			if !played {
+				d = 0
+			}
+		} else {
+			d, err = time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return f, ErrInvalidDuration
+			}
+		}
+		if d > 0 {
+			f.Played = ctx.Activity().ReleaseGroupPlays(ctx, time.Now().Add(-d))
+		}
+	}
+	offset, limit, _, err := searchParams(r)
+	if err != nil {
+		return f, err
+	}
+	f.Offset = offset
+	f.Limit = limit
+	return f, nil
+}
+
+// apiWantList lists wanted releases from all artists as JSON,
+// CSV (wantlist.csv) or Markdown (wantlist.md). JSON pages are limited to
+// the configured wantlist limit; exports include all releases unless a
+// limit is requested. The total number of releases is in X-Total-Count.
+func apiWantList(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	filter, err := wantFilter(ctx, r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	csv := strings.HasSuffix(r.URL.Path, ".csv")
+	md := strings.HasSuffix(r.URL.Path, ".md")
+	if !csv && !md {
+		max := ctx.Config().Music.WantListLimit
+		if filter.Limit == 0 || filter.Limit > max {
+			filter.Limit = max
+		}
+	}
+	view := view.WantListPageView(ctx, filter)
+	w.Header().Set(HeaderTotalCount, strconv.FormatInt(view.Total, 10))
+	switch {
+	case csv:
+		w.Header().Set(HeaderContentType, TextCSV)
+		err = music.WriteWantCSV(w, view.Releases)
+	case md:
+		w.Header().Set(HeaderContentType, TextMarkdown)
+		err = music.WriteWantMarkdown(w, view.Releases)
+	default:
+		apiView(w, r, view)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// apiNewReleases lists recent and upcoming releases by library artists.
+func apiNewReleases(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	apiView(w, r, view.NewReleasesView(ctx))
+}
+
+// apiNewReleasesFeed has recent and upcoming releases by library artists as
+// an Atom feed for feed readers.
+func apiNewReleasesFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	view := view.NewReleasesView(ctx)
+
+	self := fmt.Sprintf("%s://%s%s", requestScheme(ctx, r), r.Host, r.URL.Path)
+
+	feed := atom.NewFeed(self, "Takeout New Releases", self)
+	updated := time.Time{}
+	for _, nr := range view.Releases {
+		if nr.FirstSeen.After(updated) {
+			updated = nr.FirstSeen
+		}
+		link := fmt.Sprintf("https://musicbrainz.org/release-group/%s", nr.RGID)
+		title := fmt.Sprintf("%s - %s", nr.Artist, nr.Name)
+		if nr.Disambiguation != "" {
+			title = fmt.Sprintf("%s (%s)", title, nr.Disambiguation)
+		}
+		feed.Entries = append(feed.Entries, atom.Entry{
+			ID:        link,
+			Title:     title,
+			Updated:   atom.Time(nr.FirstSeen),
+			Published: atom.Time(nr.FirstSeen),
+			Author:    &atom.Person{Name: nr.Artist},
+			Links:     []atom.Link{{Href: link, Rel: "alternate"}},
+			Summary: &atom.Text{Value: fmt.Sprintf("%s by %s, released %s",
+				nr.Type, nr.Artist, date.YMD(nr.Date))},
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = atom.Time(updated)
+
+	w.Header().Set(HeaderContentType, atom.ContentType)
+	err := atom.Encode(w, feed)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func apiComposers(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	apiView(w, r, view.ComposersView(ctx))
+}
+
+func apiComposerGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	id := r.URL.Query().Get(ParamID)
+	view := view.ComposerView(ctx, id)
+	if len(view.Works) == 0 {
+		notFoundErr(w)
+	} else {
+		apiView(w, r, view)
+	}
+}
+
+// apiWorkGet has the work with tracks in movement order from the release
+// given by the optional reid query parameter.
+func apiWorkGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	id := r.URL.Query().Get(ParamID)
+	view := view.WorkView(ctx, id, r.URL.Query().Get("reid"))
+	if len(view.Tracks) == 0 {
+		notFoundErr(w)
+	} else {
+		apiView(w, r, view)
+	}
+}
+
+func apiWorkGetPlaylist(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	id := r.URL.Query().Get(ParamID)
+	view := view.WorkView(ctx, id, r.URL.Query().Get("reid"))
+	if len(view.Tracks) == 0 {
+		notFoundErr(w)
+	} else {
+		plist := ref.ResolveWorkPlaylist(ctx, view, r.URL.Path)
+		writePlaylist(w, r, plist)
+	}
+}
+
+// apiCatalog lists the terms in a music catalog such as labels or genres.
+func apiCatalog(catalog string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := contextValue(r)
+		apiView(w, r, view.CatalogView(ctx, catalog))
+	}
+}
+
+// apiCatalogGet lists a page of releases for a term in a music catalog, such
+// as /api/labels/{name} or /api/decades/1990s, using offset and limit.
+func apiCatalogGet(catalog string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := contextValue(r)
+		name := r.URL.Query().Get(ParamName)
+		query, err := music.CatalogQuery(catalog, name)
+		if err != nil {
+			notFoundErr(w)
+			return
+		}
+		offset, limit, _, err := searchParams(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		if limit == 0 {
+			limit = ctx.Config().Music.SearchLimit
+		}
+		apiView(w, r, view.CatalogReleasesView(ctx, catalog, name, query, offset, limit))
+	}
+}
+
 func apiReleaseGetPlaylist(w http.ResponseWriter, r *http.Request) {
 	ctx := contextValue(r)
 	id := r.URL.Query().Get(ParamID)
@@ -789,6 +1147,42 @@ func apiTrackLocation(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, url.String(), http.StatusTemporaryRedirect)
 }
 
+// apiTrackLyrics has the track lyrics as json with timestamped lines when
+// synced, as plain text (lyrics.txt) or as LRC (lyrics.lrc).
+func apiTrackLyrics(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	uuid := r.URL.Query().Get(ParamUUID)
+	track, err := ctx.FindTrack("uuid:" + uuid)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	if track.UUID != uuid {
+		accessDenied(w)
+		return
+	}
+	lyrics, err := ctx.Music().TrackLyrics(track)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".txt"):
+		w.Header().Set(HeaderContentType, TextPlain)
+		w.Write([]byte(lyrics.Unsynced()))
+	case strings.HasSuffix(r.URL.Path, ".lrc"):
+		if !lyrics.Synced() {
+			notFoundErr(w)
+			return
+		}
+		w.Header().Set(HeaderContentType, TextPlain)
+		w.Write([]byte(lyrics.Text))
+	default:
+		apiView(w, r, view.LyricsView(ctx, lyrics))
+	}
+}
+
 func apiMovieLocation(w http.ResponseWriter, r *http.Request) {
 	ctx := contextValue(r)
 	uuid := r.URL.Query().Get(ParamUUID)
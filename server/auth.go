@@ -18,10 +18,12 @@
 package server
 
 import (
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/defsub/takeout/auth"
+	"github.com/defsub/takeout/lib/log"
 )
 
 type bits uint8
@@ -30,8 +32,12 @@ const (
 	AllowCookie bits = 1 << iota
 	AllowAccessToken
 	AllowMediaToken
+	AllowProxyHeader
+	AllowBasicAuth
 
 	AuthorizationHeader = "Authorization"
+	AuthenticateHeader  = "WWW-Authenticate"
+	BasicRealm          = `Basic realm="takeout"`
 	BearerAuthorization = "Bearer"
 )
 
@@ -99,6 +105,115 @@ func authorizeMediaToken(ctx Context, w http.ResponseWriter, r *http.Request) (*
 	return &user, nil
 }
 
+// authorizeBasicAuth validates the user and password provided with HTTP
+// basic authentication, used by clients like feed readers that can't obtain
+// tokens.
+func authorizeBasicAuth(ctx Context, w http.ResponseWriter, r *http.Request) (*auth.User, error) {
+	userid, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	user, err := ctx.Auth().Check(userid, pass)
+	if err != nil {
+		w.Header().Set(AuthenticateHeader, BasicRealm)
+		authErr(w, ErrAccessDenied)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// parseTrustedProxies parses the configured trusted proxy CIDRs. Invalid
+// entries are logged and ignored.
+func parseTrustedProxies(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("invalid trusted proxy %s: %s\n", cidr, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// trustedProxy returns true if the request came from a configured trusted
+// proxy address.
+func trustedProxy(ctx Context, r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range ctx.TrustedProxies() {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestScheme is the scheme used by the client. X-Forwarded-Proto is only
+// used from trusted proxies since other clients can set any value.
+func requestScheme(ctx Context, r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if trustedProxy(ctx, r) {
+		switch v := r.Header.Get("X-Forwarded-Proto"); v {
+		case "http", "https":
+			return v
+		}
+	}
+	return "http"
+}
+
+// authorizeProxyHeader validates the user header provided by a trusted proxy.
+func authorizeProxyHeader(ctx Context, w http.ResponseWriter, r *http.Request) (*auth.User, error) {
+	cfg := ctx.Config().Auth.Proxy
+	if !cfg.Enabled || cfg.Header == "" {
+		return nil, nil
+	}
+	name := strings.TrimSpace(r.Header.Get(cfg.Header))
+	if name == "" || !trustedProxy(ctx, r) {
+		return nil, nil
+	}
+	a := ctx.Auth()
+	user, err := a.User(name)
+	if err == auth.ErrUserNotFound && cfg.AutoCreate {
+		user, err = a.AddProxyUser(name, cfg.Media)
+	}
+	if err != nil {
+		authErr(w, err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// proxySessionCookie sends a session cookie to web clients authenticated by
+// the proxy header, unless they already have one for the user. Media
+// requests only accept media tokens or cookies so the browser needs the
+// cookie for playback and local artwork.
+func proxySessionCookie(ctx Context, w http.ResponseWriter, r *http.Request, user *auth.User) {
+	a := ctx.Auth()
+	if cookie, err := r.Cookie(auth.CookieName); err == nil {
+		session := a.CookieSession(cookie)
+		if session != nil && !session.Expired() && session.User == user.Name {
+			return
+		}
+	}
+	session, err := a.UserSession(user)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	cookie := a.NewCookie(&session)
+	http.SetCookie(w, &cookie)
+}
+
 // authorizeCodeToken validates the provided JWT code token for code auth access.
 func authorizeCodeToken(ctx Context, w http.ResponseWriter, r *http.Request) error {
 	token := getAuthToken(r)
@@ -199,6 +314,19 @@ func authorizeRequest(ctx Context, w http.ResponseWriter, r *http.Request, auth
 		}
 	}
 
+	if auth&AllowProxyHeader != 0 {
+		user, err := authorizeProxyHeader(ctx, w, r)
+		if user != nil {
+			if auth&AllowCookie != 0 {
+				proxySessionCookie(ctx, w, r, user)
+			}
+			return user
+		}
+		if err != nil {
+			return nil
+		}
+	}
+
 	if auth&AllowMediaToken != 0 {
 		user, err := authorizeMediaToken(ctx, w, r)
 		if user != nil {
@@ -209,6 +337,22 @@ func authorizeRequest(ctx Context, w http.ResponseWriter, r *http.Request, auth
 		}
 	}
 
+	if auth&AllowBasicAuth != 0 {
+		user, err := authorizeBasicAuth(ctx, w, r)
+		if user != nil {
+			return user
+		}
+		if err != nil {
+			return nil
+		}
+		if auth&AllowCookie == 0 {
+			// ask for credentials
+			w.Header().Set(AuthenticateHeader, BasicRealm)
+			authErr(w, ErrMissingToken)
+			return nil
+		}
+	}
+
 	if auth&AllowCookie != 0 {
 		user, err := authorizeCookie(ctx, w, r)
 		if user != nil {
@@ -251,14 +395,39 @@ func authHandler(ctx RequestContext, handler http.HandlerFunc, auth bits) http.H
 	return http.HandlerFunc(fn)
 }
 
-// mediaTokenAuthHandler handles media access requests using the media token (or cookie).
+// mediaTokenAuth allows media access using the media token (or cookie).
+// Media location URLs used by apps always require media tokens.
+const mediaTokenAuth = AllowMediaToken | AllowCookie
+
+// mediaTokenAuthHandler handles media access requests using the media token
+// (or cookie).
 func mediaTokenAuthHandler(ctx RequestContext, handler http.HandlerFunc) http.Handler {
-	return authHandler(ctx, handler, AllowMediaToken|AllowCookie)
+	return authHandler(ctx, handler, mediaTokenAuth)
 }
 
-// accessTokenAuthHandler handles non-media requests using the access token (or cookie).
+// accessTokenAuthHandler handles non-media requests using the access token,
+// trusted proxy header (or cookie).
 func accessTokenAuthHandler(ctx RequestContext, handler http.HandlerFunc) http.Handler {
-	return authHandler(ctx, handler, AllowAccessToken|AllowCookie)
+	return authHandler(ctx, handler, AllowAccessToken|AllowProxyHeader|AllowCookie)
+}
+
+// feedAuthHandler handles feed requests using the access token, trusted
+// proxy header or basic authentication.
+func feedAuthHandler(ctx RequestContext, handler http.HandlerFunc) http.Handler {
+	return authHandler(ctx, handler, AllowAccessToken|AllowProxyHeader|AllowBasicAuth)
+}
+
+// adminAuthHandler handles admin requests using the access token (or cookie).
+func adminAuthHandler(ctx RequestContext, handler http.HandlerFunc) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := contextValue(r)
+		if !ctx.User().Admin {
+			accessDenied(w)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+	return accessTokenAuthHandler(ctx, http.HandlerFunc(fn))
 }
 
 func codeTokenAuthHandler(ctx RequestContext, handler http.HandlerFunc) http.Handler {
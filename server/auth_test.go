@@ -0,0 +1,231 @@
+// Copyright (C) 2023 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/defsub/takeout/auth"
+	"github.com/defsub/takeout/config"
+)
+
+func proxyContext(cfg *config.Config) RequestContext {
+	return RequestContext{
+		config:  cfg,
+		proxies: parseTrustedProxies(cfg.Auth.Proxy.TrustedProxies),
+	}
+}
+
+func proxyConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Auth.Proxy = config.ProxyConfig{
+		Enabled:        true,
+		Header:         "Remote-User",
+		TrustedProxies: []string{"10.0.0.0/8", "::1/128", "not-a-cidr"},
+	}
+	return cfg
+}
+
+func TestTrustedProxy(t *testing.T) {
+	ctx := proxyContext(proxyConfig())
+	if len(ctx.TrustedProxies()) != 2 {
+		t.Errorf("expected 2 trusted networks, got %d\n", len(ctx.TrustedProxies()))
+	}
+
+	tests := []struct {
+		remoteAddr string
+		trusted    bool
+	}{
+		{"10.1.2.3:4321", true},
+		{"10.255.255.255:80", true},
+		{"[::1]:8080", true},
+		{"10.1.2.3", true},
+		{"11.0.0.1:4321", false},
+		{"192.168.1.10:4321", false},
+		{"[::2]:8080", false},
+		{"", false},
+		{"garbage", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/home", nil)
+		r.RemoteAddr = test.remoteAddr
+		if got := trustedProxy(ctx, r); got != test.trusted {
+			t.Errorf("%q trusted %v, expected %v\n", test.remoteAddr, got, test.trusted)
+		}
+	}
+}
+
+func TestRequestScheme(t *testing.T) {
+	ctx := proxyContext(proxyConfig())
+	tests := []struct {
+		remoteAddr string
+		proto      string
+		scheme     string
+	}{
+		{"10.1.2.3:4321", "https", "https"},
+		{"10.1.2.3:4321", "http", "http"},
+		{"10.1.2.3:4321", "", "http"},
+		{"10.1.2.3:4321", "javascript", "http"},
+		{"192.168.1.10:4321", "https", "http"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/releases/upcoming.atom", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		if got := requestScheme(ctx, r); got != test.scheme {
+			t.Errorf("%q %q scheme %q, expected %q\n",
+				test.remoteAddr, test.proto, got, test.scheme)
+		}
+	}
+}
+
+func TestProxyHeaderUntrusted(t *testing.T) {
+	cfg := proxyConfig()
+	ctx := proxyContext(cfg)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		addr    string
+		headers map[string]string
+	}{
+		{"untrusted address", true, "192.168.1.10:4321",
+			map[string]string{"Remote-User": "admin"}},
+		{"spoofed forwarded for", true, "192.168.1.10:4321",
+			map[string]string{"Remote-User": "admin", "X-Forwarded-For": "10.1.2.3",
+				"X-Real-Ip": "10.1.2.3"}},
+		{"trusted without header", true, "10.1.2.3:4321",
+			map[string]string{"X-Forwarded-User": "admin"}},
+		{"trusted blank header", true, "10.1.2.3:4321",
+			map[string]string{"Remote-User": "  "}},
+		{"disabled", false, "10.1.2.3:4321",
+			map[string]string{"Remote-User": "admin"}},
+	}
+	for _, test := range tests {
+		cfg.Auth.Proxy.Enabled = test.enabled
+		r := httptest.NewRequest("GET", "/api/home", nil)
+		r.RemoteAddr = test.addr
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		// ctx has no auth so any user lookup would panic
+		user, err := authorizeProxyHeader(ctx, w, r)
+		if user != nil || err != nil {
+			t.Errorf("%s: expected no user, got %v %v\n", test.name, user, err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d\n", test.name, w.Code)
+		}
+	}
+}
+
+func TestProxyHeaderTrusted(t *testing.T) {
+	cfg, err := config.TestConfig()
+	if err != nil {
+		t.Fatalf("GetConfig %s\n", err)
+	}
+	cfg.Auth.Proxy = proxyConfig().Auth.Proxy
+	a := auth.NewAuth(cfg)
+	err = a.Open()
+	if err != nil {
+		t.Fatalf("Open %s\n", err)
+	}
+	defer a.Close()
+
+	ctx := proxyContext(cfg)
+	ctx.auth = a
+
+	name := fmt.Sprintf("proxy-%d@defsub.com", time.Now().UnixNano())
+	request := func(addr string) (*auth.User, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "/api/home", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("Remote-User", name)
+		w := httptest.NewRecorder()
+		return authorizeRequest(ctx, w, r, AllowAccessToken|AllowProxyHeader), w
+	}
+
+	// unknown user without auto create
+	user, w := request("10.1.2.3:4321")
+	if user != nil || w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown user should be unauthorized, got %d\n", w.Code)
+	}
+
+	cfg.Auth.Proxy.AutoCreate = true
+	cfg.Auth.Proxy.Media = "testmedia"
+	user, _ = request("10.1.2.3:4321")
+	if user == nil || user.Name != name || user.Media != "testmedia" {
+		t.Fatalf("trusted proxy user should be created, got %v\n", user)
+	}
+	user, _ = request("[::1]:4321")
+	if user == nil || user.Name != name {
+		t.Errorf("trusted proxy user should be authorized, got %v\n", user)
+	}
+
+	// same header from an untrusted address is ignored
+	user, _ = request("192.168.1.10:4321")
+	if user != nil {
+		t.Errorf("untrusted proxy user should not be authorized")
+	}
+	// media locations still require a media token
+	r := httptest.NewRequest("GET", "/api/tracks/1/location", nil)
+	r.RemoteAddr = "10.1.2.3:4321"
+	r.Header.Set("Remote-User", name)
+	user = authorizeRequest(ctx, httptest.NewRecorder(), r, mediaTokenAuth)
+	if user != nil {
+		t.Errorf("proxy user should not be authorized for media")
+	}
+
+	// the web view sends a session cookie for media requests
+	view := func(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/v", nil)
+		r.RemoteAddr = "10.1.2.3:4321"
+		r.Header.Set("Remote-User", name)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		user := authorizeRequest(ctx, w, r, AllowAccessToken|AllowProxyHeader|AllowCookie)
+		if user == nil || user.Name != name {
+			t.Fatalf("proxy user should be authorized for views, got %v\n", user)
+		}
+		return w
+	}
+	cookies := view().Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.CookieName {
+		t.Fatalf("expected session cookie, got %v\n", cookies)
+	}
+	if again := view(cookies[0]).Result().Cookies(); len(again) != 0 {
+		t.Errorf("existing session cookie should be kept, got %v\n", again)
+	}
+
+	r = httptest.NewRequest("GET", "/api/tracks/1/location", nil)
+	r.RemoteAddr = "10.1.2.3:4321"
+	r.Header.Set("Remote-User", name)
+	r.AddCookie(cookies[0])
+	user = authorizeRequest(ctx, httptest.NewRecorder(), r, mediaTokenAuth)
+	if user == nil || user.Name != name {
+		t.Errorf("proxy user should be authorized for media with the session cookie")
+	}
+}
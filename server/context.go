@@ -21,11 +21,13 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 
 	"github.com/defsub/takeout/activity"
 	"github.com/defsub/takeout/auth"
 	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/jobs"
 	"github.com/defsub/takeout/lib/client"
 	"github.com/defsub/takeout/music"
 	"github.com/defsub/takeout/podcast"
@@ -51,6 +53,7 @@ type Context interface {
 	Activity() *activity.Activity
 	Auth() *auth.Auth
 	Config() *config.Config
+	Jobs() *jobs.Jobs
 	Music() *music.Music
 	Podcast() *podcast.Podcast
 	Progress() *progress.Progress
@@ -59,6 +62,7 @@ type Context interface {
 	Session() *auth.Session
 	Video() *video.Video
 	ImageClient() *client.Client
+	TrustedProxies() []*net.IPNet
 
 	LocateTrack(music.Track) string
 	LocateMovie(video.Movie) string
@@ -83,22 +87,27 @@ type RequestContext struct {
 	activity    *activity.Activity
 	auth        *auth.Auth
 	config      *config.Config
+	jobs        *jobs.Jobs
 	user        *auth.User
 	media       *Media
 	progress    *progress.Progress
 	session     *auth.Session
 	template    *template.Template
 	imageClient *client.Client
+	proxies     []*net.IPNet
 }
 
 func makeContext(ctx Context, u *auth.User, c *config.Config, m *Media) RequestContext {
 	return RequestContext{
 		activity: ctx.Activity(),
+		auth:     ctx.Auth(),
 		config:   c,
+		jobs:     ctx.Jobs(),
 		media:    m,
 		progress: ctx.Progress(),
 		template: ctx.Template(),
 		user:     u,
+		proxies:  ctx.TrustedProxies(),
 	}
 }
 
@@ -127,6 +136,10 @@ func (ctx RequestContext) Config() *config.Config {
 	return ctx.config
 }
 
+func (ctx RequestContext) Jobs() *jobs.Jobs {
+	return ctx.jobs
+}
+
 func (ctx RequestContext) Music() *music.Music {
 	return ctx.media.music
 }
@@ -215,6 +228,10 @@ func (ctx RequestContext) EpisodeImage(e podcast.Episode) string {
 	return ctx.Podcast().EpisodeImage(e)
 }
 
+func (ctx RequestContext) TrustedProxies() []*net.IPNet {
+	return ctx.proxies
+}
+
 func (ctx RequestContext) ImageClient() *client.Client {
 	return ctx.imageClient
 }
@@ -116,6 +116,26 @@ import (
 //  200: PlaylistResponse
 //  404: description: artist not found
 
+// swagger:route GET /artists/{id}/family.xspf ArtistFamilyExport
+// parameters:
+//  + in: path
+//    name: id
+//    type: integer
+//    required: true
+// responses:
+//  200: PlaylistResponse
+//  404: description: artist not found
+
+// swagger:route GET /artists/{id}/family ArtistFamily
+// parameters:
+//  + in: path
+//    name: id
+//    type: integer
+//    required: true
+// responses:
+//  200: PlaylistResponse
+//  404: description: artist not found
+
 // swagger:route GET /artists/{id}/radio.xspf ArtistRadioExport
 // parameters:
 //  + in: path
@@ -309,6 +329,18 @@ import (
 
 // ---------------------------------------------------------------------------
 
+// swagger:route GET /tracks/{uuid}/lyrics TrackLyrics
+// parameters:
+//  + in: path
+//    name: uuid
+//    type: string
+//    required: true
+// responses:
+//  200: LyricsResponse
+//  404: description: no lyrics
+
+// ---------------------------------------------------------------------------
+
 // swagger:route GET /radio/{id} RadioGet
 // parameters:
 //  + in: path
@@ -530,3 +562,11 @@ type SinglesResponse struct {
 		view.Singles
 	}
 }
+
+// swagger:response
+type LyricsResponse struct {
+	// in: body
+	Body struct {
+		view.Lyrics
+	}
+}
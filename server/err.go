@@ -37,6 +37,12 @@ var (
 	ErrMissingMediaToken  = errors.New("missing media token")
 	ErrMissingCcookie     = errors.New("missing cookie")
 	ErrInvalidSession     = errors.New("invalid session")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrMissingQuery       = errors.New("missing query")
+	ErrInvalidLimit       = errors.New("invalid limit")
+	ErrInvalidYear        = errors.New("invalid year")
+	ErrInvalidDate        = errors.New("invalid date")
+	ErrInvalidDuration    = errors.New("invalid duration")
 )
 
 func serverErr(w http.ResponseWriter, err error) {
@@ -263,8 +263,12 @@ func addSimpleTemplate(w *actions.WebhookResponse, m config.AssistantResponse, v
 }
 
 func authRequired(ctx Context, r *actions.WebhookRequest, w *actions.WebhookResponse) {
-	code := ctx.Auth().GenerateCode()
 	config := ctx.Config()
+	code, err := ctx.Auth().GenerateCode()
+	if err != nil {
+		addSimple(w, config.Assistant.Error)
+		return
+	}
 	vars := map[string]string{"Code": code.Value}
 	addSimpleTemplate(w, config.Assistant.Link, vars)
 	w.AddSuggestions(config.Assistant.SuggestionAuth)
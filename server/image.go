@@ -20,6 +20,9 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+
+	"github.com/defsub/takeout/music"
 )
 
 const (
@@ -93,3 +96,49 @@ func imgArtistBackground(w http.ResponseWriter, r *http.Request) {
 	url := fmt.Sprintf("%s/music/%s/artistbackground/%s", FanArtPrefix, arid, path)
 	checkImageCache(w, r, url)
 }
+
+// localImage redirects to a presigned bucket URL for image files. Embedded
+// images, or all images when configured, are sent directly instead.
+func localImage(w http.ResponseWriter, r *http.Request, art *music.LocalArtwork) {
+	ctx := contextValue(r)
+	m := ctx.Music()
+	if art.Source != music.ArtworkEmbedded && !ctx.Config().Music.ProxyLocalArtwork {
+		url := m.ArtworkURL(art)
+		if url != nil {
+			http.Redirect(w, r, url.String(), http.StatusTemporaryRedirect)
+			return
+		}
+	}
+	img, err := m.ArtworkImage(art)
+	if err != nil {
+		serverErr(w, err)
+		return
+	}
+	w.Header().Set(HeaderContentType, img.MIMEType)
+	w.Header().Set(HeaderContentLength, strconv.Itoa(len(img.Data)))
+	w.Header().Set(HeaderCacheControl, "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(img.Data)
+}
+
+func imgLocalRelease(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	reid := r.URL.Query().Get(":reid")
+	art, err := ctx.Music().ReleaseArtwork(reid)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	localImage(w, r, art)
+}
+
+func imgLocalArtist(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	arid := r.URL.Query().Get(":arid")
+	art, err := ctx.Music().ArtistArtwork(arid)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	localImage(w, r, art)
+}
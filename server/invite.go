@@ -0,0 +1,215 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/defsub/takeout/auth"
+)
+
+const (
+	ParamCode = ":code"
+)
+
+type inviteRequest struct {
+	Media string
+	Uses  int
+	Age   string // duration, such as 48h
+}
+
+type invite struct {
+	Code    string
+	Media   string
+	Uses    int
+	Expires time.Time
+	URL     string
+}
+
+type invitePage struct {
+	Code  string
+	Error string
+}
+
+func inviteURL(code string) string {
+	return fmt.Sprintf("/invite/%s", code)
+}
+
+func inviteFor(c auth.Code) invite {
+	return invite{
+		Code:    c.Value,
+		Media:   c.Media,
+		Uses:    c.Uses,
+		Expires: c.Expires,
+		URL:     inviteURL(c.Value),
+	}
+}
+
+// apiInvitesGet lists all invites.
+func apiInvitesGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	invites := []invite{}
+	for _, c := range ctx.Auth().Invites() {
+		invites = append(invites, inviteFor(c))
+	}
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(invites)
+}
+
+// apiInvitePost creates a new invite with preassigned media.
+func apiInvitePost(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+
+	var req inviteRequest
+	body, _ := ioutil.ReadAll(r.Body)
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	var age time.Duration
+	if req.Age != "" {
+		age, err = time.ParseDuration(req.Age)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+
+	media := req.Media
+	if media == "" {
+		// default to same media as the admin
+		media = ctx.User().Media
+	}
+
+	code, err := ctx.Auth().GenerateInvite(media, req.Uses, age)
+	if err != nil {
+		serverErr(w, err)
+		return
+	}
+
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	w.WriteHeader(http.StatusCreated)
+	enc := json.NewEncoder(w)
+	enc.Encode(inviteFor(*code))
+}
+
+// apiInviteDelete removes an invite.
+func apiInviteDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	value := r.URL.Query().Get(ParamCode)
+	err := ctx.Auth().DeleteInvite(value)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiInviteAccept creates a new user using an invite and returns tokens.
+func apiInviteAccept(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	value := r.URL.Query().Get(ParamCode)
+
+	var creds credentials
+	body, _ := ioutil.ReadAll(r.Body)
+	err := json.Unmarshal(body, &creds)
+	if err != nil || creds.User == "" || creds.Pass == "" {
+		badRequest(w, ErrInvalidCredentials)
+		return
+	}
+
+	_, err = ctx.Auth().AcceptInvite(value, creds.User, creds.Pass)
+	if err != nil {
+		inviteErr(w, err)
+		return
+	}
+
+	session, err := doLogin(ctx, creds.User, creds.Pass)
+	if err != nil {
+		serverErr(w, err)
+		return
+	}
+
+	authorizeNew(session, w, r)
+}
+
+func inviteErr(w http.ResponseWriter, err error) {
+	switch err {
+	case auth.ErrInviteNotFound:
+		notFoundErr(w)
+	case auth.ErrUserExists:
+		badRequest(w, err)
+	default:
+		serverErr(w, err)
+	}
+}
+
+// inviteHandler shows the invite page where a new user can pick a username
+// and password.
+func inviteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	value := r.URL.Query().Get(ParamCode)
+	if ctx.Auth().ValidInvite(value) == nil {
+		notFoundErr(w)
+		return
+	}
+	render(ctx, "invite.html", invitePage{Code: value}, w, r)
+}
+
+// inviteAcceptHandler creates a new user using the invite and sends back a
+// cookie.
+func inviteAcceptHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	value := r.URL.Query().Get(ParamCode)
+	r.ParseForm()
+	user := r.Form.Get("user")
+	pass := r.Form.Get("pass")
+	if user == "" || pass == "" {
+		render(ctx, "invite.html",
+			invitePage{Code: value, Error: ErrInvalidCredentials.Error()}, w, r)
+		return
+	}
+
+	_, err := ctx.Auth().AcceptInvite(value, user, pass)
+	if err == auth.ErrUserExists {
+		render(ctx, "invite.html", invitePage{Code: value, Error: err.Error()}, w, r)
+		return
+	} else if err != nil {
+		inviteErr(w, err)
+		return
+	}
+
+	session, err := doLogin(ctx, user, pass)
+	if err != nil {
+		serverErr(w, err)
+		return
+	}
+
+	cookie := ctx.Auth().NewCookie(&session)
+	http.SetCookie(w, &cookie)
+
+	// Use 303 for PRG
+	http.Redirect(w, r, SuccessRedirect, http.StatusSeeOther)
+}
@@ -18,59 +18,168 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
 	"github.com/go-co-op/gocron"
 
 	"github.com/defsub/takeout/auth"
 	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/jobs"
+	"github.com/defsub/takeout/lib/job"
 	"github.com/defsub/takeout/lib/log"
 	"github.com/defsub/takeout/music"
 	"github.com/defsub/takeout/podcast"
 	"github.com/defsub/takeout/video"
-	"time"
 )
 
-type syncFunc func(config *config.Config, mediaConfig *config.Config) error
+var (
+	ErrJobNotFound = errors.New("job not found")
+)
 
-func schedule(config *config.Config) {
-	scheduler := gocron.NewScheduler(time.UTC)
+type syncFunc func(ctx context.Context, config *config.Config, mediaConfig *config.Config) error
 
-	mediaSync := func(d time.Duration, doit syncFunc, startImmediately bool) {
-		sched := scheduler.Every(d)
-		if startImmediately {
-			sched = sched.StartImmediately()
-		} else {
-			sched = sched.WaitForSchedule()
+type intervalFunc func(config *config.Config) time.Duration
+
+// Resources are the media databases and indexes updated by jobs. Jobs
+// using the same resource don't run together.
+const (
+	resourceMusic   = "music"
+	resourceVideo   = "video"
+	resourcePodcast = "podcast"
+)
+
+// jobDef describes a named job. Jobs with an interval are scheduled to run
+// periodically unless a cron schedule is configured for the job name in
+// Jobs.Schedules. Jobs without an interval only run on demand or with a cron
+// schedule.
+type jobDef struct {
+	name      string
+	resources []string
+	interval  intervalFunc
+	funcs     []syncFunc
+}
+
+var jobDefs = []jobDef{
+	{"analysis", []string{resourceMusic},
+		func(c *config.Config) time.Duration { return c.Music.AnalysisSyncInterval },
+		[]syncFunc{syncMusicAnalysis}},
+	{"backdrops", nil,
+		func(c *config.Config) time.Duration { return c.Video.BackdropSyncInterval },
+		[]syncFunc{syncVideoBackdrops}},
+	{"covers", nil,
+		func(c *config.Config) time.Duration { return c.Music.CoverSyncInterval },
+		[]syncFunc{syncMusicCovers}},
+	{"fanart", nil,
+		func(c *config.Config) time.Duration { return c.Music.FanArtSyncInterval },
+		[]syncFunc{syncMusicFanArt}},
+	{"lastfm", []string{resourceMusic}, nil,
+		[]syncFunc{syncMusicPopular, syncMusicSimilar}},
+	{"media", []string{resourceMusic, resourceVideo, resourcePodcast}, nil,
+		[]syncFunc{syncMusic, syncVideo, syncPodcasts}},
+	{"music", []string{resourceMusic},
+		func(c *config.Config) time.Duration { return c.Music.SyncInterval },
+		[]syncFunc{syncMusic}},
+	{"popular", []string{resourceMusic},
+		func(c *config.Config) time.Duration { return c.Music.PopularSyncInterval },
+		[]syncFunc{syncMusicPopular}},
+	{"newreleases", []string{resourceMusic},
+		func(c *config.Config) time.Duration { return c.Music.NewReleaseSyncInterval },
+		[]syncFunc{syncMusicNewReleases}},
+	{"podcasts", []string{resourcePodcast},
+		func(c *config.Config) time.Duration { return c.Podcast.SyncInterval },
+		[]syncFunc{syncPodcasts}},
+	{"posters", nil,
+		func(c *config.Config) time.Duration { return c.Video.PosterSyncInterval },
+		[]syncFunc{syncVideoPosters}},
+	{"profiles", nil,
+		func(c *config.Config) time.Duration { return c.Video.ProfileSyncInterval },
+		[]syncFunc{syncVideoProfileImages}},
+	{"similar", []string{resourceMusic},
+		func(c *config.Config) time.Duration { return c.Music.SimilarSyncInterval },
+		[]syncFunc{syncMusicSimilar}},
+	{"video", []string{resourceVideo},
+		func(c *config.Config) time.Duration { return c.Video.SyncInterval },
+		[]syncFunc{syncVideo}},
+}
+
+func findJobDef(name string) (jobDef, error) {
+	for _, def := range jobDefs {
+		if def.name == name {
+			return def, nil
+		}
+	}
+	return jobDef{}, ErrJobNotFound
+}
+
+// jobSchedule returns the cron schedule or interval used for the job, or an
+// empty string if the job isn't scheduled.
+func jobSchedule(config *config.Config, def jobDef) string {
+	if cron, ok := config.Jobs.Schedules[def.name]; ok {
+		return cron
+	}
+	if def.interval != nil {
+		if d := def.interval(config); d > 0 {
+			return d.String()
 		}
-		sched.Do(func() {
-			list, err := assignedMedia(config)
+	}
+	return ""
+}
+
+// jobFunc returns a function that runs the job for each assigned media.
+// Errors for one media are recorded and the remaining media are still synced.
+func jobFunc(config *config.Config, def jobDef) jobs.Func {
+	return func(ctx context.Context) error {
+		list, err := assignedMedia(config)
+		if err != nil {
+			return err
+		}
+		for _, mediaName := range list {
+			mediaConfig, err := mediaConfig(config, mediaName)
 			if err != nil {
-				log.Println(err)
-				return
+				return err
 			}
-			for _, mediaName := range list {
-				mediaConfig, err := mediaConfig(config, mediaName)
-				if err != nil {
+			for _, fn := range def.funcs {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				err = fn(ctx, config, mediaConfig)
+				if err != nil && !errors.Is(err, context.Canceled) {
 					log.Println(err)
-					return
+					job.Error(ctx, err)
 				}
-				doit(config, mediaConfig)
 			}
-		})
+		}
+		return ctx.Err()
 	}
+}
 
-	// music
-	mediaSync(config.Music.SyncInterval, syncMusic, false)
-	mediaSync(config.Music.PopularSyncInterval, syncMusicPopular, false)
-	mediaSync(config.Music.SimilarSyncInterval, syncMusicSimilar, false)
-	mediaSync(config.Music.CoverSyncInterval, syncMusicCovers, false)
-
-	// podcasts
-	mediaSync(config.Podcast.SyncInterval, syncPodcasts, false)
+func schedule(config *config.Config, j *jobs.Jobs) {
+	scheduler := gocron.NewScheduler(time.UTC)
 
-	// video
-	mediaSync(config.Video.SyncInterval, syncVideo, false)
-	mediaSync(config.Video.PosterSyncInterval, syncVideoPosters, false)
-	mediaSync(config.Video.BackdropSyncInterval, syncVideoBackdrops, false)
+	for _, def := range jobDefs {
+		def := def
+		var sched *gocron.Scheduler
+		if cron, ok := config.Jobs.Schedules[def.name]; ok {
+			sched = scheduler.Cron(cron)
+		} else if def.interval != nil && def.interval(config) > 0 {
+			sched = scheduler.Every(def.interval(config)).WaitForSchedule()
+		} else {
+			continue
+		}
+		_, err := sched.Do(func() {
+			err := j.Run(def.name, def.resources, jobFunc(config, def))
+			if err != nil {
+				log.Printf("job %s: %s\n", def.name, err)
+			}
+		})
+		if err != nil {
+			log.Printf("job %s: %s\n", def.name, err)
+		}
+	}
 
 	scheduler.Every(time.Minute * 5).WaitForSchedule().Do(func() {
 		a := auth.NewAuth(config)
@@ -88,6 +197,10 @@ func schedule(config *config.Config) {
 		if err != nil {
 			log.Println(err)
 		}
+		err = a.DeleteExpiredInvites()
+		if err != nil {
+			log.Println(err)
+		}
 	})
 
 	scheduler.StartAsync()
@@ -103,7 +216,7 @@ func assignedMedia(config *config.Config) ([]string, error) {
 	return a.AssignedMedia(), nil
 }
 
-func syncMusic(config *config.Config, mediaConfig *config.Config) error {
+func syncMusic(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	m := music.NewMusic(mediaConfig)
 	err := m.Open()
 	if err != nil {
@@ -112,143 +225,221 @@ func syncMusic(config *config.Config, mediaConfig *config.Config) error {
 	defer m.Close()
 	syncOptions := music.NewSyncOptions()
 	syncOptions.Since = m.LastModified()
-	m.Sync(syncOptions)
-	return nil
+	return m.Sync(ctx, syncOptions)
 }
 
-func syncWithOptions(mediaConfig *config.Config, syncOptions music.SyncOptions) error {
+func syncWithOptions(ctx context.Context, mediaConfig *config.Config, syncOptions music.SyncOptions) error {
 	m := music.NewMusic(mediaConfig)
 	err := m.Open()
 	if err != nil {
 		return err
 	}
 	defer m.Close()
-	m.Sync(syncOptions)
-	return nil
+	return m.Sync(ctx, syncOptions)
 }
 
-func syncMusicPopular(config *config.Config, mediaConfig *config.Config) error {
-	return syncWithOptions(mediaConfig, music.NewSyncPopular())
+func syncMusicPopular(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
+	return syncWithOptions(ctx, mediaConfig, music.NewSyncPopular())
 }
 
-func syncMusicSimilar(config *config.Config, mediaConfig *config.Config) error {
-	return syncWithOptions(mediaConfig, music.NewSyncSimilar())
+func syncMusicSimilar(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
+	return syncWithOptions(ctx, mediaConfig, music.NewSyncSimilar())
 }
 
-func syncMusicCovers(config *config.Config, mediaConfig *config.Config) error {
+func syncMusicCovers(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	m := music.NewMusic(mediaConfig)
 	err := m.Open()
 	if err != nil {
 		return err
 	}
 	defer m.Close()
-	m.SyncCovers(config.Server.ImageClient)
-	return nil
+	return m.SyncCovers(ctx, config.Server.ImageClient)
 }
 
-func syncMusicFanArt(config *config.Config, mediaConfig *config.Config) error {
+func syncMusicAnalysis(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	m := music.NewMusic(mediaConfig)
 	err := m.Open()
 	if err != nil {
 		return err
 	}
 	defer m.Close()
-	m.SyncFanArt(config.Server.ImageClient)
-	return nil
+	return m.SyncAnalysis(ctx)
 }
 
-func syncVideo(config *config.Config, mediaConfig *config.Config) error {
+func syncMusicNewReleases(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
+	m := music.NewMusic(mediaConfig)
+	err := m.Open()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.SyncNewReleases(ctx)
+}
+
+func syncMusicFanArt(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
+	m := music.NewMusic(mediaConfig)
+	err := m.Open()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.SyncFanArt(ctx, config.Server.ImageClient)
+}
+
+func syncVideo(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	v := video.NewVideo(mediaConfig)
 	err := v.Open()
 	if err != nil {
 		return err
 	}
 	defer v.Close()
-	return v.SyncSince(v.LastModified())
+	return v.SyncSince(ctx, v.LastModified())
 }
 
-func syncVideoPosters(config *config.Config, mediaConfig *config.Config) error {
+func syncVideoPosters(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	v := video.NewVideo(mediaConfig)
 	err := v.Open()
 	if err != nil {
 		return err
 	}
 	defer v.Close()
-	v.SyncPosters(config.Server.ImageClient)
-	return nil
+	return v.SyncPosters(ctx, config.Server.ImageClient)
 }
 
-func syncVideoBackdrops(config *config.Config, mediaConfig *config.Config) error {
+func syncVideoBackdrops(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	v := video.NewVideo(mediaConfig)
 	err := v.Open()
 	if err != nil {
 		return err
 	}
 	defer v.Close()
-	v.SyncBackdrops(config.Server.ImageClient)
-	return nil
+	return v.SyncBackdrops(ctx, config.Server.ImageClient)
 }
 
-func syncVideoProfileImages(config *config.Config, mediaConfig *config.Config) error {
+func syncVideoProfileImages(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	v := video.NewVideo(mediaConfig)
 	err := v.Open()
 	if err != nil {
 		return err
 	}
 	defer v.Close()
-	v.SyncProfileImages(config.Server.ImageClient)
-	return nil
+	return v.SyncProfileImages(ctx, config.Server.ImageClient)
 }
 
-func syncPodcasts(config *config.Config, mediaConfig *config.Config) error {
+func syncPodcasts(ctx context.Context, config *config.Config, mediaConfig *config.Config) error {
 	p := podcast.NewPodcast(mediaConfig)
 	err := p.Open()
 	if err != nil {
 		return err
 	}
 	defer p.Close()
-	return p.Sync()
+	return p.Sync(ctx)
 }
 
+// Job runs the named job for all assigned media and records the run in the
+// job history.
 func Job(config *config.Config, name string) error {
-	list, err := assignedMedia(config)
+	def, err := findJobDef(name)
 	if err != nil {
 		return err
 	}
-	for _, mediaName := range list {
-		mediaConfig, err := mediaConfig(config, mediaName)
-		if err != nil {
-			return err
+	j, err := makeJobs(config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	return j.Run(name, def.resources, jobFunc(config, def))
+}
+
+func makeJobs(config *config.Config) (*jobs.Jobs, error) {
+	j := jobs.NewJobs(config)
+	err := j.Open()
+	return j, err
+}
+
+type jobStatus struct {
+	Name     string
+	Schedule string `json:",omitempty"`
+	Running  bool
+	Run      *jobs.Run  `json:",omitempty"`
+	History  []jobs.Run `json:",omitempty"`
+}
+
+func jobStatusFor(ctx Context, def jobDef) jobStatus {
+	return jobStatus{
+		Name:     def.name,
+		Schedule: jobSchedule(ctx.Config(), def),
+		Running:  ctx.Jobs().Running(def.name),
+		Run:      ctx.Jobs().Current(def.name),
+	}
+}
+
+// apiJobsGet lists all jobs with the current or last run.
+func apiJobsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	var list []jobStatus
+	for _, def := range jobDefs {
+		list = append(list, jobStatusFor(ctx, def))
+	}
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(list)
+}
+
+// apiJobGet shows the job status along with recent run history.
+func apiJobGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	def, err := findJobDef(r.URL.Query().Get(ParamName))
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	status := jobStatusFor(ctx, def)
+	status.History = ctx.Jobs().History(def.name)
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(status)
+}
+
+// apiJobPost starts the job in the background.
+func apiJobPost(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	def, err := findJobDef(r.URL.Query().Get(ParamName))
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	err = ctx.Jobs().Start(def.name, def.resources, jobFunc(ctx.Config(), def))
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobRunning) || errors.Is(err, jobs.ErrJobConflict) {
+			handleErr(w, err.Error(), http.StatusConflict)
+		} else {
+			serverErr(w, err)
 		}
-		switch name {
-		case "backdrops":
-			syncVideoBackdrops(config, mediaConfig)
-		case "covers":
-			syncMusicCovers(config, mediaConfig)
-		case "fanart":
-			syncMusicFanArt(config, mediaConfig)
-		case "lastfm":
-			syncMusicPopular(config, mediaConfig)
-			syncMusicSimilar(config, mediaConfig)
-		case "media":
-			syncMusic(config, mediaConfig)
-			syncVideo(config, mediaConfig)
-			syncPodcasts(config, mediaConfig)
-		case "music":
-			syncMusic(config, mediaConfig)
-		case "popular":
-			syncMusicPopular(config, mediaConfig)
-		case "podcasts":
-			syncPodcasts(config, mediaConfig)
-		case "posters":
-			syncVideoPosters(config, mediaConfig)
-		case "profiles":
-			syncVideoProfileImages(config, mediaConfig)
-		case "similar":
-			syncMusicSimilar(config, mediaConfig)
-		case "video":
-			syncVideo(config, mediaConfig)
+		return
+	}
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(jobStatusFor(ctx, def))
+}
+
+// apiJobDelete cancels the running job.
+func apiJobDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	def, err := findJobDef(r.URL.Query().Get(ParamName))
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	err = ctx.Jobs().Cancel(def.name)
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotRunning) {
+			handleErr(w, err.Error(), http.StatusConflict)
+		} else {
+			serverErr(w, err)
 		}
+		return
 	}
-	return nil
+	w.WriteHeader(http.StatusAccepted)
 }
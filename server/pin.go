@@ -0,0 +1,103 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/defsub/takeout/lib/str"
+	"github.com/defsub/takeout/music"
+)
+
+type pinRequest struct {
+	Path string // bucket folder, such as Artist/Release (1999)
+	REID string
+	RGID string
+}
+
+// apiPinsGet lists all release pins.
+func apiPinsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(ctx.Music().Pins())
+}
+
+// apiPinPost pins a bucket folder to a release or release group and starts
+// a job to resync the folder.
+func apiPinPost(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+
+	var req pinRequest
+	body, _ := ioutil.ReadAll(r.Body)
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	pin, err := ctx.Music().PinFolder(req.Path, req.REID, req.RGID)
+	if err == music.ErrInvalidPin || err == music.ErrNoTracks {
+		badRequest(w, err)
+		return
+	} else if err != nil {
+		serverErr(w, err)
+		return
+	}
+
+	if !startPinJob(w, ctx, *pin) {
+		return
+	}
+
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(pin)
+}
+
+// apiPinDelete removes a pin.
+func apiPinDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	id := str.Atoi(r.URL.Query().Get(ParamID))
+	err := ctx.Music().Unpin(id)
+	if err == music.ErrPinNotFound {
+		notFoundErr(w)
+		return
+	} else if err != nil {
+		serverErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiPinChoicesGet lists candidate releases for a bucket folder.
+// /api/admin/pins/choices?path={path}
+func apiPinChoicesGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	path := r.URL.Query().Get("path")
+	releases, err := ctx.Music().ReleaseChoices(path)
+	if err != nil {
+		notFoundErr(w)
+		return
+	}
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(releases)
+}
@@ -26,6 +26,7 @@ Takeout.music = (function() {
     let playing = false;
     let userPlay = false;
     let current = {};
+    let lyrics = null;
     let audioCtx = null;
 
     const clearTracks = function() {
@@ -130,6 +131,7 @@ Takeout.music = (function() {
 	    audioSource().setAttribute("src", track['location']);
 	    updateTitle(track);
 	    current = track;
+	    loadLyrics(track);
 	    audioTag().load();
 	    if (audioCtx.state === "suspended") {
 		audioCtx.resume().then(function() {
@@ -251,6 +253,46 @@ Takeout.music = (function() {
 	return mins + ":" + secs;
     };
 
+    const loadLyrics = async function(track) {
+	lyrics = null;
+	updateLyrics("");
+	const location = track['location'];
+	if (location == null || !location.match(/^\/api\/tracks\/[^\/]+\/location$/)) {
+	    return;
+	}
+	const response = await fetch(location.replace(/\/location$/, "/lyrics"), {
+	    credentials: "same-origin"
+	}).catch(error => null);
+	if (response == null || !response.ok) {
+	    return;
+	}
+	const data = await response.json();
+	if (current === track && data["Synced"]) {
+	    lyrics = data["Lines"] || [];
+	}
+    };
+
+    const updateLyrics = function(text) {
+	document.getElementsByName("np-lyrics").forEach(e => {
+	    e.textContent = text;
+	});
+    };
+
+    const lyricsProgress = function(time) {
+	if (lyrics == null) {
+	    return;
+	}
+	const ms = time * 1000;
+	let text = "";
+	for (const line of lyrics) {
+	    if (line["Time"] > ms) {
+		break;
+	    }
+	    text = line["Text"];
+	}
+	updateLyrics(text);
+    };
+
     const audioProgress = function() {
 	const audio = audioTag();
 	//document.getElementById("np-time").innerHTML = formatTime(audio.currentTime);
@@ -259,6 +301,7 @@ Takeout.music = (function() {
 	let p = (audio.currentTime / audio.duration);
 	//document.getElementById("np-progress").setAttribute("value", p);
 	document.getElementById("progress").style.width = p*100 + "%";
+	lyricsProgress(audio.currentTime);
     };
 
     const audioEnded = function() {
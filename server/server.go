@@ -28,6 +28,7 @@ import (
 	"github.com/defsub/takeout/lib/client"
 	"github.com/defsub/takeout/lib/hub"
 	"github.com/defsub/takeout/lib/log"
+	"github.com/defsub/takeout/music"
 	"github.com/defsub/takeout/progress"
 )
 
@@ -162,18 +163,23 @@ func Serve(config *config.Config) error {
 	progress, err := makeProgress(config)
 	log.CheckError(err)
 
+	jobs, err := makeJobs(config)
+	log.CheckError(err)
+
 	hub, err := makeHub(config)
 	log.CheckError(err)
 
-	schedule(config)
+	schedule(config, jobs)
 
 	// base context for all requests
 	ctx := RequestContext{
 		activity: activity,
 		auth:     auth,
 		config:   config,
+		jobs:     jobs,
 		progress: progress,
 		template: getTemplates(config),
+		proxies:  parseTrustedProxies(config.Auth.Proxy.TrustedProxies),
 	}
 
 	resFileServer := http.FileServer(mountResFS(resStatic))
@@ -199,10 +205,31 @@ func Serve(config *config.Config) error {
 	mux.Get("/api/code", requestHandler(ctx, apiCodeGet))
 	mux.Post("/api/code", codeTokenAuthHandler(ctx, apiCodeCheck))
 
+	// invites
+	mux.Get("/invite/:code", requestHandler(ctx, inviteHandler))
+	mux.Post("/invite/:code", requestHandler(ctx, inviteAcceptHandler))
+	mux.Post("/api/invite/:code", requestHandler(ctx, apiInviteAccept))
+
+	// admin
+	mux.Get("/api/admin/invites", adminAuthHandler(ctx, apiInvitesGet))
+	mux.Post("/api/admin/invites", adminAuthHandler(ctx, apiInvitePost))
+	mux.Del("/api/admin/invites/:code", adminAuthHandler(ctx, apiInviteDelete))
+	mux.Get("/api/admin/jobs", adminAuthHandler(ctx, apiJobsGet))
+	mux.Get("/api/admin/jobs/:name", adminAuthHandler(ctx, apiJobGet))
+	mux.Post("/api/admin/jobs/:name", adminAuthHandler(ctx, apiJobPost))
+	mux.Del("/api/admin/jobs/:name", adminAuthHandler(ctx, apiJobDelete))
+	mux.Get("/api/admin/pins", adminAuthHandler(ctx, apiPinsGet))
+	mux.Post("/api/admin/pins", adminAuthHandler(ctx, apiPinPost))
+	mux.Get("/api/admin/pins/choices", adminAuthHandler(ctx, apiPinChoicesGet))
+	mux.Del("/api/admin/pins/:id", adminAuthHandler(ctx, apiPinDelete))
+	mux.Get("/api/admin/unmatched", adminAuthHandler(ctx, apiUnmatchedGet))
+	mux.Post("/api/admin/unmatched", adminAuthHandler(ctx, apiUnmatchedPost))
+
 	// misc
 	mux.Get("/api/home", accessTokenAuthHandler(ctx, apiHome))
 	mux.Get("/api/index", accessTokenAuthHandler(ctx, apiIndex))
 	mux.Get("/api/search", accessTokenAuthHandler(ctx, apiSearch))
+	mux.Get("/api/suggest", accessTokenAuthHandler(ctx, apiSuggest))
 
 	// playlist
 	mux.Get("/api/playlist", accessTokenAuthHandler(ctx, apiPlaylistGet))
@@ -221,9 +248,29 @@ func Serve(config *config.Config) error {
 	mux.Get("/api/radio/stations/:id", accessTokenAuthHandler(ctx, apiRadioStationGetPlaylist))
 	mux.Get("/api/radio/stations/:id/playlist", accessTokenAuthHandler(ctx, apiRadioStationGetPlaylist))
 	mux.Get("/api/radio/stations/:id/playlist.xspf", accessTokenAuthHandler(ctx, apiRadioStationGetPlaylist))
+	mux.Get("/api/wantlist", accessTokenAuthHandler(ctx, apiWantList))
+	mux.Get("/api/wantlist.csv", accessTokenAuthHandler(ctx, apiWantList))
+	mux.Get("/api/wantlist.md", accessTokenAuthHandler(ctx, apiWantList))
+	mux.Get("/api/releases/upcoming", accessTokenAuthHandler(ctx, apiNewReleases))
+	mux.Get("/api/releases/upcoming.atom", feedAuthHandler(ctx, apiNewReleasesFeed))
 	mux.Get("/api/releases/:id", accessTokenAuthHandler(ctx, apiReleaseGet))
 	mux.Get("/api/releases/:id/playlist", accessTokenAuthHandler(ctx, apiReleaseGetPlaylist))
 	mux.Get("/api/releases/:id/playlist.xspf", accessTokenAuthHandler(ctx, apiReleaseGetPlaylist))
+	mux.Get("/api/tracks/:id", accessTokenAuthHandler(ctx, apiTrackGet))
+	mux.Get("/api/credits/:id", accessTokenAuthHandler(ctx, apiCreditsGet))
+	mux.Get("/api/composers", accessTokenAuthHandler(ctx, apiComposers))
+	mux.Get("/api/composers/:id", accessTokenAuthHandler(ctx, apiComposerGet))
+	mux.Get("/api/works/:id", accessTokenAuthHandler(ctx, apiWorkGet))
+	mux.Get("/api/works/:id/playlist", accessTokenAuthHandler(ctx, apiWorkGetPlaylist))
+	mux.Get("/api/works/:id/playlist.xspf", accessTokenAuthHandler(ctx, apiWorkGetPlaylist))
+	mux.Get("/api/decades", accessTokenAuthHandler(ctx, apiCatalog(music.CatalogDecades)))
+	mux.Get("/api/decades/:name", accessTokenAuthHandler(ctx, apiCatalogGet(music.CatalogDecades)))
+	mux.Get("/api/genres", accessTokenAuthHandler(ctx, apiCatalog(music.CatalogGenres)))
+	mux.Get("/api/genres/:name", accessTokenAuthHandler(ctx, apiCatalogGet(music.CatalogGenres)))
+	mux.Get("/api/labels", accessTokenAuthHandler(ctx, apiCatalog(music.CatalogLabels)))
+	mux.Get("/api/labels/:name", accessTokenAuthHandler(ctx, apiCatalogGet(music.CatalogLabels)))
+	mux.Get("/api/music/series", accessTokenAuthHandler(ctx, apiCatalog(music.CatalogSeries)))
+	mux.Get("/api/music/series/:name", accessTokenAuthHandler(ctx, apiCatalogGet(music.CatalogSeries)))
 
 	// video
 	mux.Get("/api/movies", accessTokenAuthHandler(ctx, apiMovies))
@@ -247,6 +294,9 @@ func Serve(config *config.Config) error {
 
 	// location
 	mux.Get("/api/tracks/:uuid/location", mediaTokenAuthHandler(ctx, apiTrackLocation))
+	mux.Get("/api/tracks/:uuid/lyrics", accessTokenAuthHandler(ctx, apiTrackLyrics))
+	mux.Get("/api/tracks/:uuid/lyrics.txt", accessTokenAuthHandler(ctx, apiTrackLyrics))
+	mux.Get("/api/tracks/:uuid/lyrics.lrc", accessTokenAuthHandler(ctx, apiTrackLyrics))
 	mux.Get("/api/movies/:uuid/location", mediaTokenAuthHandler(ctx, apiMovieLocation))
 	mux.Get("/api/episodes/:id/location", mediaTokenAuthHandler(ctx, apiEpisodeLocation))
 
@@ -280,6 +330,8 @@ func Serve(config *config.Config) error {
 	mux.Get("/img/tm/:size/:path", imageHandler(ctx, imgVideo, client))
 	mux.Get("/img/fa/:arid/t/:path", imageHandler(ctx, imgArtistThumb, client))
 	mux.Get("/img/fa/:arid/b/:path", imageHandler(ctx, imgArtistBackground, client))
+	mux.Get("/img/local/re/:reid", mediaTokenAuthHandler(ctx, imgLocalRelease))
+	mux.Get("/img/local/ar/:arid", mediaTokenAuthHandler(ctx, imgLocalArtist))
 
 	// pprof
 	// mux.Get("/debug/pprof", http.HandlerFunc(pprof.Index))
@@ -28,9 +28,11 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/defsub/takeout/config"
 	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/search"
 	"github.com/defsub/takeout/music"
 	"github.com/defsub/takeout/podcast"
 	"github.com/defsub/takeout/video"
@@ -83,6 +85,9 @@ func doFuncMap() template.FuncMap {
 	return template.FuncMap{
 		"join": strings.Join,
 		"ymd":  date.YMD,
+		"duration": func(ms int) string {
+			return date.FormatDuration(time.Duration(ms) * time.Millisecond)
+		},
 		"unescapeHTML": func(s string) template.HTML {
 			return template.HTML(s)
 		},
@@ -93,6 +98,10 @@ func doFuncMap() template.FuncMap {
 				link = fmt.Sprintf("/v?release=%d", o.(music.Release).ID)
 			case music.Artist:
 				link = fmt.Sprintf("/v?artist=%d", o.(music.Artist).ID)
+			case music.Composer:
+				link = fmt.Sprintf("/v?composer=%s", url.QueryEscape(o.(music.Composer).ComposerID))
+			case music.Work:
+				link = fmt.Sprintf("/v?work=%s", url.QueryEscape(o.(music.Work).WorkID))
 			case music.Track:
 				link = locateTrack(o.(music.Track))
 			case video.Movie:
@@ -195,6 +204,8 @@ func doFuncMap() template.FuncMap {
 				ref = fmt.Sprintf("/music/artists/%d/%s", o.(music.Artist).ID, args[0])
 			case music.Track:
 				ref = fmt.Sprintf("/music/tracks/%d", o.(music.Track).ID)
+			case music.Work:
+				ref = fmt.Sprintf("/music/works/%s/releases/%s", o.(music.Work).WorkID, args[0])
 			case string:
 				ref = fmt.Sprintf("/music/search?q=%s", url.QueryEscape(o.(string)))
 			case music.Station:
@@ -205,6 +216,21 @@ func doFuncMap() template.FuncMap {
 		"home": func() string {
 			return "/v?home=1"
 		},
+		"credited": func(c music.Credit) string {
+			return fmt.Sprintf("/v?credits=%s", url.QueryEscape(c.ARID))
+		},
+		"refine": func(q string, t search.FacetTerm) string {
+			return fmt.Sprintf("/v?q=%s", url.QueryEscape(q+" "+t.Query))
+		},
+		"more": func(v *view.Search) string {
+			// link to the next page, if any
+			if !v.More() {
+				return ""
+			}
+			return fmt.Sprintf("/v?q=%s&track_offset=%d&movie_offset=%d&sort=%s",
+				url.QueryEscape(v.Query), v.TrackNext, v.MovieNext,
+				url.QueryEscape(v.Sort))
+		},
 		"runtime": func(m video.Movie) string {
 			hours := m.Runtime / 60
 			mins := m.Runtime % 60
@@ -253,6 +279,22 @@ func viewHandler(w http.ResponseWriter, r *http.Request) {
 		artist, _ := m.LookupArtist(id)
 		result = view.SinglesView(ctx, artist)
 		temp = "singles.html"
+	} else if v := r.URL.Query().Get("credits"); v != "" {
+		// /v?credits={arid}
+		result = view.CreditsView(ctx, v)
+		temp = "credits.html"
+	} else if v := r.URL.Query().Get("composers"); v != "" {
+		// /v?composers=x
+		result = view.ComposersView(ctx)
+		temp = "composers.html"
+	} else if v := r.URL.Query().Get("composer"); v != "" {
+		// /v?composer={composer-id}
+		result = view.ComposerView(ctx, v)
+		temp = "composer.html"
+	} else if v := r.URL.Query().Get("work"); v != "" {
+		// /v?work={work-id}[&reid={reid}]
+		result = view.WorkView(ctx, v, r.URL.Query().Get("reid"))
+		temp = "work.html"
 	} else if v := r.URL.Query().Get("want"); v != "" {
 		// /v?want={artist-id}
 		m := ctx.Music()
@@ -265,8 +307,13 @@ func viewHandler(w http.ResponseWriter, r *http.Request) {
 		result = view.HomeView(ctx)
 		temp = "home.html"
 	} else if v := r.URL.Query().Get("q"); v != "" {
-		// /v?q={pattern}
-		result = view.SearchView(ctx, strings.TrimSpace(v))
+		// /v?q={pattern}[&track_offset={offset}][&movie_offset={offset}][&sort={sort}]
+		page, err := searchPageParams(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		result = view.SearchView(ctx, strings.TrimSpace(v), page)
 		temp = "search.html"
 	} else if v := r.URL.Query().Get("radio"); v != "" {
 		// /v?radio=x
@@ -0,0 +1,121 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/defsub/takeout/jobs"
+	"github.com/defsub/takeout/music"
+)
+
+// matchJob is the job name used to resync a bucket folder after it's
+// matched to a release.
+const matchJob = "match"
+
+type matchRequest struct {
+	Path string // bucket folder, such as Artist/Release (1999)
+	REID string
+}
+
+// apiUnmatchedGet lists unmatched tracks grouped by bucket folder, with the
+// reason matching failed and candidate releases.
+// /api/admin/unmatched?path={path}
+func apiUnmatchedGet(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+	var result interface{}
+	if path := r.URL.Query().Get("path"); path != "" {
+		folder, err := ctx.Music().UnmatchedFolder(path)
+		if err != nil {
+			notFoundErr(w)
+			return
+		}
+		result = folder
+	} else {
+		result = ctx.Music().UnmatchedFolders()
+	}
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	enc := json.NewEncoder(w)
+	enc.Encode(result)
+}
+
+// apiUnmatchedPost pins a release for the tracks in a bucket folder and
+// starts a job to resync the folder.
+func apiUnmatchedPost(w http.ResponseWriter, r *http.Request) {
+	ctx := contextValue(r)
+
+	var req matchRequest
+	body, _ := ioutil.ReadAll(r.Body)
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	pin, err := ctx.Music().PinFolder(req.Path, req.REID, "")
+	if err == music.ErrInvalidPin || err == music.ErrNoTracks {
+		badRequest(w, err)
+		return
+	} else if err != nil {
+		serverErr(w, err)
+		return
+	}
+
+	if !startPinJob(w, ctx, *pin) {
+		return
+	}
+
+	w.Header().Set(HeaderContentType, ApplicationJson)
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(jobStatus{
+		Name:    matchJob,
+		Running: ctx.Jobs().Running(matchJob),
+		Run:     ctx.Jobs().Current(matchJob),
+	})
+}
+
+// startPinJob starts a job to resync the pinned bucket folder, writing an
+// error response when the job can't start. The pin is kept and applied by
+// the next music sync if the job can't start now.
+func startPinJob(w http.ResponseWriter, ctx Context, pin music.Pin) bool {
+	config := ctx.Config()
+	err := ctx.Jobs().Start(matchJob, []string{resourceMusic}, func(jctx context.Context) error {
+		m := music.NewMusic(config)
+		err := m.Open()
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		_, err = m.SyncPin(jctx, pin)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobRunning) || errors.Is(err, jobs.ErrJobConflict) {
+			handleErr(w, err.Error(), http.StatusConflict)
+		} else {
+			serverErr(w, err)
+		}
+		return false
+	}
+	return true
+}
@@ -46,7 +46,8 @@ func (v *Video) openDB() (err error) {
 		return
 	}
 
-	v.db.AutoMigrate(&Cast{}, &Collection{}, &Crew{}, &Genre{}, &Keyword{}, &Movie{}, &Person{})
+	v.db.AutoMigrate(&Cast{}, &Collection{}, &Crew{}, &Episode{}, &Genre{}, &Keyword{},
+		&Movie{}, &Person{}, &TVShow{})
 	return
 }
 
@@ -72,9 +73,14 @@ func (v *Video) Genre(name string) []Movie {
 }
 
 func (v *Video) Genres(m Movie) []string {
+	return v.genres(m.TMID)
+}
+
+// genres returns genre names for a movie or tv show.
+func (v *Video) genres(tmid int64) []string {
 	var genres []Genre
 	var list []string
-	v.db.Where("tm_id = ?", m.TMID).Order("name").Find(&genres)
+	v.db.Where("tm_id = ?", tmid).Order("name").Find(&genres)
 	for _, g := range genres {
 		list = append(list, g.Name)
 	}
@@ -89,9 +95,14 @@ func (v *Video) Keyword(name string) []Movie {
 }
 
 func (v *Video) Keywords(m Movie) []string {
+	return v.keywords(m.TMID)
+}
+
+// keywords returns keyword names for a movie or tv show.
+func (v *Video) keywords(tmid int64) []string {
 	var keywords []Keyword
 	var list []string
-	v.db.Where("tm_id = ?", m.TMID).Order("name").Find(&keywords)
+	v.db.Where("tm_id = ?", tmid).Order("name").Find(&keywords)
 	for _, g := range keywords {
 		list = append(list, g.Name)
 	}
@@ -121,14 +132,16 @@ func (v *Video) CollectionMovies(c *Collection) []Movie {
 }
 
 func (v *Video) Cast(m Movie) []Cast {
+	return v.cast(m.TMID)
+}
+
+// cast returns cast credits for a movie or tv show.
+func (v *Video) cast(tmid int64) []Cast {
 	var cast []Cast
 	var people []Person
-	v.db.Order("rank asc").
-		Joins(`inner join movies on "cast".tm_id = movies.tm_id`).
-		Where("movies.tm_id = ?", m.TMID).Find(&cast)
+	v.db.Order("rank asc").Where("tm_id = ?", tmid).Find(&cast)
 	v.db.Joins(`inner join "cast" on people.pe_id = "cast".pe_id`).
-		Joins(`inner join movies on movies.tm_id = "cast".tm_id`).
-		Where("movies.tm_id = ?", m.TMID).Find(&people)
+		Where(`"cast".tm_id = ?`, tmid).Find(&people)
 	pmap := make(map[int64]Person)
 	for _, p := range people {
 		pmap[p.PEID] = p
@@ -140,13 +153,16 @@ func (v *Video) Cast(m Movie) []Cast {
 }
 
 func (v *Video) Crew(m Movie) []Crew {
+	return v.crew(m.TMID)
+}
+
+// crew returns crew credits for a movie or tv show.
+func (v *Video) crew(tmid int64) []Crew {
 	var crew []Crew
 	var people []Person
-	v.db.Joins(`inner join movies on "crew".tm_id = movies.tm_id`).
-		Where("movies.tm_id = ?", m.TMID).Find(&crew)
+	v.db.Where("tm_id = ?", tmid).Find(&crew)
 	v.db.Joins(`inner join "crew" on people.pe_id = "crew".pe_id`).
-		Joins(`inner join movies on movies.tm_id = "crew".tm_id`).
-		Where("movies.tm_id = ?", m.TMID).Find(&people)
+		Where(`"crew".tm_id = ?`, tmid).Find(&people)
 	pmap := make(map[int64]Person)
 	for _, p := range people {
 		pmap[p.PEID] = p
@@ -157,6 +173,27 @@ func (v *Video) Crew(m Movie) []Crew {
 	return crew
 }
 
+func (v *Video) tvShow(tvid int64) (*TVShow, error) {
+	var tv TVShow
+	err := v.db.Where("tv_id = ?", tvid).First(&tv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tv, nil
+}
+
+func (v *Video) episodes() []Episode {
+	var episodes []Episode
+	v.db.Order("tv_id, season, episode").Find(&episodes)
+	return episodes
+}
+
+func (v *Video) episodesFor(keys []string) []Episode {
+	var episodes []Episode
+	v.db.Where("key in (?)", keys).Find(&episodes)
+	return episodes
+}
+
 func (v *Video) deleteMovie(tmid int) {
 	var list []Movie
 	v.db.Where("tm_id = ?", tmid).Find(&list)
@@ -295,6 +332,12 @@ func (v *Video) lookupIMIDs(imids []string) []Movie {
 	return movies
 }
 
+func (v *Video) people() []Person {
+	var people []Person
+	v.db.Order("name").Find(&people)
+	return people
+}
+
 func (v *Video) LookupPerson(id int) (Person, error) {
 	var person Person
 	err := v.db.First(&person, id).Error
@@ -0,0 +1,144 @@
+// Copyright (C) 2022 The Takeout Authors.
+//
+// This file is part of Takeout.
+//
+// Takeout is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// Takeout is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Takeout.  If not, see <https://www.gnu.org/licenses/>.
+
+package video
+
+import (
+	"context"
+
+	"github.com/defsub/takeout/lib/job"
+	"github.com/defsub/takeout/lib/search"
+)
+
+// movieFields returns the index fields for a movie using only what's stored
+// in the database.
+func (v *Video) movieFields(m Movie) search.FieldMap {
+	fields := make(search.FieldMap)
+	search.AddField(fields, FieldBudget, m.Budget)
+	search.AddField(fields, FieldDate, m.Date)
+	search.AddField(fields, FieldRating, m.Rating)
+	search.AddField(fields, FieldRevenue, m.Revenue)
+	search.AddField(fields, FieldRuntime, m.Runtime)
+	search.AddField(fields, FieldTitle, m.Title)
+	search.AddField(fields, FieldSortTitle, search.SortTitleKey(m.Title))
+	search.AddField(fields, FieldTagline, m.Tagline)
+	search.AddField(fields, FieldVote, int(m.VoteAverage*10))
+	search.AddField(fields, FieldVoteCount, m.VoteCount)
+	if c := v.MovieCollection(m); c != nil {
+		search.AddField(fields, FieldCollection, c.Name)
+	}
+	v.creditFields(fields, m.TMID)
+	return fields
+}
+
+// episodeFields returns the index fields for a tv episode using the tv show
+// stored in the database.
+func (v *Video) episodeFields(e Episode) search.FieldMap {
+	fields := make(search.FieldMap)
+	tv, err := v.tvShow(e.TVID)
+	if err != nil {
+		return fields
+	}
+	search.AddField(fields, FieldDate, tv.Date)
+	search.AddField(fields, FieldName, tv.Name)
+	search.AddField(fields, FieldTagline, tv.Tagline)
+	search.AddField(fields, FieldVote, int(tv.VoteAverage*10))
+	search.AddField(fields, FieldVoteCount, tv.VoteCount)
+	v.creditFields(fields, tv.TVID)
+	return fields
+}
+
+// creditFields adds genre, keyword, cast and crew fields for a movie or tv
+// show.
+func (v *Video) creditFields(fields search.FieldMap, tmid int64) {
+	for _, g := range v.genres(tmid) {
+		search.AddField(fields, FieldGenre, g)
+	}
+	for _, k := range v.keywords(tmid) {
+		search.AddField(fields, FieldKeyword, k)
+	}
+	for _, c := range v.cast(tmid) {
+		search.AddField(fields, FieldCast, c.Person.Name)
+		search.AddField(fields, FieldCharacter, c.Character)
+	}
+	for _, c := range v.crew(tmid) {
+		search.AddField(fields, FieldCrew, c.Person.Name)
+		search.AddField(fields, c.Department, c.Person.Name)
+		search.AddField(fields, c.Job, c.Person.Name)
+	}
+}
+
+// RebuildIndex replaces the search and suggest indexes using the movies and
+// tv episodes in the database. Nothing is requested from TMDB.
+func (v *Video) RebuildIndex(ctx context.Context) error {
+	s, err := v.newSearch()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.Reset("video")
+	if err != nil {
+		return err
+	}
+
+	movies := v.Movies()
+	episodes := v.episodes()
+	job.AddTotal(ctx, len(movies)+len(episodes))
+	for _, m := range movies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		index := make(search.IndexMap)
+		index[m.Key] = v.movieFields(m)
+		s.Index(index)
+		job.Step(ctx)
+	}
+	for _, e := range episodes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		index := make(search.IndexMap)
+		index[e.Key] = v.episodeFields(e)
+		s.Index(index)
+		job.Step(ctx)
+	}
+	err = s.Indexed()
+	if err != nil {
+		return err
+	}
+	return v.syncSuggest()
+}
+
+// VerifyIndex reports index documents which no longer match movies or tv
+// episodes.
+func (v *Video) VerifyIndex() (*search.Report, error) {
+	s, err := v.newSearch()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.Verify(func(keys []string) []string {
+		var found []string
+		for _, m := range v.moviesFor(keys) {
+			found = append(found, m.Key)
+		}
+		for _, e := range v.episodesFor(keys) {
+			found = append(found, e.Key)
+		}
+		return found
+	})
+}
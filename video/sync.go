@@ -18,17 +18,22 @@
 package video
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/defsub/takeout/config"
 	"github.com/defsub/takeout/lib/bucket"
 	"github.com/defsub/takeout/lib/client"
 	"github.com/defsub/takeout/lib/date"
+	"github.com/defsub/takeout/lib/job"
 	"github.com/defsub/takeout/lib/log"
+	"github.com/defsub/takeout/lib/pool"
 	"github.com/defsub/takeout/lib/search"
 	"github.com/defsub/takeout/lib/str"
 	"github.com/defsub/takeout/lib/tmdb"
@@ -47,6 +52,7 @@ const (
 	FieldRating     = "rating"
 	FieldRevenue    = "revenue"
 	FieldRuntime    = "runtime"
+	FieldSortTitle  = "sort_title"
 	FieldTagline    = "tagline"
 	FieldTitle      = "title"
 	FieldVote       = "vote"
@@ -58,18 +64,60 @@ const (
 	JobStory      = "Story"
 )
 
-func (v *Video) Sync() error {
-	return v.SyncSince(time.Time{})
+func (v *Video) Sync(ctx context.Context) error {
+	return v.SyncSince(ctx, time.Time{})
 }
 
-func (v *Video) SyncSince(lastSync time.Time) error {
+func (v *Video) SyncSince(ctx context.Context, lastSync time.Time) error {
 	for _, bucket := range v.buckets {
-		err := v.syncBucket(bucket, lastSync)
+		err := v.syncBucket(ctx, bucket, lastSync)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if v.indexStale() {
+		// mapping changed so index everything from the database
+		log.Printf("sync stale index\n")
+		return v.RebuildIndex(ctx)
+	}
+	return v.syncSuggest()
+}
+
+// indexStale is true when the search index needs to be rebuilt.
+func (v *Video) indexStale() bool {
+	s, err := v.newSearch()
+	if err != nil {
+		return false
+	}
+	defer s.Close()
+	return s.Stale()
+}
+
+// syncSuggest rebuilds the suggest index since movies are recreated with new
+// IDs during sync.
+func (v *Video) syncSuggest() error {
+	s, err := v.newSuggest()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.Reset("video_suggest")
+	if err != nil {
+		return err
+	}
+	var list []search.Suggestion
+	for _, m := range v.Movies() {
+		list = append(list, search.Suggestion{
+			Type: SuggestMovie, ID: strconv.Itoa(int(m.ID)), Name: m.Title})
+	}
+	for _, p := range v.people() {
+		list = append(list, search.Suggestion{
+			Type: SuggestPerson, ID: strconv.Itoa(int(p.ID)), Name: p.Name})
+	}
+	return s.AddAll(list)
 }
 
 var (
@@ -87,7 +135,7 @@ var (
 	//tvRegexp = regexp.MustCompile(`.*/(.+?)\s*\(([\d]+)\)(\s-\s(.+))?\.(mkv|mp4)$`)
 )
 
-func (v *Video) syncBucket(bucket bucket.Bucket, lastSync time.Time) error {
+func (v *Video) syncBucket(ctx context.Context, bucket bucket.Bucket, lastSync time.Time) error {
 	objectCh, err := bucket.List(lastSync)
 	if err != nil {
 		return err
@@ -101,45 +149,65 @@ func (v *Video) syncBucket(bucket bucket.Bucket, lastSync time.Time) error {
 	}
 	defer s.Close()
 
+	var mu sync.Mutex
+	p := pool.NewPool(v.config.Video.SyncWorkers)
 	for o := range objectCh {
+		if ctx.Err() != nil {
+			// drain remaining objects
+			continue
+		}
 		matches := movieRegexp.FindStringSubmatch(o.Path)
 		if matches == nil {
 			//fmt.Printf("no match -- %s\n", path)
 			continue
 		}
-		title := matches[1]
-		year := matches[2]
-		opt := ""
-		if len(matches) > 3 {
-			opt = matches[4]
-		}
-		fmt.Printf("%s (%s) - %s\n", title, year, opt)
+		o := o
+		job.AddTotal(ctx, 1)
+		p.Submit(func() {
+			defer job.Step(ctx)
+			fields := v.syncObject(client, o, matches, &mu)
+			if fields != nil {
+				index := make(search.IndexMap)
+				index[o.Key] = fields
+				s.Index(index)
+			}
+		})
+	}
+	p.Wait()
+	return ctx.Err()
+}
 
-		results, err := client.MovieSearch(title)
-		if err != nil {
-			fmt.Printf("err is %s\n", err)
-			continue
-		}
+// syncObject finds the movie for the bucket object and syncs the movie
+// metadata. Database updates are serialized using the provided mutex.
+func (v *Video) syncObject(client *tmdb.TMDB, o *bucket.Object, matches []string,
+	mu *sync.Mutex) search.FieldMap {
+	title := matches[1]
+	year := matches[2]
+	opt := ""
+	if len(matches) > 3 {
+		opt = matches[4]
+	}
+	fmt.Printf("%s (%s) - %s\n", title, year, opt)
 
-		index := make(search.IndexMap)
+	results, err := client.MovieSearch(title)
+	if err != nil {
+		fmt.Printf("err is %s\n", err)
+		return nil
+	}
 
-		for _, r := range results {
-			fmt.Printf("result %s %s\n", r.Title, r.ReleaseDate)
-			if fuzzyName(title) == fuzzyName(r.Title) &&
-				strings.Contains(r.ReleaseDate, year) {
-				fmt.Printf("--> matched: %s (%s)\n", r.Title, r.ReleaseDate)
-				fields, err := v.syncMovie(client, r.ID,
-					o.Key, o.Size, o.ETag, o.LastModified)
-				if err != nil {
-					fmt.Printf("err %s\n", err)
-					continue
-				}
-				index[o.Key] = fields
-				break
+	for _, r := range results {
+		fmt.Printf("result %s %s\n", r.Title, r.ReleaseDate)
+		if fuzzyName(title) == fuzzyName(r.Title) &&
+			strings.Contains(r.ReleaseDate, year) {
+			fmt.Printf("--> matched: %s (%s)\n", r.Title, r.ReleaseDate)
+			fields, err := v.syncMovie(client, r.ID,
+				o.Key, o.Size, o.ETag, o.LastModified, mu)
+			if err != nil {
+				fmt.Printf("err %s\n", err)
+				continue
 			}
+			return fields
 		}
-
-		s.Index(index)
 	}
 	return nil
 }
@@ -151,7 +219,46 @@ func fuzzyName(name string) string {
 }
 
 func (v *Video) syncMovie(client *tmdb.TMDB, tmid int,
-	key string, size int64, etag string, lastModified time.Time) (search.FieldMap, error) {
+	key string, size int64, etag string, lastModified time.Time,
+	mu *sync.Mutex) (search.FieldMap, error) {
+	// first obtain everything needed from TMDB
+	detail, err := client.MovieDetail(tmid)
+	if err != nil {
+		return nil, err
+	}
+
+	// rating / certification
+	var rating string
+	for _, country := range v.config.Video.ReleaseCountries {
+		release, err := v.certification(client, tmid, country)
+		if err != nil {
+			return nil, err
+		}
+		if release != nil {
+			rating = release.Certification
+			break
+		}
+	}
+
+	keywords, err := client.MovieKeywordNames(tmid)
+	if err != nil {
+		log.Printf("keywords err %s\n", err)
+	}
+
+	credits, err := client.MovieCredits(tmid)
+	if err != nil {
+		return nil, err
+	}
+
+	people, err := v.creditPeople(client, credits)
+	if err != nil {
+		return nil, err
+	}
+
+	// now update the database
+	mu.Lock()
+	defer mu.Unlock()
+
 	v.deleteMovie(tmid)
 	v.deleteCast(tmid)
 	v.deleteCollections(tmid)
@@ -159,13 +266,6 @@ func (v *Video) syncMovie(client *tmdb.TMDB, tmid int,
 	v.deleteGenres(tmid)
 	v.deleteKeywords(tmid)
 
-	fields := make(search.FieldMap)
-
-	detail, err := client.MovieDetail(tmid)
-	if err != nil {
-		return fields, err
-	}
-
 	m := Movie{
 		TMID:             int64(detail.ID),
 		IMID:             detail.IMDB_ID,
@@ -183,37 +283,16 @@ func (v *Video) syncMovie(client *tmdb.TMDB, tmid int,
 		VoteAverage:      detail.VoteAverage,
 		VoteCount:        detail.VoteCount,
 		Date:             date.ParseDate(detail.ReleaseDate), // 2013-02-06
+		Rating:           rating,
 		Key:              key,
 		Size:             size,
 		ETag:             etag,
 		LastModified:     lastModified,
 	}
 
-	// rating / certification
-	for _, country := range v.config.Video.ReleaseCountries {
-		release, err := v.certification(client, tmid, country)
-		if err != nil {
-			return fields, err
-		}
-		if release != nil {
-			m.Rating = release.Certification
-			break
-		}
-	}
-
-	search.AddField(fields, FieldBudget, m.Budget)
-	search.AddField(fields, FieldDate, m.Date)
-	search.AddField(fields, FieldRating, m.Rating)
-	search.AddField(fields, FieldRevenue, m.Revenue)
-	search.AddField(fields, FieldRuntime, m.Runtime)
-	search.AddField(fields, FieldTitle, m.Title)
-	search.AddField(fields, FieldTagline, m.Tagline)
-	search.AddField(fields, FieldVote, int(m.VoteAverage*10))
-	search.AddField(fields, FieldVoteCount, m.VoteCount)
-
 	err = v.createMovie(&m)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
 
 	// collections
@@ -225,32 +304,29 @@ func (v *Video) syncMovie(client *tmdb.TMDB, tmid int,
 		}
 		err = v.createCollection(&c)
 		if err != nil {
-			return fields, err
+			return nil, err
 		}
-		search.AddField(fields, FieldCollection, c.Name)
 	}
 
 	// genres
-	err = v.processGenres(m.TMID, detail.Genres, fields)
+	err = v.processGenres(m.TMID, detail.Genres)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
 
 	// keywords
-	keywords, err := client.MovieKeywordNames(tmid)
-	err = v.processKeywords(m.TMID, keywords, fields)
+	err = v.processKeywords(m.TMID, keywords)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
 
 	// credits
-	credits, err := client.MovieCredits(tmid)
+	err = v.processCredits(m.TMID, credits, people)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
-	err = v.processCredits(m.TMID, client, credits, fields)
 
-	return fields, nil
+	return v.movieFields(m), nil
 }
 
 func (v *Video) syncEpisode(client *tmdb.TMDB, tvid, season, episode int,
@@ -260,16 +336,18 @@ func (v *Video) syncEpisode(client *tmdb.TMDB, tvid, season, episode int,
 	v.deleteCrew(tvid)
 	v.deleteGenres(tvid)
 	v.deleteKeywords(tvid)
-
-	fields := make(search.FieldMap)
-
-	//episodeDetail, err := client.EpisodeDetail(tvid, season, episode)
-	//v.deleteEpisode(tvid)
+	v.deleteTVShow(tvid)
 
 	detail, err := client.TVDetail(tvid)
 	if err != nil {
-		return fields, err
+		return nil, err
+	}
+
+	episodeDetail, err := client.EpisodeDetail(tvid, season, episode)
+	if err != nil {
+		return nil, err
 	}
+	v.deleteEpisode(episodeDetail.ID)
 
 	tv := TVShow{
 		TVID:             int64(detail.ID),
@@ -285,45 +363,62 @@ func (v *Video) syncEpisode(client *tmdb.TMDB, tvid, season, episode int,
 		VoteCount:        detail.VoteCount,
 		Date:             date.ParseDate(detail.FirstAirDate), // 2013-02-06
 		EndDate:          date.ParseDate(detail.LastAirDate),  // 2013-02-06
-		// Key:              key,
-		// Size:             size,
-		// ETag:             etag,
-		// LastModified:     lastModified,
 	}
-
-	search.AddField(fields, FieldDate, tv.Date)
-	search.AddField(fields, FieldName, tv.Name)
-	search.AddField(fields, FieldTagline, tv.Tagline)
-	search.AddField(fields, FieldVote, int(tv.VoteAverage*10))
-	search.AddField(fields, FieldVoteCount, tv.VoteCount)
-
 	err = v.createTVShow(&tv)
 	if err != nil {
-		return fields, err
+		return nil, err
+	}
+
+	e := Episode{
+		EPID:         int64(episodeDetail.ID),
+		TVID:         tv.TVID,
+		Name:         episodeDetail.Name,
+		Overview:     episodeDetail.Overview,
+		Date:         episodeDetail.AirDate,
+		StillPath:    episodeDetail.StillPath,
+		Season:       episodeDetail.SeasonNumber,
+		Episode:      episodeDetail.EpisodeNumber,
+		VoteAverage:  episodeDetail.VoteAverage,
+		VoteCount:    episodeDetail.VoteCount,
+		Key:          key,
+		Size:         size,
+		ETag:         etag,
+		LastModified: lastModified,
+	}
+	err = v.createEpisode(&e)
+	if err != nil {
+		return nil, err
 	}
 
 	// genres
-	err = v.processGenres(tv.TVID, detail.Genres, fields)
+	err = v.processGenres(tv.TVID, detail.Genres)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
 
 	// keywords
-	keywords, err := client.MovieKeywordNames(tvid)
-	err = v.processKeywords(tv.TVID, keywords, fields)
+	keywords, err := client.TVKeywordNames(tvid)
+	err = v.processKeywords(tv.TVID, keywords)
 	if err != nil {
-		return fields, err
+		return nil, err
 	}
 
 	// credits
 	credits, err := client.EpisodeCredits(tvid, season, episode)
 	if err != nil {
-		return fields, err
+		return nil, err
+	}
+	people, err := v.creditPeople(client, credits)
+	if err != nil {
+		return nil, err
 	}
 	// TODO credits for each episode
-	err = v.processCredits(tv.TVID, client, credits, fields)
+	err = v.processCredits(tv.TVID, credits, people)
+	if err != nil {
+		return nil, err
+	}
 
-	return fields, nil
+	return v.episodeFields(e), nil
 }
 
 func personDetail(client *tmdb.TMDB, peid int) (*Person, error) {
@@ -358,7 +453,7 @@ func (v *Video) certification(client *tmdb.TMDB, tmid int, country string) (*tmd
 	return nil, nil
 }
 
-func (v *Video) processGenres(tmid int64, genres []tmdb.Genre, fields search.FieldMap) error {
+func (v *Video) processGenres(tmid int64, genres []tmdb.Genre) error {
 	for _, o := range genres {
 		g := Genre{
 			Name: o.Name,
@@ -368,12 +463,11 @@ func (v *Video) processGenres(tmid int64, genres []tmdb.Genre, fields search.Fie
 		if err != nil {
 			return err
 		}
-		search.AddField(fields, FieldGenre, g.Name)
 	}
 	return nil
 }
 
-func (v *Video) processKeywords(tmid int64, keywords []string, fields search.FieldMap) error {
+func (v *Video) processKeywords(tmid int64, keywords []string) error {
 	for _, keyword := range keywords {
 		k := Keyword{
 			Name: keyword,
@@ -383,94 +477,133 @@ func (v *Video) processKeywords(tmid int64, keywords []string, fields search.Fie
 		if err != nil {
 			return err
 		}
-		search.AddField(fields, FieldKeyword, k.Name)
 	}
 	return nil
 }
 
-func (v *Video) processCredits(tmid int64, client *tmdb.TMDB, credits *tmdb.Credits,
-	fields search.FieldMap) error {
-	// cast
+// castCredits returns cast sorted by order and limited to the configured
+// cast limit.
+func (v *Video) castCredits(credits *tmdb.Credits) []tmdb.Cast {
 	sort.Slice(credits.Cast, func(i, j int) bool {
 		// sort by order
 		return credits.Cast[i].Order < credits.Cast[j].Order
 	})
+	var cast []tmdb.Cast
 	for i, o := range credits.Cast {
 		if i > v.config.Video.CastLimit {
 			break
 		}
-		p, err := v.Person(o.ID)
+		cast = append(cast, o)
+	}
+	return cast
+}
+
+// crewCredits returns crew with configured jobs.
+//
+// DEPARTMENT - JOB
+// Production - Producer, Executive Producer, Casting, Production Coordinator...
+// Directing - Director, Script Supervisor
+// Writing - Story, Screenplay, Novel, Characters
+func (v *Video) crewCredits(credits *tmdb.Credits) []tmdb.Crew {
+	//deptRegexp := regexp.MustCompile(`^(Production|Directing|Writing)$`)
+	jobRegexp := regexp.MustCompile("^(" + strings.Join(v.config.Video.CrewJobs, "|") + ")$")
+	var crew []tmdb.Crew
+	for _, o := range credits.Crew {
+		matches := jobRegexp.FindStringSubmatch(o.Job)
+		if matches == nil {
+			// ignore other jobs
+			continue
+		}
+		crew = append(crew, o)
+	}
+	return crew
+}
+
+// creditPeople obtains people for cast and crew credits, using TMDB for
+// people not already known.
+func (v *Video) creditPeople(client *tmdb.TMDB, credits *tmdb.Credits) (map[int]*Person, error) {
+	people := make(map[int]*Person)
+	var ids []int
+	for _, o := range v.castCredits(credits) {
+		ids = append(ids, o.ID)
+	}
+	for _, o := range v.crewCredits(credits) {
+		ids = append(ids, o.ID)
+	}
+	for _, id := range ids {
+		if _, ok := people[id]; ok {
+			continue
+		}
+		p, err := v.Person(id)
 		if p == nil {
 			// person detail
-			p, err = personDetail(client, o.ID)
-			if err != nil {
-				return err
-			}
-			//fmt.Printf("%s cast person %s -> %s\n", m.Title, p.Name, o.Character)
-			err = v.createPerson(p)
+			p, err = personDetail(client, id)
 			if err != nil {
-				return err
+				return people, err
 			}
 		}
+		people[id] = p
+	}
+	return people, nil
+}
+
+func (v *Video) processCredits(tmid int64, credits *tmdb.Credits, people map[int]*Person) error {
+	// create any new people, unless created by another sync in the meantime
+	for id, p := range people {
+		if p.ID != 0 {
+			continue
+		}
+		existing, _ := v.Person(id)
+		if existing != nil {
+			people[id] = existing
+			continue
+		}
+		err := v.createPerson(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	// cast
+	for _, o := range v.castCredits(credits) {
+		p := people[o.ID]
 		c := Cast{
 			TMID:      tmid,
 			PEID:      p.PEID,
 			Character: o.Character,
 			Rank:      o.Order,
 		}
-		err = v.createCast(&c)
+		err := v.createCast(&c)
 		if err != nil {
 			return err
 		}
-		search.AddField(fields, FieldCast, p.Name)
-		search.AddField(fields, FieldCharacter, c.Character)
 	}
 
-	// DEPARTMENT - JOB
-	// Production - Producer, Executive Producer, Casting, Production Coordinator...
-	// Directing - Director, Script Supervisor
-	// Writing - Story, Screenplay, Novel, Characters
-	//deptRegexp := regexp.MustCompile(`^(Production|Directing|Writing)$`)
-	jobRegexp := regexp.MustCompile("^(" + strings.Join(v.config.Video.CrewJobs, "|") + ")$")
-	for _, o := range credits.Crew {
-		matches := jobRegexp.FindStringSubmatch(o.Job)
-		if matches == nil {
-			// ignore other jobs
-			continue
-		}
-		p, err := v.Person(o.ID)
-		if p == nil {
-			// person detail
-			p, err = personDetail(client, o.ID)
-			if err != nil {
-				return err
-			}
-			//fmt.Printf("%s crew person %s -> %s\n", m.Title, p.Name, o.Job)
-			err = v.createPerson(p)
-			if err != nil {
-				return err
-			}
-		}
+	// crew
+	for _, o := range v.crewCredits(credits) {
+		p := people[o.ID]
 		c := Crew{
 			TMID:       tmid,
 			PEID:       p.PEID,
 			Department: o.Department,
 			Job:        o.Job,
 		}
-		err = v.createCrew(&c)
+		err := v.createCrew(&c)
 		if err != nil {
 			return err
 		}
-		search.AddField(fields, FieldCrew, p.Name)
-		search.AddField(fields, c.Department, p.Name)
-		search.AddField(fields, c.Job, p.Name)
 	}
 	return nil
 }
 
-func (v *Video) SyncPosters(cfg config.ClientConfig) {
+func (v *Video) SyncPosters(ctx context.Context, cfg config.ClientConfig) error {
 	client := client.NewClient(&cfg)
-	for _, m := range v.Movies() {
+	movies := v.Movies()
+	job.AddTotal(ctx, len(movies))
+	for _, m := range movies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// sync poster
 		img := v.TMDBMoviePoster(m)
 		if img != "" {
@@ -484,24 +617,38 @@ func (v *Video) SyncPosters(cfg config.ClientConfig) {
 			log.Printf("sync %s small poster %s\n", m.Title, img)
 			client.Get(img)
 		}
+		job.Step(ctx)
 	}
+	return nil
 }
 
-func (v *Video) SyncBackdrops(cfg config.ClientConfig) {
+func (v *Video) SyncBackdrops(ctx context.Context, cfg config.ClientConfig) error {
 	client := client.NewClient(&cfg)
-	for _, m := range v.Movies() {
+	movies := v.Movies()
+	job.AddTotal(ctx, len(movies))
+	for _, m := range movies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// sync backdrop
 		img := v.TMDBMovieBackdrop(m)
 		if img != "" {
 			log.Printf("sync %s backdrop %s\n", m.Title, img)
 			client.Get(img)
 		}
+		job.Step(ctx)
 	}
+	return nil
 }
 
-func (v *Video) SyncProfileImages(cfg config.ClientConfig) {
+func (v *Video) SyncProfileImages(ctx context.Context, cfg config.ClientConfig) error {
 	client := client.NewClient(&cfg)
-	for _, m := range v.Movies() {
+	movies := v.Movies()
+	job.AddTotal(ctx, len(movies))
+	for _, m := range movies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// cast images
 		cast := v.Cast(m)
 		for _, p := range cast {
@@ -521,5 +668,7 @@ func (v *Video) SyncProfileImages(cfg config.ClientConfig) {
 				client.Get(img)
 			}
 		}
+		job.Step(ctx)
 	}
+	return nil
 }
@@ -90,6 +90,8 @@ func (v *Video) newSearch() (*search.Search, error) {
 	s.Keywords = []string{
 		FieldGenre,
 		FieldKeyword,
+		FieldRating,
+		FieldSortTitle,
 	}
 	err := s.Open("video")
 	if err != nil {
@@ -98,6 +100,88 @@ func (v *Video) newSearch() (*search.Search, error) {
 	return s, nil
 }
 
+const (
+	SuggestMovie  = "movie"
+	SuggestPerson = "person"
+)
+
+func (v *Video) newSuggest() (*search.Suggest, error) {
+	s := search.NewSuggest(v.config)
+	err := s.Open("video_suggest")
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Suggest movie titles and people names which match the prefix.
+func (v *Video) Suggest(prefix string, limit int) []search.Suggestion {
+	s, err := v.newSuggest()
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	defer s.Close()
+	list, err := s.Suggest(prefix, limit)
+	if err != nil {
+		return []search.Suggestion{}
+	}
+	return list
+}
+
+var (
+	sortFields = map[string]string{
+		search.SortDate:       FieldDate,
+		search.SortPopularity: "-" + FieldVoteCount,
+		search.SortTitle:      FieldSortTitle,
+	}
+	facetFields = []string{
+		FieldGenre,
+		FieldRating,
+	}
+)
+
+// SearchPage returns movies for one page of results in the sort order along
+// with the total hits, scores and facet counts.
+func (v *Video) SearchPage(q string, offset, limit int, sort string) ([]Movie, *search.Result, error) {
+	order, err := search.SortOrder(sort, sortFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := v.newSearch()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.Close()
+
+	result, err := s.Query(search.Request{
+		Query:   q,
+		Offset:  offset,
+		Size:    limit,
+		Sort:    order,
+		Facets:  facetFields,
+		Decades: FieldDate,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movies := make(map[string]Movie)
+	for _, m := range v.moviesFor(result.Keys()) {
+		movies[m.Key] = m
+	}
+	// keep hit order and scores aligned with movies
+	var list []Movie
+	var hits []search.Hit
+	for _, h := range result.Hits {
+		if m, ok := movies[h.ID]; ok {
+			list = append(list, m)
+			hits = append(hits, h)
+		}
+	}
+	result.Hits = hits
+	return list, result, nil
+}
+
 func (v *Video) Search(q string, limit ...int) []Movie {
 	s, err := v.newSearch()
 	if err != nil {
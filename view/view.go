@@ -19,11 +19,13 @@ package view
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/defsub/takeout/activity"
 	"github.com/defsub/takeout/auth"
 	"github.com/defsub/takeout/config"
+	"github.com/defsub/takeout/lib/search"
 	"github.com/defsub/takeout/music"
 	"github.com/defsub/takeout/podcast"
 	"github.com/defsub/takeout/progress"
@@ -88,9 +90,12 @@ type Artist struct {
 	Image      string
 	Background string
 	Releases   []music.Release
+	AppearsOn  []music.Release
 	Similar    []music.Artist
+	Related    []music.RelatedArtist
 	CoverSmall CoverFunc `json:"-"`
 	Deep       TrackList `json:"-"`
+	Family     TrackList `json:"-"`
 	Popular    TrackList `json:"-"`
 	Radio      TrackList `json:"-"`
 	Shuffle    TrackList `json:"-"`
@@ -125,9 +130,104 @@ type Release struct {
 	Release    music.Release
 	Image      string
 	Tracks     []music.Track
+	Duration   int // total milliseconds
 	Singles    []music.Track
 	Popular    []music.Track
 	Similar    []music.Release
+	Credits    []music.CreditRole
+	CoverSmall CoverFunc `json:"-"`
+}
+
+// swagger:model
+type Track struct {
+	Track      music.Track
+	Image      string
+	Credits    []music.CreditRole
+	Analysis   *music.Analysis `json:",omitempty"`
+	CoverSmall CoverFunc       `json:"-"`
+}
+
+// swagger:model
+type Lyrics struct {
+	Text   string
+	Synced bool
+	Lines  []LyricsLine
+}
+
+type LyricsLine struct {
+	Time int64 // milliseconds
+	Text string
+}
+
+// swagger:model
+type Credits struct {
+	ARID       string
+	Name       string
+	Roles      []string
+	Tracks     []music.Track
+	CoverSmall CoverFunc `json:"-"`
+}
+
+// swagger:model
+type WantListPage struct {
+	Releases []music.Release
+	Offset   int
+	Limit    int
+	Total    int64
+}
+
+// swagger:model
+type NewReleases struct {
+	Releases []music.NewRelease
+}
+
+// swagger:model
+type Composers struct {
+	Composers []music.Composer
+}
+
+// swagger:model
+type Composer struct {
+	ComposerID string
+	Name       string
+	Works      []music.Work
+}
+
+// swagger:model
+type Work struct {
+	Work       music.Work
+	Release    music.Release
+	Releases   []music.Release
+	Tracks     []music.Track
+	CoverSmall CoverFunc `json:"-"`
+}
+
+// swagger:model
+type Setlist struct {
+	Artist     music.Artist
+	Concert    music.Concert
+	Tracks     []music.Track
+	Missing    []string
+	Ref        string
+	CoverSmall CoverFunc `json:"-"`
+}
+
+// swagger:model
+type Catalog struct {
+	Name  string
+	Terms []search.FacetTerm
+}
+
+// swagger:model
+type CatalogReleases struct {
+	Name       string
+	Term       string
+	Query      string
+	Ref        string
+	Releases   []music.Release
+	Offset     int
+	Limit      int
+	Total      int
 	CoverSmall CoverFunc `json:"-"`
 }
 
@@ -141,10 +241,27 @@ type Search struct {
 	Episodes    []podcast.Episode
 	Query       string
 	Hits        int
+	Sort        string
+	TrackOffset int
+	TrackNext   int // offset of the next page of tracks
+	TrackTotal  int
+	TrackHits   []search.Hit
+	TrackFacets map[string]search.Facet
+	MovieOffset int
+	MovieNext   int // offset of the next page of movies
+	MovieTotal  int
+	MovieHits   []search.Hit
+	MovieFacets map[string]search.Facet
 	CoverSmall  CoverFunc  `json:"-"`
 	PosterSmall PosterFunc `json:"-"`
 }
 
+// swagger:model
+type Suggest struct {
+	Query       string
+	Suggestions []search.Suggestion
+}
+
 // swagger:model
 type Radio struct {
 	Artist     []music.Station
@@ -314,7 +431,9 @@ func ArtistView(ctx Context, artist music.Artist) *Artist {
 	view := &Artist{}
 	view.Artist = artist
 	view.Releases = m.ArtistReleases(&artist)
+	view.AppearsOn = m.AppearsOn(&artist)
 	view.Similar = m.SimilarArtists(&artist)
+	view.Related = m.RelatedArtists(artist)
 	view.Image = m.ArtistImage(&artist)
 	view.Background = m.ArtistBackground(&artist)
 	view.CoverSmall = m.CoverSmall
@@ -344,6 +463,12 @@ func ArtistView(ctx Context, artist music.Artist) *Artist {
 			return m.ArtistRadio(artist)
 		},
 	}
+	view.Family = TrackList{
+		Title: fmt.Sprintf("%s \u2013 Family Radio", artist.Name),
+		Tracks: func() []music.Track {
+			return m.ArtistFamilyRadio(artist)
+		},
+	}
 	view.Shuffle = TrackList{
 		Title: fmt.Sprintf("%s \u2013 Shuffle", artist.Name),
 		Tracks: func() []music.Track {
@@ -394,40 +519,250 @@ func WantListView(ctx Context, artist music.Artist) *WantList {
 	return view
 }
 
+// WantListPageView has a page of wantlist releases from all artists that
+// match the filter.
+func WantListPageView(ctx Context, filter music.WantFilter) *WantListPage {
+	view := &WantListPage{}
+	view.Releases, view.Total = ctx.Music().WantReleases(filter)
+	view.Offset = filter.Offset
+	view.Limit = filter.Limit
+	return view
+}
+
 func ReleaseView(ctx Context, release music.Release) *Release {
 	m := ctx.Music()
 	view := &Release{}
 	view.Release = release
 	view.Artist = *m.Artist(release.Artist)
 	view.Tracks = m.ReleaseTracks(release)
+	view.Duration = music.TracksDuration(view.Tracks)
 	view.Singles = m.ReleaseSingles(release)
 	view.Popular = m.ReleasePopular(release)
 	view.Similar = m.SimilarReleases(&view.Artist, release)
 	view.Image = m.CoverSmall(release)
+	view.Credits = music.CreditRoles(m.ReleaseCredits(release))
+	view.CoverSmall = m.CoverSmall
+	return view
+}
+
+func TrackView(ctx Context, track music.Track) *Track {
+	m := ctx.Music()
+	view := &Track{}
+	view.Track = track
+	view.Image = m.CoverSmall(track)
+	view.Credits = music.CreditRoles(m.TrackCredits(track))
+	if a, err := m.TrackAnalysis(track); err == nil {
+		view.Analysis = a
+	}
+	view.CoverSmall = m.CoverSmall
+	return view
+}
+
+// LyricsView has the unsynced lyrics text and the timestamped lines when
+// the lyrics are synced.
+func LyricsView(ctx Context, lyrics *music.Lyrics) *Lyrics {
+	view := &Lyrics{}
+	view.Text = lyrics.Unsynced()
+	view.Synced = lyrics.Synced()
+	for _, l := range lyrics.Lines() {
+		view.Lines = append(view.Lines, LyricsLine{
+			Time: l.Time.Milliseconds(),
+			Text: l.Text,
+		})
+	}
+	return view
+}
+
+// CreditsView has the tracks a person is credited on and their roles.
+func CreditsView(ctx Context, arid string) *Credits {
+	m := ctx.Music()
+	view := &Credits{}
+	view.ARID = arid
+	roles := make(map[string]bool)
+	for _, c := range m.ArtistCredits(arid) {
+		view.Name = c.Name
+		if !roles[c.Role] {
+			roles[c.Role] = true
+			view.Roles = append(view.Roles, c.Role)
+		}
+	}
+	view.Tracks = m.CreditedTracks(arid)
+	view.CoverSmall = m.CoverSmall
+	return view
+}
+
+// NewReleasesView has recent and upcoming releases by library artists,
+// optionally weighted by the user's activity.
+func NewReleasesView(ctx Context) *NewReleases {
+	var plays map[string]int
+	if ctx.Config().Music.NewReleaseActivity {
+		plays = ctx.Activity().ReleaseGroupPlays(ctx, time.Time{})
+	}
+	view := &NewReleases{}
+	view.Releases = ctx.Music().NewReleases(plays)
+	return view
+}
+
+func ComposersView(ctx Context) *Composers {
+	view := &Composers{}
+	view.Composers = ctx.Music().Composers()
+	return view
+}
+
+func ComposerView(ctx Context, composerID string) *Composer {
+	view := &Composer{}
+	view.ComposerID = composerID
+	view.Works = ctx.Music().ComposerWorks(composerID)
+	if len(view.Works) > 0 {
+		view.Name = view.Works[0].Composer
+	}
+	return view
+}
+
+// WorkView has the releases with the work and the tracks of one release in
+// movement order.
+func WorkView(ctx Context, workID, reid string) *Work {
+	m := ctx.Music()
+	view := &Work{}
+	if work, err := m.LookupWork(workID); err == nil {
+		view.Work = *work
+	}
+	view.Releases = m.WorkReleases(workID)
+	view.Release, view.Tracks, _ = m.WorkRelease(workID, reid)
+	view.CoverSmall = m.CoverSmall
+	return view
+}
+
+// SetlistView has the tracks for a concert setlist along with songs missing
+// from the library.
+func SetlistView(ctx Context, artist music.Artist, setlist *music.ConcertSetlist, ref string) *Setlist {
+	view := &Setlist{}
+	view.Artist = artist
+	view.Concert = setlist.Concert
+	view.Tracks = setlist.Tracks
+	view.Missing = setlist.Missing
+	view.Ref = ref
+	view.CoverSmall = ctx.Music().CoverSmall
+	return view
+}
+
+// CatalogView has the labels, genres, decades or series with track counts.
+func CatalogView(ctx Context, name string) *Catalog {
+	view := &Catalog{Name: name}
+	terms, err := ctx.Music().Catalog(name)
+	if err != nil {
+		terms = []search.FacetTerm{}
+	}
+	view.Terms = terms
+	return view
+}
+
+// CatalogReleasesView has a page of releases for a label, genre, decade or
+// series ordered by date along with a playlist ref for the tracks.
+func CatalogReleasesView(ctx Context, name, term, query string, offset, limit int) *CatalogReleases {
+	m := ctx.Music()
+	view := &CatalogReleases{Name: name, Term: term, Query: query}
+	view.Ref = music.CatalogRef(query)
+	view.Releases, view.Total = m.CatalogReleases(query, offset, limit)
+	view.Offset = offset
+	view.Limit = limit
 	view.CoverSmall = m.CoverSmall
 	return view
 }
 
-func SearchView(ctx Context, query string) *Search {
+// SearchPage has the offsets, limit and sort order for a page of search
+// results. Tracks and movies have separate offsets since each has its own
+// search limit.
+type SearchPage struct {
+	TrackOffset int
+	MovieOffset int
+	Limit       int
+	Sort        string
+}
+
+// More is true when there are more tracks or movies after this page.
+func (s *Search) More() bool {
+	return s.TrackNext < s.TrackTotal || s.MovieNext < s.MovieTotal
+}
+
+// nextOffset returns the offset after a page of results, which is based on
+// the page size rather than the hits returned since hits without matching
+// media are dropped.
+func nextOffset(offset, limit, total int) int {
+	next := offset + limit
+	if next > total {
+		next = total
+	}
+	return next
+}
+
+// SearchView has tracks and movies for one page of search results. Artists,
+// releases and podcasts are only included with the first page. The limit is
+// capped by the configured search limits.
+func SearchView(ctx Context, query string, page SearchPage) *Search {
 	m := ctx.Music()
 	v := ctx.Video()
 	p := ctx.Podcast()
 	view := &Search{}
-	artists, releases, _ := m.Query(query)
-	view.Artists = artists
-	view.Releases = releases
 	view.Query = query
-	view.Tracks = m.Search(query)
-	view.Movies = v.Search(query)
-	view.Series, view.Episodes = p.Search(query)
-	view.Hits = len(view.Artists) + len(view.Releases) + len(view.Tracks) +
-		len(view.Movies) +
+	view.Sort = page.Sort
+	view.TrackOffset = page.TrackOffset
+	view.MovieOffset = page.MovieOffset
+	if page.TrackOffset == 0 && page.MovieOffset == 0 {
+		artists, releases, _ := m.Query(query)
+		view.Artists = artists
+		view.Releases = releases
+		view.Series, view.Episodes = p.Search(query)
+	}
+
+	trackLimit := ctx.Config().Music.SearchLimit
+	if page.Limit > 0 && page.Limit < trackLimit {
+		trackLimit = page.Limit
+	}
+	movieLimit := ctx.Config().Video.SearchLimit
+	if page.Limit > 0 && page.Limit < movieLimit {
+		movieLimit = page.Limit
+	}
+	tracks, result, err := m.SearchPage(query, page.TrackOffset, trackLimit, page.Sort)
+	if err == nil {
+		view.Tracks = tracks
+		view.TrackTotal = result.Total
+		view.TrackHits = result.Hits
+		view.TrackFacets = result.Facets
+	}
+	view.TrackNext = nextOffset(page.TrackOffset, trackLimit, view.TrackTotal)
+	movies, result, err := v.SearchPage(query, page.MovieOffset, movieLimit, page.Sort)
+	if err == nil {
+		view.Movies = movies
+		view.MovieTotal = result.Total
+		view.MovieHits = result.Hits
+		view.MovieFacets = result.Facets
+	}
+	view.MovieNext = nextOffset(page.MovieOffset, movieLimit, view.MovieTotal)
+
+	view.Hits = len(view.Artists) + len(view.Releases) + view.TrackTotal +
+		view.MovieTotal +
 		len(view.Series) + len(view.Episodes)
 	view.CoverSmall = m.CoverSmall
 	view.PosterSmall = v.MoviePosterSmall
 	return view
 }
 
+func SuggestView(ctx Context, query string, limit int) *Suggest {
+	view := &Suggest{Query: query}
+	list := ctx.Music().Suggest(query, limit)
+	list = append(list, ctx.Video().Suggest(query, limit)...)
+	list = append(list, ctx.Podcast().Suggest(query, limit)...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	view.Suggestions = list
+	return view
+}
+
 func RadioView(ctx Context) *Radio {
 	m := ctx.Music()
 	view := &Radio{}